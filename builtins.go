@@ -1,5 +1,7 @@
 package tengo
 
+import "sync"
+
 var builtinFuncs = []*BuiltinFunction{
 	{
 		Name:  "len",
@@ -42,8 +44,9 @@ var builtinFuncs = []*BuiltinFunction{
 		Value: builtinChar,
 	},
 	{
-		Name:  "bytes",
-		Value: builtinBytes,
+		Name:    "bytes",
+		Value:   builtinBytes,
+		VMValue: builtinBytesVM,
 	},
 	{
 		Name:  "time",
@@ -118,8 +121,9 @@ var builtinFuncs = []*BuiltinFunction{
 		Value: builtinTypeName,
 	},
 	{
-		Name:  "format",
-		Value: builtinFormat,
+		Name:    "format",
+		Value:   builtinFormat,
+		VMValue: builtinFormatVM,
 	},
 	{
 		Name:  "range",
@@ -129,11 +133,68 @@ var builtinFuncs = []*BuiltinFunction{
 		Name:  "freeze",
 		Value: builtinFreeze,
 	},
+	{
+		Name:  "is_instance",
+		Value: builtinIsInstance,
+	},
+	{
+		Name:  "set",
+		Value: builtinSet,
+	},
+	{
+		Name:  "is_set",
+		Value: builtinIsSet,
+	},
+	{
+		Name:  "is_immutable_set",
+		Value: builtinIsImmutableSet,
+	},
+	{
+		Name:  "big_int",
+		Value: builtinBigInt,
+	},
+	{
+		Name:  "is_big_int",
+		Value: builtinIsBigInt,
+	},
+	{
+		Name:  "decimal",
+		Value: builtinDecimal,
+	},
+	{
+		Name:  "is_decimal",
+		Value: builtinIsDecimal,
+	},
+}
+
+var (
+	vmBuiltinFuncs     []*BuiltinFunction
+	vmBuiltinFuncsOnce sync.Once
+)
+
+// vmBuiltins returns the builtin functions used by the VM, with the VM-aware
+// variants of the functions that call back into the VM. It's built on first
+// use, as referring to these variants in builtinFuncs would be an
+// initialization cycle.
+func vmBuiltins() []*BuiltinFunction {
+	vmBuiltinFuncsOnce.Do(func() {
+		vmBuiltinFuncs = append([]*BuiltinFunction{}, builtinFuncs...)
+		for idx, fn := range vmBuiltinFuncs {
+			if fn.Name == "string" {
+				vmBuiltinFuncs[idx] = &BuiltinFunction{
+					Name:    fn.Name,
+					Value:   fn.Value,
+					VMValue: builtinStringVM,
+				}
+			}
+		}
+	})
+	return vmBuiltinFuncs
 }
 
 // GetAllBuiltinFunctions returns all builtin function objects.
 func GetAllBuiltinFunctions() []*BuiltinFunction {
-	return append([]*BuiltinFunction{}, builtinFuncs...)
+	return append([]*BuiltinFunction{}, vmBuiltins()...)
 }
 
 func builtinTypeName(args ...Object) (Object, error) {
@@ -163,6 +224,26 @@ func builtinIsInt(args ...Object) (Object, error) {
 	return FalseValue, nil
 }
 
+func builtinIsBigInt(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*BigInt); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsDecimal(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Decimal); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
 func builtinIsFloat(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -243,6 +324,26 @@ func builtinIsImmutableMap(args ...Object) (Object, error) {
 	return FalseValue, nil
 }
 
+func builtinIsSet(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Set); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsImmutableSet(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*ImmutableSet); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
 func builtinIsTime(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -263,6 +364,24 @@ func builtinIsError(args ...Object) (Object, error) {
 	return FalseValue, nil
 }
 
+func builtinIsInstance(args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	typ, ok := args[1].(*RecordType)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "record-type",
+			Found:    args[1].TypeName(),
+		}
+	}
+	if r, ok := args[0].(*Record); ok && r.Type == typ {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
 func builtinIsUndefined(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -319,13 +438,17 @@ func builtinLen(args ...Object) (Object, error) {
 	case *Bytes:
 		return &Int{Value: int64(len(arg.Value))}, nil
 	case *Map:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return &Int{Value: int64(len(arg.Value) + len(arg.Hashed))}, nil
 	case *ImmutableMap:
+		return &Int{Value: int64(len(arg.Value) + len(arg.Hashed))}, nil
+	case *Set:
+		return &Int{Value: int64(len(arg.Value))}, nil
+	case *ImmutableSet:
 		return &Int{Value: int64(len(arg.Value))}, nil
 	default:
 		return nil, ErrInvalidArgumentType{
 			Name:     "first",
-			Expected: "array/string/bytes/map",
+			Expected: "array/string/bytes/map/set",
 			Found:    arg.TypeName(),
 		}
 	}
@@ -397,6 +520,12 @@ func buildRange(start, stop, step int64) *Array {
 }
 
 func builtinFormat(args ...Object) (Object, error) {
+	return builtinFormatVM(nil, args...)
+}
+
+// builtinFormatVM formats the string within the string length limits and
+// the memory budget of the VM.
+func builtinFormatVM(vm *VM, args ...Object) (Object, error) {
 	numArgs := len(args)
 	if numArgs == 0 {
 		return nil, ErrWrongNumArguments
@@ -413,7 +542,7 @@ func builtinFormat(args ...Object) (Object, error) {
 		// okay to return 'format' directly as String is immutable
 		return format, nil
 	}
-	s, err := Format(format.Value, args[1:]...)
+	s, err := vm.Format(format.Value, args[1:]...)
 	if err != nil {
 		return nil, err
 	}
@@ -427,6 +556,20 @@ func builtinCopy(args ...Object) (Object, error) {
 	return args[0].Copy(), nil
 }
 
+// builtinStringVM is builtinString that also calls the string special
+// method of maps and records, which needs the calling VM.
+func builtinStringVM(vm *VM, args ...Object) (Object, error) {
+	if vm == nil || len(args) == 0 || len(args) > 2 ||
+		specialMethod(args[0], methodString) == nil {
+		return builtinString(args...)
+	}
+	v, err := vm.stringOf(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &String{Value: v}, nil
+}
+
 func builtinString(args ...Object) (Object, error) {
 	argsLen := len(args)
 	if !(argsLen == 1 || argsLen == 2) {
@@ -466,6 +609,42 @@ func builtinInt(args ...Object) (Object, error) {
 	return UndefinedValue, nil
 }
 
+func builtinBigInt(args ...Object) (Object, error) {
+	argsLen := len(args)
+	if !(argsLen == 1 || argsLen == 2) {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*BigInt); ok {
+		return args[0], nil
+	}
+	v, ok := ToBigInt(args[0])
+	if ok {
+		return &BigInt{Value: v}, nil
+	}
+	if argsLen == 2 {
+		return args[1], nil
+	}
+	return UndefinedValue, nil
+}
+
+func builtinDecimal(args ...Object) (Object, error) {
+	argsLen := len(args)
+	if !(argsLen == 1 || argsLen == 2) {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Decimal); ok {
+		return args[0], nil
+	}
+	v, ok := ToDecimal(args[0])
+	if ok {
+		return v, nil
+	}
+	if argsLen == 2 {
+		return args[1], nil
+	}
+	return UndefinedValue, nil
+}
+
 func builtinFloat(args ...Object) (Object, error) {
 	argsLen := len(args)
 	if !(argsLen == 1 || argsLen == 2) {
@@ -520,6 +699,12 @@ func builtinChar(args ...Object) (Object, error) {
 }
 
 func builtinBytes(args ...Object) (Object, error) {
+	return builtinBytesVM(nil, args...)
+}
+
+// builtinBytesVM checks the length of the bytes against the bytes length
+// limits and the memory budget of the VM before allocating.
+func builtinBytesVM(vm *VM, args ...Object) (Object, error) {
 	argsLen := len(args)
 	if !(argsLen == 1 || argsLen == 2) {
 		return nil, ErrWrongNumArguments
@@ -530,12 +715,20 @@ func builtinBytes(args ...Object) (Object, error) {
 		if n.Value > int64(MaxBytesLen) {
 			return nil, ErrBytesLimit
 		}
+		if err := vm.CheckBytesLen(int(n.Value)); err != nil {
+			return nil, err
+		}
 		return &Bytes{Value: make([]byte, int(n.Value))}, nil
 	}
+	if s, ok := args[0].(*String); ok {
+		if err := vm.CheckBytesLen(len(s.Value)); err != nil {
+			return nil, err
+		}
+	}
 	v, ok := ToByteSlice(args[0])
 	if ok {
-		if len(v) > MaxBytesLen {
-			return nil, ErrBytesLimit
+		if err := vm.CheckBytesLen(len(v)); err != nil {
+			return nil, err
 		}
 		return &Bytes{Value: v}, nil
 	}
@@ -584,7 +777,7 @@ func builtinAppend(args ...Object) (Object, error) {
 
 // builtinDelete deletes Map keys
 // usage: delete(map, "key")
-// key must be a string
+// key must be a string or a hashable value
 func builtinDelete(args ...Object) (Object, error) {
 	argsLen := len(args)
 	if argsLen != 2 {
@@ -596,9 +789,13 @@ func builtinDelete(args ...Object) (Object, error) {
 			delete(arg.Value, key.Value)
 			return UndefinedValue, nil
 		}
+		if key, ok := hashKeyOf(args[1]); ok {
+			delete(arg.Hashed, key)
+			return UndefinedValue, nil
+		}
 		return nil, ErrInvalidArgumentType{
 			Name:     "second",
-			Expected: "string",
+			Expected: "hashable",
 			Found:    args[1].TypeName(),
 		}
 	default:
@@ -683,6 +880,15 @@ func builtinSplice(args ...Object) (Object, error) {
 	return &Array{Value: deleted}, nil
 }
 
+// set(elements...)
+func builtinSet(args ...Object) (Object, error) {
+	s, err := NewSet(args...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func builtinFreeze(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -714,6 +920,15 @@ func freezeObject(o Object, memo map[Object]Object) Object {
 		for k, val := range v.Value {
 			frozen.Value[k] = freezeObject(val, memo)
 		}
+		if v.Hashed != nil {
+			frozen.Hashed = make(map[HashKey]MapEntry, len(v.Hashed))
+			for k, e := range v.Hashed {
+				frozen.Hashed[k] = MapEntry{
+					Key:   e.Key,
+					Value: freezeObject(e.Value, memo),
+				}
+			}
+		}
 		return frozen
 
 	case *ImmutableArray:
@@ -742,10 +957,25 @@ func freezeObject(o Object, memo map[Object]Object) Object {
 				changed = true
 			}
 		}
+		var newHashed map[HashKey]MapEntry
+		if v.Hashed != nil {
+			newHashed = make(map[HashKey]MapEntry, len(v.Hashed))
+			for k, e := range v.Hashed {
+				f := freezeObject(e.Value, memo)
+				newHashed[k] = MapEntry{Key: e.Key, Value: f}
+				if f != e.Value {
+					changed = true
+				}
+			}
+		}
 		if !changed {
 			return o
 		}
-		return &ImmutableMap{Value: newMap}
+		return &ImmutableMap{Value: newMap, Hashed: newHashed}
+
+	case *Set:
+		// elements are hashable, so they are already immutable
+		return &ImmutableSet{Value: copySet(v.Value)}
 
 	default:
 		// Primitives, strings, bytes, time, functions, errors — return as-is.
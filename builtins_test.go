@@ -51,10 +51,14 @@ func Test_builtinDelete(t *testing.T) {
 			want: tengo.UndefinedValue,
 		},
 		{name: "nil-map-nonstr-key",
+			args: args{[]tengo.Object{&tengo.Map{}, &tengo.Int{}}},
+			want: tengo.UndefinedValue,
+		},
+		{name: "nil-map-unhashable-key",
 			args: args{[]tengo.Object{
-				&tengo.Map{}, &tengo.Int{}}}, wantErr: true,
+				&tengo.Map{}, &tengo.Array{}}}, wantErr: true,
 			wantedErr: tengo.ErrInvalidArgumentType{
-				Name: "second", Expected: "string", Found: "int"},
+				Name: "second", Expected: "hashable", Found: "array"},
 		},
 		{name: "nil-map-no-key",
 			args: args{[]tengo.Object{&tengo.Map{}}}, wantErr: true,
@@ -83,6 +87,29 @@ func Test_builtinDelete(t *testing.T) {
 			want:   tengo.UndefinedValue,
 			target: &tengo.Map{Value: map[string]tengo.Object{}},
 		},
+		{name: "map-int-key",
+			args: args{
+				[]tengo.Object{
+					&tengo.Map{
+						Value: map[string]tengo.Object{
+							"1": &tengo.String{Value: "a"},
+						},
+						Hashed: map[tengo.HashKey]tengo.MapEntry{
+							{Type: "int", Value: int64(1)}: {
+								Key:   &tengo.Int{Value: 1},
+								Value: &tengo.String{Value: "b"},
+							},
+						},
+					},
+					&tengo.Int{Value: 1}}},
+			want: tengo.UndefinedValue,
+			target: &tengo.Map{
+				Value: map[string]tengo.Object{
+					"1": &tengo.String{Value: "a"},
+				},
+				Hashed: map[tengo.HashKey]tengo.MapEntry{},
+			},
+		},
 		{name: "map-multi-keys",
 			args: args{
 				[]tengo.Object{
@@ -505,6 +532,46 @@ func Test_builtinRange(t *testing.T) {
 	}
 }
 
+func TestBuiltinString(t *testing.T) {
+	var fn *tengo.BuiltinFunction
+	for _, f := range tengo.GetAllBuiltinFunctions() {
+		if f.Name == "string" {
+			fn = f
+			break
+		}
+	}
+	if fn == nil {
+		t.Fatal("builtin string not found")
+	}
+	if fn.VMValue == nil {
+		t.Fatal("builtin string does not take the calling VM")
+	}
+
+	got, err := fn.Value(&tengo.Int{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &tengo.String{Value: "1"}) {
+		t.Fatalf("unexpected value: %v", got)
+	}
+
+	// called without a VM, the special method is not used
+	m := &tengo.Map{Value: map[string]tengo.Object{
+		"__string__": &tengo.BuiltinFunction{
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return &tengo.String{Value: "x"}, nil
+			},
+		},
+	}}
+	got, err = fn.Call(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*tengo.String); !ok {
+		t.Fatalf("expected *String, got %T", got)
+	}
+}
+
 func TestBuiltinFreeze(t *testing.T) {
 	var freeze func(args ...tengo.Object) (tengo.Object, error)
 	for _, f := range tengo.GetAllBuiltinFunctions() {
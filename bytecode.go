@@ -136,6 +136,8 @@ func (b *Bytecode) RemoveDuplicates() {
 	strings := make(map[string]int)
 	floats := make(map[float64]int)
 	chars := make(map[rune]int)
+	bigInts := make(map[string]int)
+	decimals := make(map[string]int)
 	immutableMaps := make(map[string]int) // for modules
 
 	for curIdx, c := range b.Constants {
@@ -160,6 +162,10 @@ func (b *Bytecode) RemoveDuplicates() {
 				indexMap[curIdx] = newIdx
 				deduped = append(deduped, c)
 			}
+		case *ImmutableArray:
+			// folded constant; not de-duplicated
+			indexMap[curIdx] = len(deduped)
+			deduped = append(deduped, c)
 		case *Int:
 			if newIdx, ok := ints[c.Value]; ok {
 				indexMap[curIdx] = newIdx
@@ -196,6 +202,26 @@ func (b *Bytecode) RemoveDuplicates() {
 				indexMap[curIdx] = newIdx
 				deduped = append(deduped, c)
 			}
+		case *BigInt:
+			key := c.Value.String()
+			if newIdx, ok := bigInts[key]; ok {
+				indexMap[curIdx] = newIdx
+			} else {
+				newIdx = len(deduped)
+				bigInts[key] = newIdx
+				indexMap[curIdx] = newIdx
+				deduped = append(deduped, c)
+			}
+		case *Decimal:
+			key := c.String()
+			if newIdx, ok := decimals[key]; ok {
+				indexMap[curIdx] = newIdx
+			} else {
+				newIdx = len(deduped)
+				decimals[key] = newIdx
+				indexMap[curIdx] = newIdx
+				deduped = append(deduped, c)
+			}
 		default:
 			panic(fmt.Errorf("unsupported top-level constant type: %s",
 				c.TypeName()))
@@ -253,6 +279,13 @@ func fixDecodedObject(
 			}
 			o.Value[k] = fv
 		}
+		for k, e := range o.Hashed {
+			fv, err := fixDecodedObject(e.Value, modules)
+			if err != nil {
+				return nil, err
+			}
+			o.Hashed[k] = MapEntry{Key: e.Key, Value: fv}
+		}
 	case *ImmutableMap:
 		modName := inferModuleName(o)
 		if mod := modules.GetBuiltinModule(modName); mod != nil {
@@ -271,6 +304,17 @@ func fixDecodedObject(
 			}
 			o.Value[k] = fv
 		}
+		for k, e := range o.Hashed {
+			if _, isUserFunction := e.Value.(*UserFunction); isUserFunction {
+				return nil, fmt.Errorf("user function not decodable")
+			}
+
+			fv, err := fixDecodedObject(e.Value, modules)
+			if err != nil {
+				return nil, err
+			}
+			o.Hashed[k] = MapEntry{Key: e.Key, Value: fv}
+		}
 	}
 	return o, nil
 }
@@ -283,7 +327,7 @@ func updateConstIndexes(insts []byte, indexMap map[int]int) {
 		_, read := parser.ReadOperands(numOperands, insts[i+1:])
 
 		switch op {
-		case parser.OpConstant:
+		case parser.OpConstant, parser.OpReturnConst:
 			curIdx := int(insts[i+2]) | int(insts[i+1])<<8
 			newIdx, ok := indexMap[curIdx]
 			if !ok {
@@ -298,6 +342,14 @@ func updateConstIndexes(insts []byte, indexMap map[int]int) {
 				panic(fmt.Errorf("constant index not found: %d", curIdx))
 			}
 			copy(insts[i:], MakeInstruction(op, newIdx, numFree))
+		case parser.OpAssignLocal:
+			curIdx := int(insts[i+3]) | int(insts[i+2])<<8
+			newIdx, ok := indexMap[curIdx]
+			if !ok {
+				panic(fmt.Errorf("constant index not found: %d", curIdx))
+			}
+			copy(insts[i:], MakeInstruction(op, int(insts[i+1]), newIdx,
+				int(insts[i+4])))
 		}
 
 		i += 1 + read
@@ -315,6 +367,8 @@ func init() {
 	gob.Register(&parser.SourceFileSet{})
 	gob.Register(&parser.SourceFile{})
 	gob.Register(&Array{})
+	gob.Register(&BigInt{})
+	gob.Register(&Decimal{})
 	gob.Register(&Bool{})
 	gob.Register(&Bytes{})
 	gob.Register(&Char{})
@@ -323,10 +377,18 @@ func init() {
 	gob.Register(&Float{})
 	gob.Register(&ImmutableArray{})
 	gob.Register(&ImmutableMap{})
+	gob.Register(&ImmutableSet{})
 	gob.Register(&Int{})
 	gob.Register(&Map{})
+	gob.Register(&Set{})
 	gob.Register(&String{})
 	gob.Register(&Time{})
 	gob.Register(&Undefined{})
 	gob.Register(&UserFunction{})
+
+	// values of the hash keys of time values
+	gob.Register([2]int64{})
+
+	// values of the hash keys of immutable arrays
+	gob.Register(tupleKey{})
 }
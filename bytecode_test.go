@@ -2,6 +2,7 @@ package tengo_test
 
 import (
 	"bytes"
+	"math/big"
 	"testing"
 	"time"
 
@@ -31,6 +32,19 @@ func TestBytecode(t *testing.T) {
 			&tengo.Int{Value: 192},
 			&tengo.String{Value: "bar"})))
 
+	testBytecodeSerialization(t, bytecode(
+		concatInsts(), objectsArray(
+			&tengo.Int{Value: 1},
+			compiledFunction(2, 2,
+				tengo.MakeInstruction(parser.OpAssignLocal, 0, 0, 11),
+				tengo.MakeInstruction(parser.OpIndexLocals, 0, 1),
+				tengo.MakeInstruction(parser.OpReturnConst, 0)))))
+
+	testBytecodeSerialization(t, bytecode(
+		concatInsts(), objectsArray(
+			&tengo.BigInt{Value: big.NewInt(-1234)},
+			&tengo.Decimal{Value: big.NewInt(1234), Scale: 2})))
+
 	testBytecodeSerialization(t, bytecodeFileSet(
 		concatInsts(
 			tengo.MakeInstruction(parser.OpConstant, 0),
@@ -93,6 +107,13 @@ func TestBytecode(t *testing.T) {
 							"f": tengo.UndefinedValue,
 						},
 					},
+					"set": immutableSet(&tengo.Int{Value: 1},
+						&tengo.String{Value: "a"}, &tengo.Char{Value: 'b'},
+						&tengo.Float{Value: 1.5}, tengo.TrueValue,
+						&tengo.Time{Value: time.Now()},
+						&tengo.ImmutableArray{Value: []tengo.Object{
+							&tengo.Int{Value: 1}, &tengo.Int{Value: 2},
+						}}),
 					"string":    &tengo.String{Value: "foo bar"},
 					"time":      &tengo.Time{Value: time.Now()},
 					"undefined": tengo.UndefinedValue,
@@ -230,6 +251,50 @@ func TestBytecode_RemoveDuplicates(t *testing.T) {
 				&tengo.Int{Value: 1},
 				&tengo.Int{Value: 2},
 				&tengo.Int{Value: 3})))
+
+	// fused instructions with constant operands
+	testBytecodeRemoveDuplicates(t,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 3)),
+			objectsArray(
+				&tengo.Int{Value: 1},
+				&tengo.Int{Value: 2},
+				&tengo.Int{Value: 1},
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpAssignLocal, 0, 2, 11),
+					tengo.MakeInstruction(parser.OpReturnConst, 1)))),
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 2)),
+			objectsArray(
+				&tengo.Int{Value: 1},
+				&tengo.Int{Value: 2},
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpAssignLocal, 0, 0, 11),
+					tengo.MakeInstruction(parser.OpReturnConst, 1)))))
+
+	// decimals of different scales are different constants
+	testBytecodeRemoveDuplicates(t,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2)),
+			objectsArray(
+				&tengo.Decimal{Value: big.NewInt(15), Scale: 1},
+				&tengo.Decimal{Value: big.NewInt(150), Scale: 2},
+				&tengo.Decimal{Value: big.NewInt(15), Scale: 1})),
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 0)),
+			objectsArray(
+				&tengo.Decimal{Value: big.NewInt(15), Scale: 1},
+				&tengo.Decimal{Value: big.NewInt(150), Scale: 2})))
 }
 
 func TestBytecode_CountObjects(t *testing.T) {
@@ -296,3 +361,11 @@ func testBytecodeSerialization(t *testing.T, b *tengo.Bytecode) {
 	require.Equal(t, b.MainFunction, r.MainFunction)
 	require.Equal(t, b.Constants, r.Constants)
 }
+
+func immutableSet(elements ...tengo.Object) *tengo.ImmutableSet {
+	s, err := tengo.NewSet(elements...)
+	if err != nil {
+		panic(err)
+	}
+	return &tengo.ImmutableSet{Value: s.Value}
+}
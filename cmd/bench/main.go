@@ -12,6 +12,7 @@ func main() {
 	runFib(35)
 	runFibTC1(35)
 	runFibTC2(35)
+	runLoop(10000000)
 }
 
 func runFib(n int) {
@@ -125,6 +126,46 @@ fib := func(x, a, b) {
 	fmt.Printf("VM:      %s\n", runTime)
 }
 
+func runLoop(n int) {
+	start := time.Now()
+	nativeResult := loop(n)
+	nativeTime := time.Since(start)
+
+	input := `
+loop := func(n) {
+	s := 0
+	f := 0.0
+	for i := 0; i < n; i++ {
+		if i % 3 == 0 {
+			s += i
+		} else {
+			f += 0.5
+		}
+	}
+	return s + int(f)
+}
+` + fmt.Sprintf("out = loop(%d)", n)
+
+	parseTime, compileTime, runTime, result, err := runBench([]byte(input))
+	if err != nil {
+		panic(err)
+	}
+
+	if nativeResult != int(result.(*tengo.Int).Value) {
+		panic(fmt.Errorf("wrong result: %d != %d", nativeResult,
+			int(result.(*tengo.Int).Value)))
+	}
+
+	fmt.Println("-------------------------------------")
+	fmt.Printf("loop(%d)\n", n)
+	fmt.Println("-------------------------------------")
+	fmt.Printf("Result:  %d\n", nativeResult)
+	fmt.Printf("Go:      %s\n", nativeTime)
+	fmt.Printf("Parser:  %s\n", parseTime)
+	fmt.Printf("Compile: %s\n", compileTime)
+	fmt.Printf("VM:      %s\n", runTime)
+}
+
 func fib(n int) int {
 	if n == 0 {
 		return 0
@@ -154,6 +195,19 @@ func fibTC2(n, a, b int) int {
 	}
 }
 
+func loop(n int) int {
+	s := 0
+	f := 0.0
+	for i := 0; i < n; i++ {
+		if i%3 == 0 {
+			s += i
+		} else {
+			f += 0.5
+		}
+	}
+	return s + int(f)
+}
+
 func runBench(
 	input []byte,
 ) (
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -20,6 +22,8 @@ type compilationScope struct {
 	Instructions []byte
 	SymbolInit   map[string]bool
 	SourceMap    map[int]parser.Pos
+	Generator    bool        // function contains a yield statement
+	ValueReturn  parser.Node // first return statement with values; or nil
 }
 
 // loop represents a loop construct that the compiler uses to track the current
@@ -27,8 +31,25 @@ type compilationScope struct {
 type loop struct {
 	Continues []int
 	Breaks    []int
+	Switch    bool // switch statement; continue applies to the outer loop
 }
 
+// tryBlock represents a try statement that the compiler uses to remove the
+// handlers and run the finally block when the control leaves the statement
+// by return, break or continue.
+type tryBlock struct {
+	Finally    *parser.BlockStmt
+	Handlers   int // number of handlers set up at the current position
+	ScopeIndex int
+	LoopIndex  int
+}
+
+// flags of the second operand of OpCall
+const (
+	callSpread = 1 << iota // the last argument is spread
+	callTail               // the result of the call is returned right away
+)
+
 // CompilerError represents a compiler error.
 type CompilerError struct {
 	FileSet *parser.SourceFileSet
@@ -55,8 +76,13 @@ type Compiler struct {
 	modules         ModuleGetter
 	compiledModules map[string]*CompiledFunction
 	allowFileImport bool
+	maxStringLen    int
+	peephole        bool
 	loops           []*loop
 	loopIndex       int
+	tryBlocks       []*tryBlock
+	chainJumps      []int  // jumps to the end of the current optional chain
+	funcName        string // name of the next function literal
 	trace           io.Writer
 	indent          int
 }
@@ -100,6 +126,8 @@ func NewCompiler(
 		modules:         modules,
 		compiledModules: make(map[string]*CompiledFunction),
 		importFileExt:   []string{SourceFileExtDefault},
+		maxStringLen:    -1,
+		peephole:        true,
 	}
 }
 
@@ -138,7 +166,12 @@ func (c *Compiler) Compile(node parser.Node) error {
 			return err
 		}
 	case *parser.BinaryExpr:
-		if node.Token == token.LAnd || node.Token == token.LOr {
+		if folded, err := c.compileFolded(node); folded || err != nil {
+			return err
+		}
+
+		if node.Token == token.LAnd || node.Token == token.LOr ||
+			node.Token == token.Coalesce {
 			return c.compileLogical(node)
 		}
 
@@ -184,6 +217,11 @@ func (c *Compiler) Compile(node parser.Node) error {
 			c.emit(node, parser.OpBinaryOp, int(token.Shl))
 		case token.Shr:
 			c.emit(node, parser.OpBinaryOp, int(token.Shr))
+		case token.In:
+			c.emit(node, parser.OpContains)
+		case token.NotIn:
+			c.emit(node, parser.OpContains)
+			c.emit(node, parser.OpLNot)
 		default:
 			return c.errorf(node, "invalid binary operator: %s",
 				node.Token.String())
@@ -191,9 +229,18 @@ func (c *Compiler) Compile(node parser.Node) error {
 	case *parser.IntLit:
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&Int{Value: node.Value}))
+	case *parser.BigIntLit:
+		c.emit(node, parser.OpConstant,
+			c.addConstant(&BigInt{Value: node.Value}))
 	case *parser.FloatLit:
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&Float{Value: node.Value}))
+	case *parser.DecimalLit:
+		d, err := ParseDecimal(node.Value)
+		if err != nil {
+			return c.error(node, err)
+		}
+		c.emit(node, parser.OpConstant, c.addConstant(d))
 	case *parser.BoolLit:
 		if node.Value {
 			c.emit(node, parser.OpTrue)
@@ -206,12 +253,37 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&String{Value: node.Value}))
+	case *parser.InterpStringLit:
+		// the parts and the values of the expressions are concatenated by
+		// a single instruction
+		var numItems int
+		for i, part := range node.Parts {
+			if part.Value != "" {
+				if len(part.Value) > MaxStringLen {
+					return c.error(part, ErrStringLimit)
+				}
+				c.emit(part, parser.OpConstant,
+					c.addConstant(&String{Value: part.Value}))
+				numItems++
+			}
+			if i < len(node.Exprs) {
+				if err := c.Compile(node.Exprs[i]); err != nil {
+					return err
+				}
+				numItems++
+			}
+		}
+		c.emit(node, parser.OpConcat, numItems)
 	case *parser.CharLit:
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&Char{Value: node.Value}))
 	case *parser.UndefinedLit:
 		c.emit(node, parser.OpNull)
 	case *parser.UnaryExpr:
+		if folded, err := c.compileFolded(node); folded || err != nil {
+			return err
+		}
+
 		if err := c.Compile(node.Expr); err != nil {
 			return err
 		}
@@ -273,20 +345,52 @@ func (c *Compiler) Compile(node parser.Node) error {
 		return c.compileForStmt(node)
 	case *parser.ForInStmt:
 		return c.compileForInStmt(node)
+	case *parser.SwitchStmt:
+		return c.compileSwitchStmt(node)
+	case *parser.TryStmt:
+		return c.compileTryStmt(node)
+	case *parser.TypeStmt:
+		return c.compileTypeStmt(node)
+	case *parser.MethodStmt:
+		return c.compileMethodStmt(node)
+	case *parser.DeferStmt:
+		if err := c.Compile(node.Call.Func); err != nil {
+			return err
+		}
+		for _, arg := range node.Call.Args {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		ellipsis := 0
+		if node.Call.Ellipsis.IsValid() {
+			ellipsis = 1
+		}
+		c.emit(node, parser.OpDefer, len(node.Call.Args), ellipsis)
 	case *parser.BranchStmt:
 		if node.Token == token.Break {
 			curLoop := c.currentLoop()
 			if curLoop == nil {
 				return c.errorf(node, "break not allowed outside loop")
 			}
+			if err := c.leaveTryBlocks(node, c.loopIndex); err != nil {
+				return err
+			}
 			pos := c.emit(node, parser.OpJump, 0)
 			curLoop.Breaks = append(curLoop.Breaks, pos)
 		} else if node.Token == token.Continue {
-			curLoop := c.currentLoop()
-			if curLoop == nil {
+			loopIndex := c.loopIndex
+			for loopIndex >= 0 && c.loops[loopIndex].Switch {
+				loopIndex--
+			}
+			if loopIndex < 0 {
 				return c.errorf(node, "continue not allowed outside loop")
 			}
+			if err := c.leaveTryBlocks(node, loopIndex); err != nil {
+				return err
+			}
 			pos := c.emit(node, parser.OpJump, 0)
+			curLoop := c.loops[loopIndex]
 			curLoop.Continues = append(curLoop.Continues, pos)
 		} else {
 			panic(fmt.Errorf("invalid branch statement: %s",
@@ -335,8 +439,26 @@ func (c *Compiler) Compile(node parser.Node) error {
 			}
 		}
 		c.emit(node, parser.OpArray, len(node.Elements))
+	case *parser.SpreadExpr:
+		if err := c.Compile(node.Expr); err != nil {
+			return err
+		}
+		c.emit(node, parser.OpSpread)
 	case *parser.MapLit:
 		for _, elt := range node.Elements {
+			if elt.IsSpread() {
+				// source map in the key slot; the value slot is unused
+				if err := c.Compile(elt.Value); err != nil {
+					return err
+				}
+				c.emit(node, parser.OpNull)
+				continue
+			}
+			if !elt.ColonPos.IsValid() {
+				return c.errorf(elt, "missing value for map key '%s'",
+					elt.Key)
+			}
+
 			// key
 			if len(elt.Key) > MaxStringLen {
 				return c.error(node, ErrStringLimit)
@@ -351,10 +473,23 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpMap, len(node.Elements)*2)
 
+	case *parser.ChainExpr:
+		chainJumps := c.chainJumps
+		c.chainJumps = nil
+		if err := c.Compile(node.Expr); err != nil {
+			return err
+		}
+		for _, pos := range c.chainJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+		c.chainJumps = chainJumps
 	case *parser.SelectorExpr: // selector on RHS side
 		if err := c.Compile(node.Expr); err != nil {
 			return err
 		}
+		if node.Optional {
+			c.emitChainJump(node)
+		}
 		if err := c.Compile(node.Sel); err != nil {
 			return err
 		}
@@ -363,6 +498,9 @@ func (c *Compiler) Compile(node parser.Node) error {
 		if err := c.Compile(node.Expr); err != nil {
 			return err
 		}
+		if node.Optional {
+			c.emitChainJump(node)
+		}
 		if err := c.Compile(node.Index); err != nil {
 			return err
 		}
@@ -371,6 +509,9 @@ func (c *Compiler) Compile(node parser.Node) error {
 		if err := c.Compile(node.Expr); err != nil {
 			return err
 		}
+		if node.Optional {
+			c.emitChainJump(node)
+		}
 		if node.Low != nil {
 			if err := c.Compile(node.Low); err != nil {
 				return err
@@ -387,6 +528,8 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpSliceIndex)
 	case *parser.FuncLit:
+		name := c.funcName
+		c.funcName = ""
 		c.enterScope()
 
 		for _, p := range node.Type.Params.List {
@@ -402,6 +545,13 @@ func (c *Compiler) Compile(node parser.Node) error {
 
 		// code optimization
 		c.optimizeFunc(node)
+		c.fuseInstructions()
+
+		scope := c.scopes[c.scopeIndex]
+		if scope.Generator && scope.ValueReturn != nil {
+			return c.errorf(scope.ValueReturn,
+				"return with values not allowed in generator")
+		}
 
 		freeSymbols := c.symbolTable.FreeSymbols()
 		numLocals := c.symbolTable.MaxSymbols()
@@ -461,11 +611,13 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 
 		compiledFunction := &CompiledFunction{
+			Name:          name,
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Type.Params.List),
 			VarArgs:       node.Type.Params.VarArgs,
 			SourceMap:     sourceMap,
+			Generator:     scope.Generator,
 		}
 		if len(freeSymbols) > 0 {
 			c.emit(node, parser.OpClosure,
@@ -473,34 +625,54 @@ func (c *Compiler) Compile(node parser.Node) error {
 		} else {
 			c.emit(node, parser.OpConstant, c.addConstant(compiledFunction))
 		}
-	case *parser.ReturnStmt:
+	case *parser.YieldStmt:
 		if c.symbolTable.Parent(true) == nil {
 			// outside the function
-			return c.errorf(node, "return not allowed outside function")
+			return c.errorf(node, "yield not allowed outside function")
 		}
 
 		if node.Result == nil {
-			c.emit(node, parser.OpReturn, 0)
+			c.emit(node, parser.OpNull)
 		} else {
 			if err := c.Compile(node.Result); err != nil {
 				return err
 			}
-			c.emit(node, parser.OpReturn, 1)
 		}
-	case *parser.CallExpr:
-		if err := c.Compile(node.Func); err != nil {
-			return err
+		c.emit(node, parser.OpYield)
+		c.scopes[c.scopeIndex].Generator = true
+	case *parser.ReturnStmt:
+		if c.symbolTable.Parent(true) == nil {
+			// outside the function
+			return c.errorf(node, "return not allowed outside function")
 		}
-		for _, arg := range node.Args {
-			if err := c.Compile(arg); err != nil {
+
+		results := node.Values()
+		if len(results) > MaxReturnValues {
+			return c.errorf(node, "too many return values")
+		}
+		if len(results) > 0 &&
+			c.scopes[c.scopeIndex].ValueReturn == nil {
+			c.scopes[c.scopeIndex].ValueReturn = node
+		}
+		if call, ok := tailCall(node); ok && !c.inTryBlock() {
+			// the frame of the function can be reused by the callee, as
+			// there are no handlers or finally blocks to run after the call
+			if err := c.compileCall(call, true); err != nil {
 				return err
 			}
+		} else {
+			for _, result := range results {
+				if err := c.Compile(result); err != nil {
+					return err
+				}
+			}
 		}
-		ellipsis := 0
-		if node.Ellipsis.IsValid() {
-			ellipsis = 1
+		if err := c.leaveTryBlocks(node, -1); err != nil {
+			return err
 		}
-		c.emit(node, parser.OpCall, len(node.Args), ellipsis)
+		c.emit(node, parser.OpReturn, len(results))
+	case *parser.CallExpr:
+		return c.compileCall(node, false)
 	case *parser.ImportExpr:
 		if node.ModuleName == "" {
 			return c.errorf(node, "empty module name")
@@ -564,6 +736,9 @@ func (c *Compiler) Compile(node parser.Node) error {
 			return err
 		}
 		c.emit(node, parser.OpImmutable)
+		if err := c.leaveTryBlocks(node, -1); err != nil {
+			return err
+		}
 		c.emit(node, parser.OpReturn, 1)
 	case *parser.ErrorExpr:
 		if err := c.Compile(node.Expr); err != nil {
@@ -571,11 +746,19 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpError)
 	case *parser.ImmutableExpr:
+		if folded, err := c.compileFolded(node); folded || err != nil {
+			return err
+		}
+
 		if err := c.Compile(node.Expr); err != nil {
 			return err
 		}
 		c.emit(node, parser.OpImmutable)
 	case *parser.CondExpr:
+		if folded, err := c.compileFolded(node); folded || err != nil {
+			return err
+		}
+
 		if err := c.Compile(node.Cond); err != nil {
 			return err
 		}
@@ -621,6 +804,22 @@ func (c *Compiler) EnableFileImport(enable bool) {
 	c.allowFileImport = enable
 }
 
+// EnablePeephole enables or disables the fusion of common instruction
+// sequences into single instructions. The fusion is enabled by default, and
+// disabling it can make the compiled instructions easier to follow when
+// debugging.
+func (c *Compiler) EnablePeephole(enable bool) {
+	c.peephole = enable
+}
+
+// SetMaxStringLen sets the maximum byte-length of string values created by
+// constant folding. Longer strings are left to the VM, so the same limit of
+// the VM applies to them. A negative value means only MaxStringLen is
+// applied.
+func (c *Compiler) SetMaxStringLen(n int) {
+	c.maxStringLen = n
+}
+
 // SetImportDir sets the initial import directory path for file imports.
 func (c *Compiler) SetImportDir(dir string) {
 	c.importDir = dir
@@ -665,9 +864,16 @@ func (c *Compiler) compileAssign(
 	op token.Token,
 ) error {
 	numLHS, numRHS := len(lhs), len(rhs)
-	if numLHS > 1 || numRHS > 1 {
+	if numRHS > 1 {
 		return c.errorf(node, "tuple assignment not allowed")
 	}
+	if numLHS > 1 || isPattern(lhs[0]) {
+		return c.compileDestructuring(node, lhs, rhs[0], op)
+	}
+
+	if _, ok := lhs[0].(*parser.ChainExpr); ok {
+		return c.errorf(node, "cannot assign to '%s'", lhs[0].String())
+	}
 
 	// resolve and compile left-hand side
 	ident, selectors := resolveAssignLHS(lhs[0])
@@ -700,6 +906,11 @@ func (c *Compiler) compileAssign(
 		}
 	}
 
+	if isFunc && numSel == 0 {
+		// name the function after the variable for the stack traces
+		c.funcName = ident
+	}
+
 	// compile RHSs
 	for _, expr := range rhs {
 		if err := c.Compile(expr); err != nil {
@@ -736,7 +947,19 @@ func (c *Compiler) compileAssign(
 		c.emit(node, parser.OpBinaryOp, int(token.Shr))
 	}
 
+	return c.compileStore(node, symbol, selectors, op == token.Define)
+}
+
+// compileStore compiles the selectors and stores the value on top of the
+// stack to the variable.
+func (c *Compiler) compileStore(
+	node parser.Node,
+	symbol *Symbol,
+	selectors []parser.Expr,
+	define bool,
+) error {
 	// compile selector expressions (right to left)
+	numSel := len(selectors)
 	for i := numSel - 1; i >= 0; i-- {
 		if err := c.Compile(selectors[i]); err != nil {
 			return err
@@ -754,7 +977,7 @@ func (c *Compiler) compileAssign(
 		if numSel > 0 {
 			c.emit(node, parser.OpSetSelLocal, symbol.Index, numSel)
 		} else {
-			if op == token.Define && !symbol.LocalAssigned {
+			if define && !symbol.LocalAssigned {
 				c.emit(node, parser.OpDefineLocal, symbol.Index)
 			} else {
 				c.emit(node, parser.OpSetLocal, symbol.Index)
@@ -776,6 +999,152 @@ func (c *Compiler) compileAssign(
 	return nil
 }
 
+// compileDestructuring compiles an assignment of multiple values returned
+// by a function, or of the elements of an array or a map pattern, e.g.
+//
+//	a, b := f()
+//	[x, y] := arr
+//	{name, age: n} := m
+//
+// With ":=", the variables already defined in the current block are
+// assigned, and at least one of them must be new.
+func (c *Compiler) compileDestructuring(
+	node parser.Node,
+	lhs []parser.Expr,
+	rhs parser.Expr,
+	op token.Token,
+) error {
+	if op != token.Assign && op != token.Define {
+		return c.errorf(node, "operator '%s' not allowed with destructuring",
+			op.String())
+	}
+
+	// check the variables before the right-hand side is compiled, but
+	// define them after it, so the right-hand side can refer to the
+	// variables being redefined, e.g. "[a, b] := [b, a]" in a new block.
+	if op == token.Define {
+		names := make(map[string]bool)
+		var hasNew bool
+		for _, expr := range lhs {
+			if err := c.checkDefine(expr, names, &hasNew); err != nil {
+				return err
+			}
+		}
+		if !hasNew {
+			return c.errorf(node, "no new variables on left side of :=")
+		}
+	}
+
+	if err := c.Compile(rhs); err != nil {
+		return err
+	}
+	if len(lhs) > 1 {
+		if len(lhs) > MaxReturnValues {
+			return c.errorf(node, "too many values to unpack")
+		}
+		c.emit(node, parser.OpUnpack, len(lhs))
+	}
+
+	// values are on the stack in order, so they are stored in reverse
+	for i := len(lhs) - 1; i >= 0; i-- {
+		if err := c.compilePattern(lhs[i], op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDefine checks the variables of a pattern defined by ":=".
+func (c *Compiler) checkDefine(
+	expr parser.Expr,
+	names map[string]bool,
+	hasNew *bool,
+) error {
+	switch expr := expr.(type) {
+	case *parser.ArrayLit:
+		for _, elem := range expr.Elements {
+			if err := c.checkDefine(elem, names, hasNew); err != nil {
+				return err
+			}
+		}
+	case *parser.MapLit:
+		for _, elt := range expr.Elements {
+			if err := c.checkDefine(elt.Value, names, hasNew); err != nil {
+				return err
+			}
+		}
+	case *parser.Ident:
+		if expr.Name == "_" {
+			return nil
+		}
+		if names[expr.Name] {
+			return c.errorf(expr, "'%s' repeated on left side of :=",
+				expr.Name)
+		}
+		names[expr.Name] = true
+		if _, depth, exists := c.symbolTable.Resolve(expr.Name,
+			false); !exists || depth > 0 {
+			*hasNew = true
+		}
+	case *parser.SelectorExpr, *parser.IndexExpr:
+		return c.errorf(expr, "operator ':=' not allowed with selector")
+	default:
+		return c.errorf(expr, "cannot assign to '%s'", expr.String())
+	}
+	return nil
+}
+
+// compilePattern stores the value on top of the stack to the variable, or
+// to the variables of an array or a map pattern.
+func (c *Compiler) compilePattern(expr parser.Expr, op token.Token) error {
+	switch expr := expr.(type) {
+	case *parser.ArrayLit:
+		for i := range expr.Elements {
+			c.emit(expr, parser.OpConstant,
+				c.addConstant(&Int{Value: int64(i)}))
+		}
+		c.emit(expr, parser.OpUnpackIndex, len(expr.Elements))
+		for i := len(expr.Elements) - 1; i >= 0; i-- {
+			if err := c.compilePattern(expr.Elements[i], op); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parser.MapLit:
+		for _, elt := range expr.Elements {
+			c.emit(elt, parser.OpConstant,
+				c.addConstant(&String{Value: elt.Key}))
+		}
+		c.emit(expr, parser.OpUnpackIndex, len(expr.Elements))
+		for i := len(expr.Elements) - 1; i >= 0; i-- {
+			err := c.compilePattern(expr.Elements[i].Value, op)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parser.Ident:
+		if expr.Name == "_" {
+			c.emit(expr, parser.OpPop)
+			return nil
+		}
+	case *parser.SelectorExpr, *parser.IndexExpr:
+	default:
+		return c.errorf(expr, "cannot assign to '%s'", expr.String())
+	}
+
+	ident, selectors := resolveAssignLHS(expr)
+	symbol, depth, exists := c.symbolTable.Resolve(ident, false)
+	if op == token.Define {
+		if !exists || depth > 0 {
+			symbol = c.symbolTable.Define(ident)
+		}
+	} else if !exists {
+		return c.errorf(expr, "unresolved reference '%s'", ident)
+	}
+	return c.compileStore(expr, symbol, selectors, op == token.Define)
+}
+
 func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 	// left side term
 	if err := c.Compile(node.LHS); err != nil {
@@ -784,9 +1153,12 @@ func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 
 	// jump position
 	var jumpPos int
-	if node.Token == token.LAnd {
+	switch node.Token {
+	case token.LAnd:
 		jumpPos = c.emit(node, parser.OpAndJump, 0)
-	} else {
+	case token.Coalesce:
+		jumpPos = c.emit(node, parser.OpCoalesceJump, 0)
+	default:
 		jumpPos = c.emit(node, parser.OpOrJump, 0)
 	}
 
@@ -799,6 +1171,235 @@ func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 	return nil
 }
 
+// compileFolded emits the value of the expression as a constant if the
+// expression can be evaluated at compile time. It returns false if the
+// expression has to be compiled as usual.
+func (c *Compiler) compileFolded(node parser.Expr) (bool, error) {
+	o, err := c.fold(node)
+	if err != nil || o == nil {
+		return false, err
+	}
+	switch o {
+	case TrueValue:
+		c.emit(node, parser.OpTrue)
+	case FalseValue:
+		c.emit(node, parser.OpFalse)
+	case UndefinedValue:
+		c.emit(node, parser.OpNull)
+	default:
+		c.emit(node, parser.OpConstant, c.addConstant(o))
+	}
+	return true, nil
+}
+
+// fold evaluates the expression at compile time if it consists of literals
+// only. It returns nil if the expression cannot be folded. The operators are
+// evaluated the same way as the VM does. Invalid operations are left to the
+// VM so they can be caught at run time, and so are int operations that
+// overflow so they follow the overflow check of the VM.
+func (c *Compiler) fold(node parser.Expr) (Object, error) {
+	switch node := node.(type) {
+	case *parser.IntLit:
+		return &Int{Value: node.Value}, nil
+	case *parser.BigIntLit:
+		return &BigInt{Value: node.Value}, nil
+	case *parser.FloatLit:
+		return &Float{Value: node.Value}, nil
+	case *parser.DecimalLit:
+		d, err := ParseDecimal(node.Value)
+		if err != nil {
+			return nil, c.error(node, err)
+		}
+		return d, nil
+	case *parser.CharLit:
+		return &Char{Value: node.Value}, nil
+	case *parser.BoolLit:
+		if node.Value {
+			return TrueValue, nil
+		}
+		return FalseValue, nil
+	case *parser.StringLit:
+		if len(node.Value) > MaxStringLen {
+			return nil, c.error(node, ErrStringLimit)
+		}
+		return &String{Value: node.Value}, nil
+	case *parser.UndefinedLit:
+		return UndefinedValue, nil
+	case *parser.ParenExpr:
+		return c.fold(node.Expr)
+	case *parser.UnaryExpr:
+		return c.foldUnary(node)
+	case *parser.BinaryExpr:
+		return c.foldBinary(node)
+	case *parser.CondExpr:
+		cond, err := c.fold(node.Cond)
+		if err != nil || cond == nil {
+			return nil, err
+		}
+		t, err := c.fold(node.True)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		f, err := c.fold(node.False)
+		if err != nil || f == nil {
+			return nil, err
+		}
+		if cond.IsFalsy() {
+			return f, nil
+		}
+		return t, nil
+	case *parser.ImmutableExpr:
+		return c.foldImmutable(node)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) foldUnary(node *parser.UnaryExpr) (Object, error) {
+	operand, err := c.fold(node.Expr)
+	if err != nil || operand == nil {
+		return nil, err
+	}
+	switch node.Token {
+	case token.Not:
+		if operand.IsFalsy() {
+			return TrueValue, nil
+		}
+		return FalseValue, nil
+	case token.Add:
+		return operand, nil
+	case token.Sub:
+		switch x := operand.(type) {
+		case *Int:
+			if x.Value == math.MinInt64 {
+				return nil, nil
+			}
+			return &Int{Value: -x.Value}, nil
+		case *Float:
+			return &Float{Value: -x.Value}, nil
+		case *BigInt:
+			return &BigInt{Value: new(big.Int).Neg(x.Value)}, nil
+		case *Decimal:
+			return &Decimal{
+				Value: new(big.Int).Neg(x.Value),
+				Scale: x.Scale,
+			}, nil
+		}
+	case token.Xor:
+		switch x := operand.(type) {
+		case *Int:
+			return &Int{Value: ^x.Value}, nil
+		case *BigInt:
+			return &BigInt{Value: new(big.Int).Not(x.Value)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Compiler) foldBinary(node *parser.BinaryExpr) (Object, error) {
+	left, err := c.fold(node.LHS)
+	if err != nil || left == nil {
+		return nil, err
+	}
+	right, err := c.fold(node.RHS)
+	if err != nil || right == nil {
+		return nil, err
+	}
+
+	switch node.Token {
+	case token.LAnd:
+		if left.IsFalsy() {
+			return left, nil
+		}
+		return right, nil
+	case token.LOr:
+		if left.IsFalsy() {
+			return right, nil
+		}
+		return left, nil
+	case token.Coalesce:
+		if left == UndefinedValue {
+			return right, nil
+		}
+		return left, nil
+	case token.Equal, token.NotEqual:
+		if left.Equals(right) == (node.Token == token.Equal) {
+			return TrueValue, nil
+		}
+		return FalseValue, nil
+	case token.In, token.NotIn:
+		var found bool
+		err := ErrInvalidOperator
+		if container, ok := right.(Container); ok {
+			found, err = container.Contains(left)
+		}
+		if err == ErrInvalidOperator {
+			return nil, nil
+		} else if err != nil {
+			return nil, c.error(node, err)
+		}
+		if found == (node.Token == token.In) {
+			return TrueValue, nil
+		}
+		return FalseValue, nil
+	}
+
+	res, err := left.BinaryOp(node.Token, right)
+	if err == ErrInvalidOperator {
+		return nil, nil
+	} else if err != nil {
+		return nil, c.error(node, err)
+	}
+	if intOverflows(left, node.Token, right, res) {
+		return nil, nil
+	}
+	if str, ok := res.(*String); ok && c.maxStringLen >= 0 &&
+		len(str.Value) > c.maxStringLen {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// foldImmutable folds an immutable array or map literal whose elements are
+// all constants.
+func (c *Compiler) foldImmutable(node *parser.ImmutableExpr) (Object, error) {
+	switch expr := node.Expr.(type) {
+	case *parser.ArrayLit:
+		elements := make([]Object, 0, len(expr.Elements))
+		for _, elem := range expr.Elements {
+			o, err := c.fold(elem)
+			if err != nil || o == nil {
+				return nil, err
+			}
+			elements = append(elements, o)
+		}
+		return &ImmutableArray{Value: elements}, nil
+	case *parser.MapLit:
+		kv := make(map[string]Object, len(expr.Elements))
+		for _, elt := range expr.Elements {
+			if !elt.ColonPos.IsValid() {
+				return nil, nil
+			}
+			if len(elt.Key) > MaxStringLen {
+				return nil, c.error(node, ErrStringLimit)
+			}
+			o, err := c.fold(elt.Value)
+			if err != nil || o == nil {
+				return nil, err
+			}
+			kv[elt.Key] = o
+		}
+		return &ImmutableMap{Value: kv}, nil
+	}
+	return c.fold(node.Expr)
+}
+
+// emitChainJump emits a jump to the end of the optional chain, taken if the
+// operand on top of the stack is undefined.
+func (c *Compiler) emitChainJump(node parser.Node) {
+	pos := c.emit(node, parser.OpChainJump, 0)
+	c.chainJumps = append(c.chainJumps, pos)
+}
+
 func (c *Compiler) compileForStmt(stmt *parser.ForStmt) error {
 	c.symbolTable = c.symbolTable.Fork(true)
 	defer func() {
@@ -975,6 +1576,328 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 	return nil
 }
 
+func (c *Compiler) compileSwitchStmt(stmt *parser.SwitchStmt) error {
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+
+	// switch statement is compiled into a comparison chain like following:
+	//
+	//   :tag := tag
+	//   if :tag == a || :tag == b {
+	//     ... case a, b ...
+	//   } else if :tag == c {
+	//     ... case c ...
+	//   } else {
+	//     ... default ...
+	//   }
+	//
+	// A case of a switch statement without tag is compiled as the condition
+	// of the if statement. ":tag" is a local variable but it will not
+	// conflict with other user variables because character ":" is not
+	// allowed in the variable names.
+	var tagSymbol *Symbol
+	if stmt.Tag != nil {
+		tagSymbol = c.symbolTable.Define(":tag")
+		if err := c.Compile(stmt.Tag); err != nil {
+			return err
+		}
+		if tagSymbol.Scope == ScopeGlobal {
+			c.emit(stmt, parser.OpSetGlobal, tagSymbol.Index)
+		} else {
+			tagSymbol.LocalAssigned = true
+			c.emit(stmt, parser.OpDefineLocal, tagSymbol.Index)
+		}
+	}
+
+	// enter loop; break in the cases leaves the switch statement
+	loop := c.enterLoop()
+	loop.Switch = true
+
+	var defaultClause *parser.CaseClause
+	var endJumps []int
+	for _, clause := range stmt.Body {
+		if clause.List == nil {
+			defaultClause = clause
+			continue
+		}
+
+		var bodyJumps []int
+		var nextJump int
+		for i, expr := range clause.List {
+			if tagSymbol != nil {
+				if tagSymbol.Scope == ScopeGlobal {
+					c.emit(expr, parser.OpGetGlobal, tagSymbol.Index)
+				} else {
+					c.emit(expr, parser.OpGetLocal, tagSymbol.Index)
+				}
+			}
+			if err := c.Compile(expr); err != nil {
+				c.leaveLoop()
+				return err
+			}
+			if tagSymbol != nil {
+				c.emit(expr, parser.OpEqual)
+			}
+			nextJump = c.emit(expr, parser.OpJumpFalsy, 0)
+			if i < len(clause.List)-1 {
+				bodyJumps = append(bodyJumps, c.emit(expr, parser.OpJump, 0))
+				c.changeOperand(nextJump, len(c.currentInstructions()))
+			}
+		}
+		for _, pos := range bodyJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+		if err := c.compileCaseBody(clause); err != nil {
+			c.leaveLoop()
+			return err
+		}
+		endJumps = append(endJumps, c.emit(clause, parser.OpJump, 0))
+		c.changeOperand(nextJump, len(c.currentInstructions()))
+	}
+	if defaultClause != nil {
+		if err := c.compileCaseBody(defaultClause); err != nil {
+			c.leaveLoop()
+			return err
+		}
+	}
+
+	c.leaveLoop()
+
+	// update all jump and break positions to the end of the statement
+	endPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, endPos)
+	}
+	for _, pos := range loop.Breaks {
+		c.changeOperand(pos, endPos)
+	}
+	return nil
+}
+
+func (c *Compiler) compileCaseBody(clause *parser.CaseClause) error {
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+
+	for _, stmt := range clause.Body {
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileTryStmt(stmt *parser.TryStmt) error {
+	// try statement is compiled like following:
+	//
+	//         TRY     finally 1    ; only if there's a finally block
+	//         TRY     catch   0    ; only if there's a catch block
+	//         ... body ...
+	//         TRYEND  1
+	//         JMP     endCatch
+	//   catch:                     ; error object is pushed by VM
+	//         SETL    e            ; or POP
+	//         ... catch block ...
+	//   endCatch:
+	//         TRYEND  1
+	//         ... finally block ...
+	//         JMP     end
+	//   finally:                   ; error is pushed by VM
+	//         ... finally block ...
+	//         THROW
+	//   end:
+	//
+	// The finally block is also compiled before return, break and continue
+	// statements that leave the try statement.
+	block := &tryBlock{
+		ScopeIndex: c.scopeIndex,
+		LoopIndex:  c.loopIndex,
+	}
+	var finallyPos, catchPos int
+	if stmt.Finally != nil {
+		finallyPos = c.emit(stmt, parser.OpTry, 0, 1)
+		block.Finally = stmt.Finally
+		block.Handlers++
+	}
+	if stmt.Catch != nil {
+		catchPos = c.emit(stmt, parser.OpTry, 0, 0)
+		block.Handlers++
+	}
+	c.tryBlocks = append(c.tryBlocks, block)
+
+	if err := c.Compile(stmt.Body); err != nil {
+		return err
+	}
+
+	if stmt.Catch != nil {
+		c.emit(stmt, parser.OpTryEnd, 1)
+		block.Handlers--
+		jumpPos := c.emit(stmt, parser.OpJump, 0)
+		c.changeOperand(catchPos, len(c.currentInstructions()), 0)
+		if err := c.compileCatch(stmt); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	c.tryBlocks = c.tryBlocks[:len(c.tryBlocks)-1]
+
+	if stmt.Finally != nil {
+		c.emit(stmt, parser.OpTryEnd, 1)
+		if err := c.Compile(stmt.Finally); err != nil {
+			return err
+		}
+		jumpPos := c.emit(stmt, parser.OpJump, 0)
+		c.changeOperand(finallyPos, len(c.currentInstructions()), 1)
+		if err := c.Compile(stmt.Finally); err != nil {
+			return err
+		}
+		c.emit(stmt, parser.OpThrow)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileCatch(stmt *parser.TryStmt) error {
+	if stmt.Ident == nil || stmt.Ident.Name == "_" {
+		c.emit(stmt, parser.OpPop)
+		return c.Compile(stmt.Catch)
+	}
+
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+
+	symbol := c.symbolTable.Define(stmt.Ident.Name)
+	if symbol.Scope == ScopeGlobal {
+		c.emit(stmt, parser.OpSetGlobal, symbol.Index)
+	} else {
+		symbol.LocalAssigned = true
+		c.emit(stmt, parser.OpDefineLocal, symbol.Index)
+	}
+	return c.Compile(stmt.Catch)
+}
+
+// compileCall compiles a call expression. A call in tail position is marked
+// so that the VM can reuse the frame of the current function for the callee.
+func (c *Compiler) compileCall(node *parser.CallExpr, tail bool) error {
+	if err := c.Compile(node.Func); err != nil {
+		return err
+	}
+	if node.Optional {
+		c.emitChainJump(node)
+	}
+	for _, arg := range node.Args {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+	flags := 0
+	if node.Ellipsis.IsValid() {
+		flags |= callSpread
+	}
+	if tail {
+		flags |= callTail
+	}
+	c.emit(node, parser.OpCall, len(node.Args), flags)
+	return nil
+}
+
+// inTryBlock returns true if the current position is inside a try statement
+// of the current function, including its catch block.
+func (c *Compiler) inTryBlock() bool {
+	n := len(c.tryBlocks)
+	return n > 0 && c.tryBlocks[n-1].ScopeIndex == c.scopeIndex
+}
+
+// leaveTryBlocks removes the handlers and compiles the finally blocks of the
+// try statements in the current function that the control leaves. Only the
+// try statements inside the loop at loopIndex are left, or all of them if
+// loopIndex is -1.
+func (c *Compiler) leaveTryBlocks(node parser.Node, loopIndex int) error {
+	for i := len(c.tryBlocks) - 1; i >= 0; i-- {
+		block := c.tryBlocks[i]
+		if block.ScopeIndex != c.scopeIndex || block.LoopIndex < loopIndex {
+			break
+		}
+		if block.Handlers > 0 {
+			c.emit(node, parser.OpTryEnd, block.Handlers)
+		}
+		if block.Finally != nil {
+			// the finally block runs outside of the try statement
+			tryBlocks := c.tryBlocks
+			c.tryBlocks = tryBlocks[:i]
+			err := c.Compile(block.Finally)
+			c.tryBlocks = tryBlocks
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileTypeStmt compiles a record type declaration, which defines a
+// variable holding a new record type.
+func (c *Compiler) compileTypeStmt(stmt *parser.TypeStmt) error {
+	name := stmt.Name.Name
+	if _, depth, exists := c.symbolTable.Resolve(name, false); exists &&
+		depth == 0 {
+		return c.errorf(stmt, "'%s' redeclared in this block", name)
+	}
+
+	c.emit(stmt, parser.OpConstant, c.addConstant(&String{Value: name}))
+	fields := make(map[string]bool)
+	for _, f := range stmt.Fields {
+		if fields[f.Name] {
+			return c.errorf(f, "duplicate field '%s'", f.Name)
+		}
+		fields[f.Name] = true
+		c.emit(f, parser.OpConstant, c.addConstant(&String{Value: f.Name}))
+	}
+	c.emit(stmt, parser.OpType, len(stmt.Fields))
+
+	symbol := c.symbolTable.Define(name)
+	return c.compileStore(stmt, symbol, nil, true)
+}
+
+// compileMethodStmt compiles a method declaration, which adds the function
+// to the methods of the receiver type. The receiver is passed to the
+// function as its first parameter.
+func (c *Compiler) compileMethodStmt(stmt *parser.MethodStmt) error {
+	if err := c.Compile(stmt.RecvType); err != nil {
+		return err
+	}
+	c.emit(stmt, parser.OpConstant,
+		c.addConstant(&String{Value: stmt.Name.Name}))
+
+	params := stmt.Type.Params
+	fn := &parser.FuncLit{
+		Type: &parser.FuncType{
+			FuncPos: stmt.Type.FuncPos,
+			Params: &parser.IdentList{
+				LParen:  params.LParen,
+				VarArgs: params.VarArgs,
+				List: append([]*parser.Ident{stmt.Recv},
+					params.List...),
+				RParen: params.RParen,
+			},
+		},
+		Body: stmt.Body,
+	}
+
+	// name the function after the type for the stack traces
+	c.funcName = stmt.RecvType.Name + "." + stmt.Name.Name
+	if err := c.Compile(fn); err != nil {
+		return err
+	}
+	c.emit(stmt, parser.OpMethod)
+	return nil
+}
+
 func (c *Compiler) checkCyclicImports(
 	node parser.Node,
 	modulePath string,
@@ -1026,6 +1949,7 @@ func (c *Compiler) compileModule(
 
 	// code optimization
 	moduleCompiler.optimizeFunc(node)
+	moduleCompiler.fuseInstructions()
 	compiledFunc := moduleCompiler.Bytecode().MainFunction
 	compiledFunc.NumLocals = symbolTable.MaxSymbols()
 	c.storeCompiledModule(modulePath, compiledFunc)
@@ -1125,6 +2049,8 @@ func (c *Compiler) fork(
 	child.allowFileImport = c.allowFileImport
 	child.importDir = c.importDir
 	child.importFileExt = c.importFileExt
+	child.maxStringLen = c.maxStringLen
+	child.peephole = c.peephole
 	if isFile && c.importDir != "" {
 		child.importDir = filepath.Dir(modulePath)
 	}
@@ -1199,7 +2125,8 @@ func (c *Compiler) optimizeFunc(node parser.Node) {
 		func(pos int, opcode parser.Opcode, operands []int) bool {
 			switch opcode {
 			case parser.OpJump, parser.OpJumpFalsy,
-				parser.OpAndJump, parser.OpOrJump:
+				parser.OpAndJump, parser.OpOrJump, parser.OpTry,
+				parser.OpChainJump, parser.OpCoalesceJump:
 				dsts[operands[0]] = true
 			}
 			return true
@@ -1240,11 +2167,13 @@ func (c *Compiler) optimizeFunc(node parser.Node) {
 		func(pos int, opcode parser.Opcode, operands []int) bool {
 			switch opcode {
 			case parser.OpJump, parser.OpJumpFalsy, parser.OpAndJump,
-				parser.OpOrJump:
+				parser.OpOrJump, parser.OpTry, parser.OpChainJump,
+				parser.OpCoalesceJump:
 				newDst, ok := posMap[operands[0]]
 				if ok {
+					operands[0] = newDst
 					copy(newInsts[pos:],
-						MakeInstruction(opcode, newDst))
+						MakeInstruction(opcode, operands...))
 				} else if endPos == operands[0] {
 					// there's a jump instruction that jumps to the end of
 					// function compiler should append "return".
@@ -1279,6 +2208,103 @@ func (c *Compiler) optimizeFunc(node parser.Node) {
 	}
 }
 
+// fuseInstructions replaces common instruction sequences of the current
+// function with single instructions, if the peephole optimization is enabled.
+// A sequence is not fused if any of its instructions but the first one is a
+// jump destination.
+func (c *Compiler) fuseInstructions() {
+	if !c.peephole {
+		return
+	}
+
+	type instruction struct {
+		pos      int
+		opcode   parser.Opcode
+		operands []int
+	}
+
+	// pass 1. decode instructions and identify all jump destinations
+	var insts []instruction
+	dsts := make(map[int]bool)
+	iterateInstructions(c.scopes[c.scopeIndex].Instructions,
+		func(pos int, opcode parser.Opcode, operands []int) bool {
+			insts = append(insts, instruction{pos, opcode, operands})
+			switch opcode {
+			case parser.OpJump, parser.OpJumpFalsy,
+				parser.OpAndJump, parser.OpOrJump, parser.OpTry,
+				parser.OpChainJump, parser.OpCoalesceJump:
+				dsts[operands[0]] = true
+			}
+			return true
+		})
+	match := func(i int, opcodes ...parser.Opcode) bool {
+		if i+len(opcodes) > len(insts) {
+			return false
+		}
+		for j, opcode := range opcodes {
+			if insts[i+j].opcode != opcode || j > 0 && dsts[insts[i+j].pos] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// pass 2. fuse instructions
+	var newInsts []byte
+	posMap := make(map[int]int) // old position to new position
+	sourceMap := c.scopes[c.scopeIndex].SourceMap
+	newSourceMap := make(map[int]parser.Pos)
+	for i := 0; i < len(insts); {
+		in := insts[i]
+		n, srcPos := 1, in.pos
+		inst := MakeInstruction(in.opcode, in.operands...)
+		switch {
+		case match(i, parser.OpGetLocal, parser.OpConstant,
+			parser.OpBinaryOp, parser.OpSetLocal) &&
+			in.operands[0] == insts[i+3].operands[0]:
+			// x = x op constant
+			n, srcPos = 4, insts[i+2].pos
+			inst = MakeInstruction(parser.OpAssignLocal, in.operands[0],
+				insts[i+1].operands[0], insts[i+2].operands[0])
+		case match(i, parser.OpGetLocal, parser.OpGetLocal, parser.OpIndex):
+			n, srcPos = 3, insts[i+2].pos
+			inst = MakeInstruction(parser.OpIndexLocals, in.operands[0],
+				insts[i+1].operands[0])
+		case match(i, parser.OpConstant, parser.OpReturn) &&
+			insts[i+1].operands[0] == 1:
+			n, srcPos = 2, insts[i+1].pos
+			inst = MakeInstruction(parser.OpReturnConst, in.operands[0])
+		}
+		posMap[in.pos] = len(newInsts)
+		if p, ok := sourceMap[srcPos]; ok {
+			newSourceMap[len(newInsts)] = p
+		}
+		newInsts = append(newInsts, inst...)
+		i += n
+	}
+	posMap[len(c.scopes[c.scopeIndex].Instructions)] = len(newInsts)
+
+	// pass 3. update jump positions
+	iterateInstructions(newInsts,
+		func(pos int, opcode parser.Opcode, operands []int) bool {
+			switch opcode {
+			case parser.OpJump, parser.OpJumpFalsy, parser.OpAndJump,
+				parser.OpOrJump, parser.OpTry, parser.OpChainJump,
+				parser.OpCoalesceJump:
+				newDst, ok := posMap[operands[0]]
+				if !ok {
+					panic(fmt.Errorf("invalid jump position: %d",
+						operands[0]))
+				}
+				operands[0] = newDst
+				copy(newInsts[pos:], MakeInstruction(opcode, operands...))
+			}
+			return true
+		})
+	c.scopes[c.scopeIndex].Instructions = newInsts
+	c.scopes[c.scopeIndex].SourceMap = newSourceMap
+}
+
 func (c *Compiler) emit(
 	node parser.Node,
 	opcode parser.Opcode,
@@ -1337,6 +2363,21 @@ func (c *Compiler) getPathModule(moduleName string) (pathFile string, err error)
 	return "", fmt.Errorf("module '%s' not found at: %s", moduleName, pathFile)
 }
 
+// tailCall returns the call expression of a return statement returning the
+// result of a single call.
+func tailCall(stmt *parser.ReturnStmt) (*parser.CallExpr, bool) {
+	call, ok := stmt.Result.(*parser.CallExpr)
+	return call, ok
+}
+
+func isPattern(expr parser.Expr) bool {
+	switch expr.(type) {
+	case *parser.ArrayLit, *parser.MapLit:
+		return true
+	}
+	return false
+}
+
 func resolveAssignLHS(
 	expr parser.Expr,
 ) (name string, selectors []parser.Expr) {
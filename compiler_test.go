@@ -15,11 +15,15 @@ import (
 )
 
 func TestCompiler_Compile(t *testing.T) {
-	expectCompile(t, `1 + 2`,
+	expectCompile(t, `a := 1; b := 2; a + b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -39,11 +43,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 - 2`,
+	expectCompile(t, `a := 1; b := 2; a - b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 12),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -51,11 +59,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 * 2`,
+	expectCompile(t, `a := 1; b := 2; a * b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -63,11 +75,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `2 / 1`,
+	expectCompile(t, `a := 2; b := 1; a / b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 14),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -91,11 +107,15 @@ func TestCompiler_Compile(t *testing.T) {
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray()))
 
-	expectCompile(t, `1 > 2`,
+	expectCompile(t, `a := 1; b := 2; a > b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 39),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -103,11 +123,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 < 2`,
+	expectCompile(t, `a := 1; b := 2; a < b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 38),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -115,11 +139,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 >= 2`,
+	expectCompile(t, `a := 1; b := 2; a >= b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 44),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -127,11 +155,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 <= 2`,
+	expectCompile(t, `a := 1; b := 2; a <= b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 43),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -139,11 +171,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 == 2`,
+	expectCompile(t, `a := 1; b := 2; a == b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpEqual),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -151,11 +187,15 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `1 != 2`,
+	expectCompile(t, `a := 1; b := 2; a != b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpNotEqual),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -163,40 +203,77 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `true == false`,
+	expectCompile(t, `a := true; b := false; a == b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpFalse),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpEqual),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray()))
 
-	expectCompile(t, `true != false`,
+	expectCompile(t, `a := true; b := false; a != b`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpFalse),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 1),
 				tengo.MakeInstruction(parser.OpNotEqual),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray()))
 
-	expectCompile(t, `-1`,
+	expectCompile(t, `1 in "a"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpContains),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject("a"))))
+
+	expectCompile(t, `1 not in "a"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpContains),
+				tengo.MakeInstruction(parser.OpLNot),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject("a"))))
+
+	expectCompile(t, `a := 1; -a`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpMinus),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
 				intObject(1))))
 
-	expectCompile(t, `!true`,
+	expectCompile(t, `a := true; !a`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpLNot),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -243,10 +320,12 @@ func TestCompiler_Compile(t *testing.T) {
 			objectsArray(
 				stringObject("kami"))))
 
-	expectCompile(t, `"ka" + "mi"`,
+	expectCompile(t, `a := "ka"; a + "mi"`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpPop),
@@ -309,17 +388,19 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(2),
 				intObject(3))))
 
-	expectCompile(t, `[1 + 2, 3 - 4, 5 * 6]`,
+	expectCompile(t, `a := 1; [a + 2, a - 4, a * 6]`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 2),
-				tengo.MakeInstruction(parser.OpConstant, 3),
 				tengo.MakeInstruction(parser.OpBinaryOp, 12),
-				tengo.MakeInstruction(parser.OpConstant, 4),
-				tengo.MakeInstruction(parser.OpConstant, 5),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 3),
 				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpArray, 3),
 				tengo.MakeInstruction(parser.OpPop),
@@ -327,11 +408,38 @@ func TestCompiler_Compile(t *testing.T) {
 			objectsArray(
 				intObject(1),
 				intObject(2),
-				intObject(3),
 				intObject(4),
-				intObject(5),
 				intObject(6))))
 
+	expectCompile(t, `[[1]..., 2]`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpArray, 1),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpArray, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	expectCompile(t, `{{}..., a: 1}`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpNull),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpMap, 4),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("a"),
+				intObject(1))))
+
 	expectCompile(t, `{}`,
 		bytecode(
 			concatInsts(
@@ -360,36 +468,39 @@ func TestCompiler_Compile(t *testing.T) {
 				stringObject("c"),
 				intObject(6))))
 
-	expectCompile(t, `{a: 2 + 3, b: 5 * 6}`,
+	expectCompile(t, `x := 2; {a: x + 3, b: x * 6}`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 4),
-				tengo.MakeInstruction(parser.OpConstant, 5),
 				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpMap, 4),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				stringObject("a"),
 				intObject(2),
+				stringObject("a"),
 				intObject(3),
 				stringObject("b"),
-				intObject(5),
 				intObject(6))))
 
-	expectCompile(t, `[1, 2, 3][1 + 1]`,
+	expectCompile(t, `a := 1; [1, 2, 3][a + 1]`,
 		bytecode(
 			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpArray, 3),
-				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpIndex),
@@ -400,21 +511,23 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(2),
 				intObject(3))))
 
-	expectCompile(t, `{a: 2}[2 - 1]`,
+	expectCompile(t, `b := 2; {a: 2}[b - 1]`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpMap, 2),
-				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpBinaryOp, 12),
 				tengo.MakeInstruction(parser.OpIndex),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				stringObject("a"),
 				intObject(2),
+				stringObject("a"),
 				intObject(1))))
 
 	expectCompile(t, `[1, 2, 3][:]`,
@@ -506,33 +619,31 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
-	expectCompile(t, `func() { return 5 + 10 }`,
+	expectCompile(t, `func(a) { return a + 10 }`,
 		bytecode(
 			concatInsts(
-				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(5),
 				intObject(10),
-				compiledFunction(0, 0,
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
 					tengo.MakeInstruction(parser.OpConstant, 0),
-					tengo.MakeInstruction(parser.OpConstant, 1),
 					tengo.MakeInstruction(parser.OpBinaryOp, 11),
 					tengo.MakeInstruction(parser.OpReturn, 1)))))
 
-	expectCompile(t, `func() { 5 + 10 }`,
+	expectCompile(t, `func(a) { a + 10 }`,
 		bytecode(
 			concatInsts(
-				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(5),
 				intObject(10),
-				compiledFunction(0, 0,
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
 					tengo.MakeInstruction(parser.OpConstant, 0),
-					tengo.MakeInstruction(parser.OpConstant, 1),
 					tengo.MakeInstruction(parser.OpBinaryOp, 11),
 					tengo.MakeInstruction(parser.OpPop),
 					tengo.MakeInstruction(parser.OpReturn, 0)))))
@@ -820,7 +931,23 @@ func TestCompiler_Compile(t *testing.T) {
 				compiledFunction(0, 0,
 					tengo.MakeInstruction(parser.OpGetBuiltin, 0),
 					tengo.MakeInstruction(parser.OpArray, 0),
-					tengo.MakeInstruction(parser.OpCall, 1, 0),
+					tengo.MakeInstruction(parser.OpCall, 1, 2),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	expectCompile(t, `func(f, a) { f(); return f(a...) }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				compiledFunction(2, 2,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpCall, 0, 0),
+					tengo.MakeInstruction(parser.OpPop),
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpGetLocal, 1),
+					tengo.MakeInstruction(parser.OpCall, 1, 3),
 					tengo.MakeInstruction(parser.OpReturn, 1)))))
 
 	expectCompile(t, `func(a) { func(b) { return a + b } }`,
@@ -1016,94 +1143,306 @@ r["x"] = {
 	fn := fn()
 })()
 `, "unresolved reference 'fn")
-}
-
-func TestCompilerErrorReport(t *testing.T) {
-	expectCompileError(t, `import("user1")`,
-		"Compile Error: module 'user1' not found\n\tat test:1:1")
-
-	expectCompileError(t, `a = 1`,
-		"Compile Error: unresolved reference 'a'\n\tat test:1:1")
-	expectCompileError(t, `a := a`,
-		"Compile Error: unresolved reference 'a'\n\tat test:1:6")
-	expectCompileError(t, `a, b := 1, 2`,
-		"Compile Error: tuple assignment not allowed\n\tat test:1:1")
-	expectCompileError(t, `a.b := 1`,
-		"not allowed with selector")
-	expectCompileError(t, `a:=1; a:=3`,
-		"Compile Error: 'a' redeclared in this block\n\tat test:1:7")
-
-	expectCompileError(t, `return 5`,
-		"Compile Error: return not allowed outside function\n\tat test:1:1")
-	expectCompileError(t, `func() { break }`,
-		"Compile Error: break not allowed outside loop\n\tat test:1:10")
-	expectCompileError(t, `func() { continue }`,
-		"Compile Error: continue not allowed outside loop\n\tat test:1:10")
-	expectCompileError(t, `func() { export 5 }`,
-		"Compile Error: export not allowed inside function\n\tat test:1:10")
-}
 
-func TestCompilerDeadCode(t *testing.T) {
-	expectCompile(t, `
-func() {
-	a := 4
-	return a
+	expectCompile(t, `try { 1 } catch e { 2 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpTry, 17, 0),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpTryEnd, 1),
+				tengo.MakeInstruction(parser.OpJump, 24),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2))))
 
-	b := 5 // dead code from here
-	c := a
-	return b
-}`,
+	expectCompile(t, `func() { try { return 1 } finally { 2 } }`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(4),
-				intObject(5),
+				intObject(1),
+				intObject(2),
 				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpTry, 17, 1),
 					tengo.MakeInstruction(parser.OpConstant, 0),
-					tengo.MakeInstruction(parser.OpDefineLocal, 0),
-					tengo.MakeInstruction(parser.OpGetLocal, 0),
-					tengo.MakeInstruction(parser.OpReturn, 1)))))
+					tengo.MakeInstruction(parser.OpTryEnd, 1),
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpPop),
+					tengo.MakeInstruction(parser.OpReturn, 1),
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpPop),
+					tengo.MakeInstruction(parser.OpThrow),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
 
-	expectCompile(t, `
-func() {
-	if true {
-		return 5
-		a := 4  // dead code from here
-		b := a
-		return b
-	} else {
-		return 4
-		c := 5  // dead code from here
-		d := c
-		return d
-	}
-}`, bytecode(
-		concatInsts(
-			tengo.MakeInstruction(parser.OpConstant, 2),
-			tengo.MakeInstruction(parser.OpPop),
-			tengo.MakeInstruction(parser.OpSuspend)),
-		objectsArray(
-			intObject(5),
-			intObject(4),
-			compiledFunction(0, 0,
-				tengo.MakeInstruction(parser.OpTrue),
-				tengo.MakeInstruction(parser.OpJumpFalsy, 11),
+	expectCompile(t, `switch 1 { case 2: 3; default: 4 }`,
+		bytecode(
+			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpReturn, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpReturn, 1)))))
-
-	expectCompile(t, `
-func() {
-	a := 1
-	for {
-		if a == 5 {
+				tengo.MakeInstruction(parser.OpEqual),
+				tengo.MakeInstruction(parser.OpJumpFalsy, 27),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpJump, 31),
+				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				intObject(3),
+				intObject(4))))
+
+	expectCompile(t, `a := 1; "${a}, ${a + 2}!"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpConcat, 4),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject(", "),
+				intObject(2),
+				stringObject("!"))))
+
+	expectCompile(t, `func() { defer len([1]...) }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpGetBuiltin, 0),
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpArray, 1),
+					tengo.MakeInstruction(parser.OpDefer, 1, 1),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
+
+	expectCompile(t, `func() { return 1, 2 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpReturn, 2)))))
+
+	expectCompile(t, `x := {}; a, {b, c: _} := x`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpUnpack, 2),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpUnpackIndex, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 2),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("b"),
+				stringObject("c"))))
+
+	expectCompile(t, `a := {}; a?.b ?? 1`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpChainJump, 18),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpIndex),
+				tengo.MakeInstruction(parser.OpCoalesceJump, 26),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("b"),
+				intObject(1))))
+
+	expectCompile(t, `func(a) { yield a; yield }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				generatorFunction(1, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpYield),
+					tengo.MakeInstruction(parser.OpNull),
+					tengo.MakeInstruction(parser.OpYield),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
+
+	expectCompile(t, `type P { x, y }; func (p P) f(a) { return p.x }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpType, 2),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpConstant, 4),
+				tengo.MakeInstruction(parser.OpMethod),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("P"),
+				stringObject("x"),
+				stringObject("y"),
+				stringObject("f"),
+				compiledFunction(2, 2,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpIndex),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	expectCompileError(t, `type P { x, x }`, "duplicate field 'x'")
+	expectCompileError(t, `a := 1; type a {}`, "'a' redeclared in this block")
+	expectCompileError(t, `func (p P) f() {}`, "unresolved reference 'P'")
+}
+
+func TestCompilerErrorReport(t *testing.T) {
+	expectCompileError(t, `import("user1")`,
+		"Compile Error: module 'user1' not found\n\tat test:1:1")
+
+	expectCompileError(t, `a = 1`,
+		"Compile Error: unresolved reference 'a'\n\tat test:1:1")
+	expectCompileError(t, `a := a`,
+		"Compile Error: unresolved reference 'a'\n\tat test:1:6")
+	expectCompileError(t, `a, b := 1, 2`,
+		"Compile Error: tuple assignment not allowed\n\tat test:1:1")
+	expectCompileError(t, `a.b := 1`,
+		"not allowed with selector")
+	expectCompileError(t, `a := 1; a, _ := [1, 2]`,
+		"Compile Error: no new variables on left side of :=\n\tat test:1:9")
+	expectCompileError(t, `a, a := [1, 2]`,
+		"Compile Error: 'a' repeated on left side of :=\n\tat test:1:4")
+	expectCompileError(t, `a := {}; a.b, c := [1, 2]`,
+		"Compile Error: operator ':=' not allowed with selector\n\tat test:1:10")
+	expectCompileError(t, `[a, 1] := [1, 2]`,
+		"Compile Error: cannot assign to '1'\n\tat test:1:5")
+	expectCompileError(t, `a, b = [1, 2]`,
+		"Compile Error: unresolved reference 'b'\n\tat test:1:4")
+	expectCompileError(t, `a := 1; [a] += [1]`,
+		"Compile Error: operator '+=' not allowed with destructuring\n"+
+			"\tat test:1:9")
+	expectCompileError(t, `a := {}; a?.b = 1`,
+		"Compile Error: cannot assign to 'a?.b'\n\tat test:1:10")
+	expectCompileError(t, `[a...] := [1, 2]`,
+		"Compile Error: cannot assign to 'a...'\n\tat test:1:2")
+	expectCompileError(t, `a := {}; {a...} = {}`,
+		"Compile Error: cannot assign to 'a...'\n\tat test:1:11")
+	expectCompileError(t, `a := 1; b := {a}`,
+		"Compile Error: missing value for map key 'a'\n\tat test:1:15")
+	expectCompileError(t, `func() { return `+strings.Repeat("1, ", 256)+`1 }`,
+		"Compile Error: too many return values")
+	expectCompileError(t, `a:=1; a:=3`,
+		"Compile Error: 'a' redeclared in this block\n\tat test:1:7")
+
+	expectCompileError(t, `return 5`,
+		"Compile Error: return not allowed outside function\n\tat test:1:1")
+	expectCompileError(t, `yield 5`,
+		"Compile Error: yield not allowed outside function\n\tat test:1:1")
+	expectCompileError(t, `func() { return 1; yield 2 }`,
+		"Compile Error: return with values not allowed in generator\n"+
+			"\tat test:1:10")
+	expectCompileError(t, `func() { break }`,
+		"Compile Error: break not allowed outside loop\n\tat test:1:10")
+	expectCompileError(t, `func() { continue }`,
+		"Compile Error: continue not allowed outside loop\n\tat test:1:10")
+	expectCompileError(t, `func() { export 5 }`,
+		"Compile Error: export not allowed inside function\n\tat test:1:10")
+}
+
+func TestCompilerDeadCode(t *testing.T) {
+	expectCompile(t, `
+func() {
+	a := 4
+	return a
+
+	b := 5 // dead code from here
+	c := a
+	return b
+}`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(4),
+				intObject(5),
+				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpDefineLocal, 0),
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	expectCompile(t, `
+func() {
+	if true {
+		return 5
+		a := 4  // dead code from here
+		b := a
+		return b
+	} else {
+		return 4
+		c := 5  // dead code from here
+		d := c
+		return d
+	}
+}`, bytecode(
+		concatInsts(
+			tengo.MakeInstruction(parser.OpConstant, 2),
+			tengo.MakeInstruction(parser.OpPop),
+			tengo.MakeInstruction(parser.OpSuspend)),
+		objectsArray(
+			intObject(5),
+			intObject(4),
+			compiledFunction(0, 0,
+				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpJumpFalsy, 11),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpReturn, 1),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	expectCompile(t, `
+func() {
+	a := 1
+	for {
+		if a == 5 {
 			return 10
 		}
-		5 + 5
+		a + 5
 		return 20
 		b := a
 		return b
@@ -1127,7 +1466,7 @@ func() {
 				tengo.MakeInstruction(parser.OpJumpFalsy, 21),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpReturn, 1),
-				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpGetLocal, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpPop),
@@ -1188,6 +1527,321 @@ func() {
 				tengo.MakeInstruction(parser.OpReturn, 1)))))
 }
 
+func TestCompilerConstantFolding(t *testing.T) {
+	expectCompile(t, `1 + 2`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(3))))
+
+	expectCompile(t, `1 - 2`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(-1))))
+
+	expectCompile(t, `1 > 2`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpFalse),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+
+	expectCompile(t, `1 == 2`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpFalse),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+
+	expectCompile(t, `true != false`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+
+	expectCompile(t, `-1`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(-1))))
+
+	expectCompile(t, `!true`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpFalse),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+
+	expectCompile(t, `"ka" + "mi"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("kami"))))
+
+	expectCompile(t, `[1 + 2, 3 - 4, 5 * 6]`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpArray, 3),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(3),
+				intObject(-1),
+				intObject(30))))
+
+	expectCompile(t, `{a: 2 + 3, b: 5 * 6}`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpMap, 4),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("a"),
+				intObject(5),
+				stringObject("b"),
+				intObject(30))))
+
+	expectCompile(t, `[1, 2, 3][1 + 1]`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpArray, 3),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpIndex),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				intObject(3))))
+
+	expectCompile(t, `func() { return 5 + 10 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(15),
+				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	expectCompile(t, `60 * 60 * 24`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(86400))))
+
+	expectCompile(t, `a := 1; a + 2 * 3`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(6))))
+
+	expectCompile(t, `(1 < 2 && !false) ? "a" + "b" : "c"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("ab"))))
+
+	expectCompile(t, `undefined ?? -(2 - 5)`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(3))))
+
+	expectCompile(t, `"b" in "abc"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+
+	expectCompile(t, `immutable([1, 2 + 3, immutable({a: "b"})])`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				&tengo.ImmutableArray{Value: []tengo.Object{
+					intObject(1),
+					intObject(5),
+					&tengo.ImmutableMap{Value: map[string]tengo.Object{
+						"a": stringObject("b"),
+					}},
+				}})))
+
+	// mutable values are not folded
+	expectCompile(t, `immutable([[1]])`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpArray, 1),
+				tengo.MakeInstruction(parser.OpArray, 1),
+				tengo.MakeInstruction(parser.OpImmutable),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1))))
+
+	// invalid operations and int overflows are left to the VM
+	expectCompile(t, `1 + "a"`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject("a"))))
+	expectCompile(t, `9223372036854775807 + 1`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(9223372036854775807),
+				intObject(1))))
+
+	expectCompileError(t, `1 / 0`,
+		"Compile Error: division by zero\n\tat test:1:1")
+	expectCompileError(t, `a := 1; b := a + (10 % (2 - 2))`,
+		"Compile Error: division by zero\n\tat test:1:19")
+	expectCompileError(t, `a := 1.5d / 0`,
+		"Compile Error: division by zero\n\tat test:1:6")
+}
+
+func TestCompilerPeephole(t *testing.T) {
+	expectPeephole(t, `func(a) { a++; return 1 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpAssignLocal, 0, 0, 11),
+					tengo.MakeInstruction(parser.OpReturnConst, 0)))))
+
+	expectPeephole(t, `func(a, b) { return a[b] }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				compiledFunction(2, 2,
+					tengo.MakeInstruction(parser.OpIndexLocals, 0, 1),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	// jump positions are updated
+	expectPeephole(t, `func(a) { for a < 10 { a += 2 }; return a }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(10),
+				intObject(2),
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpBinaryOp, 38),
+					tengo.MakeInstruction(parser.OpJumpFalsy, 22),
+					tengo.MakeInstruction(parser.OpAssignLocal, 0, 1, 11),
+					tengo.MakeInstruction(parser.OpJump, 0),
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	// a jump destination inside a sequence prevents the fusion
+	expectPeephole(t, `func(a) { return a ? 1 : 2 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				compiledFunction(1, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpJumpFalsy, 15),
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpJump, 18),
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	// different locals are not fused
+	expectPeephole(t, `func(a, b) { b = a + 1 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				compiledFunction(2, 2,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpBinaryOp, 11),
+					tengo.MakeInstruction(parser.OpSetLocal, 1),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
+}
+
 func TestCompilerScopes(t *testing.T) {
 	expectCompile(t, `
 if a := 1; a {
@@ -1871,7 +2525,28 @@ func expectCompile(
 	input string,
 	expected *tengo.Bytecode,
 ) {
-	actual, trace, err := traceCompile(input, nil)
+	actual, trace, err := traceCompile(input, nil, false)
+
+	var ok bool
+	defer func() {
+		if !ok {
+			for _, tr := range trace {
+				t.Log(tr)
+			}
+		}
+	}()
+
+	require.NoError(t, err)
+	equalBytecode(t, expected, actual)
+	ok = true
+}
+
+func expectPeephole(
+	t *testing.T,
+	input string,
+	expected *tengo.Bytecode,
+) {
+	actual, trace, err := traceCompile(input, nil, true)
 
 	var ok bool
 	defer func() {
@@ -1888,7 +2563,7 @@ func expectCompile(
 }
 
 func expectCompileError(t *testing.T, input, expected string) {
-	_, trace, err := traceCompile(input, nil)
+	_, trace, err := traceCompile(input, nil, false)
 
 	var ok bool
 	defer func() {
@@ -1929,6 +2604,7 @@ func (o *compileTracer) Write(p []byte) (n int, err error) {
 func traceCompile(
 	input string,
 	symbols map[string]tengo.Object,
+	peephole bool,
 ) (res *tengo.Bytecode, trace []string, err error) {
 	fileSet := parser.NewFileSet()
 	file := fileSet.AddFile("test", -1, len(input))
@@ -1945,6 +2621,7 @@ func traceCompile(
 
 	tr := &compileTracer{}
 	c := tengo.NewCompiler(file, symTable, nil, nil, tr)
+	c.EnablePeephole(peephole)
 	parsed, err := p.ParseFile()
 	if err != nil {
 		return
@@ -1989,3 +2666,12 @@ func compiledFunction(
 		NumParameters: numParams,
 	}
 }
+
+func generatorFunction(
+	numLocals, numParams int,
+	insts ...[]byte,
+) *tengo.CompiledFunction {
+	fn := compiledFunction(numLocals, numParams, insts...)
+	fn.Generator = true
+	return fn
+}
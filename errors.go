@@ -3,15 +3,28 @@ package tengo
 import (
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/d5/tengo/v2/parser"
 )
 
 var (
 	// ErrStackOverflow is a stack overflow error.
 	ErrStackOverflow = errors.New("stack overflow")
 
+	// ErrVMAborted is an error where the VM was aborted while running a
+	// function called from Go.
+	ErrVMAborted = errors.New("virtual machine aborted")
+
 	// ErrObjectAllocLimit is an objects allocation limit error.
 	ErrObjectAllocLimit = errors.New("object allocation limit exceeded")
 
+	// ErrInstructionLimit is an instruction execution limit error.
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+	// ErrMemoryLimit is a memory allocation limit error.
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+
 	// ErrIndexOutOfBounds is an error where a given index is out of the
 	// bounds.
 	ErrIndexOutOfBounds = errors.New("index out of bounds")
@@ -39,6 +52,10 @@ var (
 	// exceeds the limit.
 	ErrStringLimit = errors.New("exceeding string size limit")
 
+	// ErrNotHashable is an error where an Object cannot be used as a set
+	// element.
+	ErrNotHashable = errors.New("not hashable")
+
 	// ErrNotIndexable is an error where an Object is not indexable.
 	ErrNotIndexable = errors.New("not indexable")
 
@@ -50,6 +67,13 @@ var (
 	// required method.
 	ErrNotImplemented = errors.New("not implemented")
 
+	// ErrDivisionByZero is an error where a number is divided by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+
+	// ErrIntOverflow is an error where the result of an int operation
+	// overflows when the overflow check is enabled.
+	ErrIntOverflow = errors.New("integer overflow")
+
 	// ErrInvalidRangeStep is an error where the step parameter is less than or equal to 0 when using builtin range function.
 	ErrInvalidRangeStep = errors.New("range step must be greater than 0")
 )
@@ -65,3 +89,45 @@ func (e ErrInvalidArgumentType) Error() string {
 	return fmt.Sprintf("invalid type for argument '%s': expected %s, found %s",
 		e.Name, e.Expected, e.Found)
 }
+
+// RuntimeError represents an error that occurred while running the script.
+// It holds the call frames at the time of the error, innermost first.
+type RuntimeError struct {
+	Err    error
+	Frames []StackFrame
+}
+
+// StackFrame represents a call frame of a RuntimeError.
+type StackFrame struct {
+	Name string               // function name, if known
+	Pos  parser.SourceFilePos // source position of the instruction
+	Line string               // source line of the position, if available
+	IP   int                  // instruction pointer
+}
+
+func (e *RuntimeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("Runtime Error: ")
+	sb.WriteString(e.Err.Error())
+	for _, f := range e.Frames {
+		sb.WriteString("\n\tat ")
+		sb.WriteString(f.Pos.String())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Pos returns the source position where the error occurred. It returns an
+// invalid position if the position is unknown.
+func (e *RuntimeError) Pos() parser.SourceFilePos {
+	for _, f := range e.Frames {
+		if f.Pos.IsValid() {
+			return f.Pos
+		}
+	}
+	return parser.SourceFilePos{}
+}
@@ -81,18 +81,18 @@ func (f *formatter) writePadding(n int) {
 	if n <= 0 { // No padding bytes needed.
 		return
 	}
-	buf := *f.buf
+	buf := f.buf.b
 	oldLen := len(buf)
 	newLen := oldLen + n
 
-	if newLen > MaxStringLen {
-		panic(ErrStringLimit)
+	if newLen > f.buf.max {
+		panic(f.buf.err)
 	}
 
 	// Make enough room for padding.
 	if newLen > cap(buf) {
-		buf = make(fmtbuf, cap(buf)*2+n)
-		copy(buf, *f.buf)
+		buf = make([]byte, cap(buf)*2+n)
+		copy(buf, f.buf.b)
 	}
 	// Decide which byte the padding should be filled with.
 	padByte := byte(' ')
@@ -104,7 +104,7 @@ func (f *formatter) writePadding(n int) {
 	for i := range padding {
 		padding[i] = padByte
 	}
-	*f.buf = buf[:newLen]
+	f.buf.b = buf[:newLen]
 }
 
 // pad appends b to f.buf, padded on left (!f.minus) or right (f.minus).
@@ -434,7 +434,10 @@ func (f *formatter) fmtSbx(s string, b []byte, digits string) {
 		f.writePadding(f.wid - width)
 	}
 	// Write the encoding directly into the output fmtbuf.
-	buf := *f.buf
+	if len(f.buf.b)+width > f.buf.max {
+		panic(f.buf.err)
+	}
+	buf := f.buf.b
 	if f.sharp {
 		// Add leading 0x or 0X.
 		buf = append(buf, '0', digits[16])
@@ -457,7 +460,7 @@ func (f *formatter) fmtSbx(s string, b []byte, digits string) {
 		// Encode each byte as two hexadecimal digits.
 		buf = append(buf, digits[c>>4], digits[c&0xF])
 	}
-	*f.buf = buf
+	f.buf.b = buf
 	// Handle padding to the right.
 	if f.widPresent && f.wid > width && f.minus {
 		f.writePadding(f.wid - width)
@@ -616,50 +619,78 @@ func (f *formatter) fmtFloat(v float64, size int, verb rune, prec int) {
 	f.pad(num[1:])
 }
 
+// fmtDecimal formats the string form of a decimal. The sign and the zero
+// padding are handled in the same way as fmtFloat.
+func (f *formatter) fmtDecimal(s string) {
+	num := make([]byte, 0, len(s)+1)
+	if s[0] != '-' {
+		num = append(num, '+')
+	}
+	num = append(num, s...)
+	if f.space && num[0] == '+' && !f.plus {
+		num[0] = ' '
+	}
+	if f.plus || num[0] != '+' {
+		if f.zero && f.widPresent && f.wid > len(num) {
+			f.buf.WriteSingleByte(num[0])
+			f.writePadding(f.wid - len(num))
+			f.buf.Write(num[1:])
+			return
+		}
+		f.pad(num)
+		return
+	}
+	f.pad(num[1:])
+}
+
 // Use simple []byte instead of bytes.Buffer to avoid large dependency.
-type fmtbuf []byte
+type fmtbuf struct {
+	b   []byte
+	max int   // maximum length of the buffer
+	err error // error raised when the buffer would exceed max
+}
 
 func (b *fmtbuf) Write(p []byte) {
-	if len(*b)+len(p) > MaxStringLen {
-		panic(ErrStringLimit)
+	if len(b.b)+len(p) > b.max {
+		panic(b.err)
 	}
 
-	*b = append(*b, p...)
+	b.b = append(b.b, p...)
 }
 
 func (b *fmtbuf) WriteString(s string) {
-	if len(*b)+len(s) > MaxStringLen {
-		panic(ErrStringLimit)
+	if len(b.b)+len(s) > b.max {
+		panic(b.err)
 	}
 
-	*b = append(*b, s...)
+	b.b = append(b.b, s...)
 }
 
 func (b *fmtbuf) WriteSingleByte(c byte) {
-	if len(*b) >= MaxStringLen {
-		panic(ErrStringLimit)
+	if len(b.b) >= b.max {
+		panic(b.err)
 	}
 
-	*b = append(*b, c)
+	b.b = append(b.b, c)
 }
 
 func (b *fmtbuf) WriteRune(r rune) {
-	if len(*b)+utf8.RuneLen(r) > MaxStringLen {
-		panic(ErrStringLimit)
+	if len(b.b)+utf8.RuneLen(r) > b.max {
+		panic(b.err)
 	}
 
 	if r < utf8.RuneSelf {
-		*b = append(*b, byte(r))
+		b.b = append(b.b, byte(r))
 		return
 	}
 
-	b2 := *b
+	b2 := b.b
 	n := len(b2)
 	for n+utf8.UTFMax > cap(b2) {
 		b2 = append(b2, 0)
 	}
 	w := utf8.EncodeRune(b2[n:n+utf8.UTFMax], r)
-	*b = b2[:n+w]
+	b.b = b2[:n+w]
 }
 
 // pp is used to store a printer's state and is reused with sync.Pool to avoid
@@ -689,10 +720,13 @@ var ppFree = sync.Pool{
 	New: func() interface{} { return new(pp) },
 }
 
-// newPrinter allocates a new pp struct or grabs a cached one.
-func newPrinter() *pp {
+// newPrinter allocates a new pp struct or grabs a cached one. The printed
+// string is limited to max bytes, and err is returned if it's exceeded.
+func newPrinter(max int, err error) *pp {
 	p := ppFree.Get().(*pp)
 	p.erroring = false
+	p.buf.max = max
+	p.buf.err = err
 	p.fmt.init(&p.buf)
 	return p
 }
@@ -705,11 +739,11 @@ func (p *pp) free() {
 	// fmtbuf to place back in the pool.
 	//
 	// See https://golang.org/issue/23199
-	if cap(p.buf) > 64<<10 {
+	if cap(p.buf.b) > 64<<10 {
 		return
 	}
 
-	p.buf = p.buf[:0]
+	p.buf.b = p.buf.b[:0]
 	p.arg = nil
 	ppFree.Put(p)
 }
@@ -871,6 +905,21 @@ func (p *pp) fmtFloat(v float64, size int, verb rune) {
 	}
 }
 
+// fmtDecimal formats a decimal without converting it to float. The
+// precision of %f is the number of digits after the decimal point, and the
+// value is rounded half to even.
+func (p *pp) fmtDecimal(v *Decimal, verb rune) {
+	switch verb {
+	case 'f', 'F':
+		if p.fmt.precPresent {
+			v = v.Round(p.fmt.prec, RoundHalfEven)
+		}
+		p.fmt.fmtDecimal(v.String())
+	default:
+		p.fmtString(v.String(), verb)
+	}
+}
+
 func (p *pp) fmtString(v string, verb rune) {
 	switch verb {
 	case 'v':
@@ -955,6 +1004,8 @@ func (p *pp) printArg(arg Object, verb rune) {
 		p.fmtBool(!f.IsFalsy(), verb)
 	case *Float:
 		p.fmtFloat(f.Value, 64, verb)
+	case *Decimal:
+		p.fmtDecimal(f, verb)
 	case *Int:
 		p.fmtInteger(uint64(f.Value), signed, verb)
 	case *String:
@@ -1046,7 +1097,7 @@ func (p *pp) missingArg(verb rune) {
 func (p *pp) doFormat(format string, a []Object) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if e, ok := r.(error); ok && e == ErrStringLimit {
+			if e, ok := r.(error); ok && e == p.buf.err {
 				err = e
 				return
 			}
@@ -1236,9 +1287,20 @@ formatLoop:
 
 // Format is like fmt.Sprintf but using Objects.
 func Format(format string, a ...Object) (string, error) {
-	p := newPrinter()
-	err := p.doFormat(format, a)
-	s := string(p.buf)
+	return formatLimit(MaxStringLen, ErrStringLimit, format, a...)
+}
+
+// formatLimit is like Format, but returns err if the formatted string would
+// be longer than max bytes.
+func formatLimit(
+	max int,
+	err error,
+	format string,
+	a ...Object,
+) (string, error) {
+	p := newPrinter(max, err)
+	err = p.doFormat(format, a)
+	s := string(p.buf.b)
 	p.free()
 
 	return s, err
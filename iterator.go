@@ -1,5 +1,7 @@
 package tengo
 
+import "errors"
+
 // Iterator represents an iterator for underlying data type.
 type Iterator interface {
 	Object
@@ -55,7 +57,7 @@ func (i *ArrayIterator) Next() bool {
 
 // Key returns the key or index value of the current element.
 func (i *ArrayIterator) Key() Object {
-	return &Int{Value: int64(i.i - 1)}
+	return newInt(int64(i.i - 1))
 }
 
 // Value returns the value of the current element.
@@ -99,21 +101,41 @@ func (i *BytesIterator) Next() bool {
 
 // Key returns the key or index value of the current element.
 func (i *BytesIterator) Key() Object {
-	return &Int{Value: int64(i.i - 1)}
+	return newInt(int64(i.i - 1))
 }
 
 // Value returns the value of the current element.
 func (i *BytesIterator) Value() Object {
-	return &Int{Value: int64(i.v[i.i-1])}
+	return newInt(int64(i.v[i.i-1]))
 }
 
 // MapIterator represents an iterator for the map.
 type MapIterator struct {
 	ObjectImpl
-	v map[string]Object
-	k []string
-	i int
-	l int
+	v  map[string]Object
+	h  map[HashKey]MapEntry
+	k  []string
+	hk []HashKey
+	i  int
+	l  int
+}
+
+func newMapIterator(v map[string]Object, h map[HashKey]MapEntry) *MapIterator {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	var hashKeys []HashKey
+	for k := range h {
+		hashKeys = append(hashKeys, k)
+	}
+	return &MapIterator{
+		v:  v,
+		h:  h,
+		k:  keys,
+		hk: hashKeys,
+		l:  len(keys) + len(hashKeys),
+	}
 }
 
 // TypeName returns the name of the type.
@@ -138,7 +160,7 @@ func (i *MapIterator) Equals(Object) bool {
 
 // Copy returns a copy of the type.
 func (i *MapIterator) Copy() Object {
-	return &MapIterator{v: i.v, k: i.k, i: i.i, l: i.l}
+	return &MapIterator{v: i.v, h: i.h, k: i.k, hk: i.hk, i: i.i, l: i.l}
 }
 
 // Next returns true if there are more elements to iterate.
@@ -149,14 +171,76 @@ func (i *MapIterator) Next() bool {
 
 // Key returns the key or index value of the current element.
 func (i *MapIterator) Key() Object {
-	k := i.k[i.i-1]
-	return &String{Value: k}
+	if n := i.i - 1; n < len(i.k) {
+		return &String{Value: i.k[n]}
+	}
+	return i.h[i.hk[i.i-1-len(i.k)]].Key
 }
 
 // Value returns the value of the current element.
 func (i *MapIterator) Value() Object {
-	k := i.k[i.i-1]
-	return i.v[k]
+	if n := i.i - 1; n < len(i.k) {
+		return i.v[i.k[n]]
+	}
+	return i.h[i.hk[i.i-1-len(i.k)]].Value
+}
+
+// SetIterator represents an iterator for a set. The key of an element is its
+// index in the iteration order.
+type SetIterator struct {
+	ObjectImpl
+	v []Object
+	i int
+	l int
+}
+
+func newSetIterator(v map[HashKey]Object) *SetIterator {
+	elements := make([]Object, 0, len(v))
+	for _, e := range v {
+		elements = append(elements, e)
+	}
+	return &SetIterator{v: elements, l: len(elements)}
+}
+
+// TypeName returns the name of the type.
+func (i *SetIterator) TypeName() string {
+	return "set-iterator"
+}
+
+func (i *SetIterator) String() string {
+	return "<set-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *SetIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *SetIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *SetIterator) Copy() Object {
+	return &SetIterator{v: i.v, i: i.i, l: i.l}
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *SetIterator) Next() bool {
+	i.i++
+	return i.i <= i.l
+}
+
+// Key returns the key or index value of the current element.
+func (i *SetIterator) Key() Object {
+	return newInt(int64(i.i - 1))
+}
+
+// Value returns the value of the current element.
+func (i *SetIterator) Value() Object {
+	return i.v[i.i-1]
 }
 
 // StringIterator represents an iterator for a string.
@@ -200,10 +284,117 @@ func (i *StringIterator) Next() bool {
 
 // Key returns the key or index value of the current element.
 func (i *StringIterator) Key() Object {
-	return &Int{Value: int64(i.i - 1)}
+	return newInt(int64(i.i - 1))
 }
 
 // Value returns the value of the current element.
 func (i *StringIterator) Value() Object {
 	return &Char{Value: i.v[i.i-1]}
 }
+
+// Generator represents a generator returned by calling a generator function,
+// a function containing yield statements. The function is run on the VM that
+// iterates the generator, and it is suspended at each yield statement until
+// the next value is requested. The key of a value is its index.
+type Generator struct {
+	ObjectImpl
+	vm       *VM // VM that last iterated the generator
+	fn       *CompiledFunction
+	stack    []Object // locals and operands of the suspended function
+	handlers []handler
+	defers   []deferredCall
+	ip       int
+	index    int64
+	value    Object
+	yielded  bool
+	running  bool
+	done     bool
+	err      error
+}
+
+// TypeName returns the name of the type.
+func (g *Generator) TypeName() string {
+	return "generator"
+}
+
+func (g *Generator) String() string {
+	return "<generator>"
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (g *Generator) Equals(x Object) bool {
+	return g == x
+}
+
+// Copy returns the generator itself, as its state cannot be copied.
+func (g *Generator) Copy() Object {
+	return g
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (g *Generator) CanIterate() bool {
+	return true
+}
+
+// Iterate returns the generator itself. It can be iterated only once.
+func (g *Generator) Iterate() Iterator {
+	return g
+}
+
+// Next resumes the generator function, and returns true if it yielded a
+// value. It returns false when the function returns or fails; see Err. The
+// function is resumed on the VM that last iterated the generator.
+func (g *Generator) Next() bool {
+	return g.next(g.vm)
+}
+
+// next resumes the generator function on the given VM, which is used for
+// the later calls of Next too, so that the limits and the abort of the
+// iterating VM apply rather than those of the VM that created it.
+func (g *Generator) next(vm *VM) bool {
+	g.vm = vm
+	if g.done {
+		return false
+	}
+	if g.running {
+		g.err = errors.New("generator already running")
+		g.done = true
+		return false
+	}
+	if g.yielded {
+		g.index++
+	}
+	g.running = true
+	err := vm.resume(g)
+	g.running = false
+	if err != nil {
+		g.err = err
+		g.done = true
+		return false
+	}
+	if !g.yielded {
+		g.done = true
+		g.value = nil
+		g.stack, g.handlers, g.defers = nil, nil, nil
+	}
+	return g.yielded
+}
+
+// Key returns the index of the current value.
+func (g *Generator) Key() Object {
+	return newInt(g.index)
+}
+
+// Value returns the current value yielded by the generator function.
+func (g *Generator) Value() Object {
+	if g.value == nil {
+		return UndefinedValue
+	}
+	return g.value
+}
+
+// Err returns the error that stopped the generator function, if any.
+func (g *Generator) Err() error {
+	return g.err
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,14 @@ var (
 	UndefinedValue Object = &Undefined{}
 )
 
+// boolValue returns TrueValue or FalseValue.
+func boolValue(b bool) Object {
+	if b {
+		return TrueValue
+	}
+	return FalseValue
+}
+
 // Object represents an object in the VM.
 type Object interface {
 	// TypeName should return the name of the type.
@@ -79,6 +88,60 @@ type Object interface {
 	CanCall() bool
 }
 
+// VMCallable is an optional interface for callable objects that need to call
+// back into the VM that invokes them, e.g. to run a script function that was
+// passed as an argument. If a callable Object implements VMCallable, the VM
+// will use CallVM instead of Call.
+type VMCallable interface {
+	Object
+
+	// CallVM should take the calling VM and an arbitrary number of arguments,
+	// and return a return value and/or an error, which the VM will consider
+	// as a run-time error.
+	CallVM(vm *VM, args ...Object) (ret Object, err error)
+}
+
+// Hashable is an optional interface for objects that can be used as map
+// keys other than strings. Objects that are equal must have the same hash
+// key.
+type Hashable interface {
+	Object
+
+	// HashKey should return the hash key of the object, or false if the
+	// object cannot be hashed, e.g. an immutable array with a map element.
+	HashKey() (HashKey, bool)
+}
+
+// HashKey is the key of a Hashable object in maps.
+type HashKey struct {
+	Type  string      // type of the key
+	Value interface{} // comparable value of the key
+}
+
+// tupleKey is the hash key value of an immutable array. The keys of the
+// elements are chained, so tuples of any length are comparable.
+type tupleKey struct {
+	Elem HashKey
+	Next interface{} // tupleKey of the remaining elements, or nil
+}
+
+// MapEntry is an entry of a map whose key is not a string.
+type MapEntry struct {
+	Key   Object
+	Value Object
+}
+
+// Container is an optional interface for objects that support the 'in'
+// operator.
+type Container interface {
+	Object
+
+	// Contains should return true if the object contains the given value.
+	// It should return ErrInvalidOperator if the value cannot be in the
+	// object, e.g. an int in a string.
+	Contains(x Object) (bool, error)
+}
+
 // ObjectImpl represents a default Object Implementation. To defined a new
 // value type, one can embed ObjectImpl in their type declarations to avoid
 // implementing all non-significant methods. TypeName() and String() methods
@@ -250,6 +313,17 @@ func (o *Array) IndexSet(index, value Object) (err error) {
 	return nil
 }
 
+// Contains returns true if any element of the array is equal to the
+// value.
+func (o *Array) Contains(x Object) (bool, error) {
+	for _, e := range o.Value {
+		if e.Equals(x) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Iterate creates an array iterator.
 func (o *Array) Iterate() Iterator {
 	return &ArrayIterator{
@@ -263,6 +337,122 @@ func (o *Array) CanIterate() bool {
 	return true
 }
 
+// BigInt represents an arbitrary-precision integer value.
+type BigInt struct {
+	ObjectImpl
+	Value *big.Int
+}
+
+func (o *BigInt) String() string {
+	return o.Value.String()
+}
+
+// TypeName returns the name of the type.
+func (o *BigInt) TypeName() string {
+	return "big-int"
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. Int operands are converted to
+// big-int, and the arithmetic with a float operand is done in float.
+func (o *BigInt) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	switch rhs := rhs.(type) {
+	case *BigInt:
+		return bigIntBinaryOp(o.Value, op, rhs.Value)
+	case *Int:
+		return bigIntBinaryOp(o.Value, op, big.NewInt(rhs.Value))
+	case *Float:
+		f, _ := new(big.Float).SetInt(o.Value).Float64()
+		return (&Float{Value: f}).BinaryOp(op, rhs)
+	case *Decimal:
+		return decimalBinaryOp(&Decimal{Value: o.Value}, op, rhs)
+	}
+	return nil, ErrInvalidOperator
+}
+
+// Copy returns a copy of the type.
+func (o *BigInt) Copy() Object {
+	return &BigInt{Value: new(big.Int).Set(o.Value)}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *BigInt) IsFalsy() bool {
+	return o.Value.Sign() == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *BigInt) Equals(x Object) bool {
+	switch t := x.(type) {
+	case *BigInt:
+		return o.Value.Cmp(t.Value) == 0
+	case *Int:
+		return o.Value.IsInt64() && o.Value.Int64() == t.Value
+	case *Decimal:
+		return t.Equals(o)
+	}
+	return false
+}
+
+// HashKey returns the hash key of the value. A big-int within the range of
+// int has the same hash key as the int value.
+func (o *BigInt) HashKey() (HashKey, bool) {
+	if o.Value.IsInt64() {
+		return HashKey{Type: "int", Value: o.Value.Int64()}, true
+	}
+	return HashKey{Type: "big-int", Value: o.Value.String()}, true
+}
+
+// maxBigIntShift is the maximum shift count of big-int values, to prevent
+// a single shift from allocating an excessive amount of memory.
+const maxBigIntShift = 1 << 20
+
+func bigIntBinaryOp(x *big.Int, op token.Token, y *big.Int) (Object, error) {
+	switch op {
+	case token.Add:
+		return &BigInt{Value: new(big.Int).Add(x, y)}, nil
+	case token.Sub:
+		return &BigInt{Value: new(big.Int).Sub(x, y)}, nil
+	case token.Mul:
+		return &BigInt{Value: new(big.Int).Mul(x, y)}, nil
+	case token.Quo:
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return &BigInt{Value: new(big.Int).Quo(x, y)}, nil
+	case token.Rem:
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return &BigInt{Value: new(big.Int).Rem(x, y)}, nil
+	case token.And:
+		return &BigInt{Value: new(big.Int).And(x, y)}, nil
+	case token.Or:
+		return &BigInt{Value: new(big.Int).Or(x, y)}, nil
+	case token.Xor:
+		return &BigInt{Value: new(big.Int).Xor(x, y)}, nil
+	case token.AndNot:
+		return &BigInt{Value: new(big.Int).AndNot(x, y)}, nil
+	case token.Shl, token.Shr:
+		if y.Sign() < 0 || !y.IsInt64() || y.Int64() > maxBigIntShift {
+			return nil, ErrInvalidOperator
+		}
+		if op == token.Shl {
+			return &BigInt{Value: new(big.Int).Lsh(x, uint(y.Int64()))}, nil
+		}
+		return &BigInt{Value: new(big.Int).Rsh(x, uint(y.Int64()))}, nil
+	case token.Less:
+		return boolObject(x.Cmp(y) < 0), nil
+	case token.Greater:
+		return boolObject(x.Cmp(y) > 0), nil
+	case token.LessEq:
+		return boolObject(x.Cmp(y) <= 0), nil
+	case token.GreaterEq:
+		return boolObject(x.Cmp(y) >= 0), nil
+	}
+	return nil, ErrInvalidOperator
+}
+
 // Bool represents a boolean value.
 type Bool struct {
 	ObjectImpl
@@ -301,6 +491,11 @@ func (o *Bool) Equals(x Object) bool {
 	return o == x
 }
 
+// HashKey returns the hash key of the value.
+func (o *Bool) HashKey() (HashKey, bool) {
+	return HashKey{Type: "bool", Value: o.value}, true
+}
+
 // GobDecode decodes bool value from input bytes.
 func (o *Bool) GobDecode(b []byte) (err error) {
 	o.value = b[0] == 1
@@ -317,11 +512,19 @@ func (o *Bool) GobEncode() (b []byte, err error) {
 	return
 }
 
+func boolObject(b bool) Object {
+	if b {
+		return TrueValue
+	}
+	return FalseValue
+}
+
 // BuiltinFunction represents a builtin function.
 type BuiltinFunction struct {
 	ObjectImpl
-	Name  string
-	Value CallableFunc
+	Name    string
+	Value   CallableFunc
+	VMValue CallableVMFunc // used instead of Value if set
 }
 
 // TypeName returns the name of the type.
@@ -335,7 +538,7 @@ func (o *BuiltinFunction) String() string {
 
 // Copy returns a copy of the type.
 func (o *BuiltinFunction) Copy() Object {
-	return &BuiltinFunction{Value: o.Value}
+	return &BuiltinFunction{Value: o.Value, VMValue: o.VMValue}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -346,6 +549,14 @@ func (o *BuiltinFunction) Equals(_ Object) bool {
 
 // Call executes a builtin function.
 func (o *BuiltinFunction) Call(args ...Object) (Object, error) {
+	return o.CallVM(nil, args...)
+}
+
+// CallVM executes a builtin function with the calling VM.
+func (o *BuiltinFunction) CallVM(vm *VM, args ...Object) (Object, error) {
+	if o.VMValue != nil {
+		return o.VMValue(vm, args...)
+	}
 	return o.Value(args...)
 }
 
@@ -441,6 +652,22 @@ func (o *Bytes) IndexGet(index Object) (res Object, err error) {
 	return
 }
 
+// Contains returns true if the bytes contain the given bytes, or the byte
+// of the given int or char value.
+func (o *Bytes) Contains(x Object) (bool, error) {
+	switch x := x.(type) {
+	case *Bytes:
+		return bytes.Contains(o.Value, x.Value), nil
+	case *Int:
+		return x.Value >= 0 && x.Value <= math.MaxUint8 &&
+			bytes.IndexByte(o.Value, byte(x.Value)) >= 0, nil
+	case *Char:
+		return x.Value >= 0 && x.Value <= math.MaxUint8 &&
+			bytes.IndexByte(o.Value, byte(x.Value)) >= 0, nil
+	}
+	return false, ErrInvalidOperator
+}
+
 // Iterate creates a bytes iterator.
 func (o *Bytes) Iterate() Iterator {
 	return &BytesIterator{
@@ -567,15 +794,22 @@ func (o *Char) Equals(x Object) bool {
 	return o.Value == t.Value
 }
 
+// HashKey returns the hash key of the value.
+func (o *Char) HashKey() (HashKey, bool) {
+	return HashKey{Type: "char", Value: o.Value}, true
+}
+
 // CompiledFunction represents a compiled function.
 type CompiledFunction struct {
 	ObjectImpl
+	Name          string // name of the variable it's assigned to, if any
 	Instructions  []byte
 	NumLocals     int // number of local variables (including function parameters)
 	NumParameters int
 	VarArgs       bool
 	SourceMap     map[int]parser.Pos
 	Free          []*ObjectPtr
+	Generator     bool // calling it returns a Generator
 }
 
 // TypeName returns the name of the type.
@@ -596,11 +830,13 @@ func (o *CompiledFunction) Size() int64 {
 // Copy returns a copy of the type.
 func (o *CompiledFunction) Copy() Object {
 	return &CompiledFunction{
+		Name:          o.Name,
 		Instructions:  append([]byte{}, o.Instructions...),
 		NumLocals:     o.NumLocals,
 		NumParameters: o.NumParameters,
 		VarArgs:       o.VarArgs,
 		Free:          append([]*ObjectPtr{}, o.Free...), // DO NOT Copy() of elements; these are variable pointers
+		Generator:     o.Generator,
 	}
 }
 
@@ -626,6 +862,253 @@ func (o *CompiledFunction) CanCall() bool {
 	return true
 }
 
+// Decimal represents a fixed-point decimal value. The number is the unscaled
+// Value multiplied by 10 to the power of -Scale.
+type Decimal struct {
+	ObjectImpl
+	Value *big.Int
+	Scale int
+}
+
+// RoundingMode is the mode used to round decimal values.
+type RoundingMode int
+
+// Rounding modes of decimal values.
+const (
+	RoundHalfEven RoundingMode = iota // round half to even
+	RoundHalfUp                       // round half away from zero
+	RoundDown                         // round toward zero
+)
+
+// MaxDecimalScale is the maximum exponent and the maximum number of digits
+// after the decimal point accepted when parsing or rounding decimal values.
+const MaxDecimalScale = 1 << 16
+
+// decimalQuoScale is the minimum number of digits after the decimal point of
+// the quotient of decimal values.
+const decimalQuoScale = 16
+
+// ParseDecimal parses a decimal value from a string such as "12.34", "-0.5"
+// or "1.5e3".
+func ParseDecimal(s string) (*Decimal, error) {
+	mant, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e < -MaxDecimalScale || e > MaxDecimalScale {
+			return nil, fmt.Errorf("invalid decimal: %q", s)
+		}
+		mant, exp = s[:i], e
+	}
+	scale := 0
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		scale = len(mant) - i - 1
+		mant = mant[:i] + mant[i+1:]
+	}
+	v, ok := new(big.Int).SetString(mant, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal: %q", s)
+	}
+	scale -= exp
+	if scale < 0 {
+		v.Mul(v, pow10(-scale))
+		scale = 0
+	}
+	if scale > MaxDecimalScale {
+		return nil, fmt.Errorf("invalid decimal: %q", s)
+	}
+	return &Decimal{Value: v, Scale: scale}, nil
+}
+
+func (o *Decimal) String() string {
+	s := new(big.Int).Abs(o.Value).String()
+	if o.Scale > 0 {
+		if len(s) <= o.Scale {
+			s = strings.Repeat("0", o.Scale-len(s)+1) + s
+		}
+		s = s[:len(s)-o.Scale] + "." + s[len(s)-o.Scale:]
+	}
+	if o.Value.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// TypeName returns the name of the type.
+func (o *Decimal) TypeName() string {
+	return "decimal"
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. Int and big-int operands are
+// converted to decimal. Float operands are not allowed, as the conversion
+// may lose precision.
+func (o *Decimal) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	switch rhs := rhs.(type) {
+	case *Decimal:
+		return decimalBinaryOp(o, op, rhs)
+	case *Int:
+		return decimalBinaryOp(o, op, &Decimal{Value: big.NewInt(rhs.Value)})
+	case *BigInt:
+		return decimalBinaryOp(o, op, &Decimal{Value: rhs.Value})
+	}
+	return nil, ErrInvalidOperator
+}
+
+// Copy returns a copy of the type.
+func (o *Decimal) Copy() Object {
+	return &Decimal{Value: new(big.Int).Set(o.Value), Scale: o.Scale}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *Decimal) IsFalsy() bool {
+	return o.Value.Sign() == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object. Decimal values of different scales are equal if their
+// numbers are equal.
+func (o *Decimal) Equals(x Object) bool {
+	switch t := x.(type) {
+	case *Decimal:
+		return o.cmp(t) == 0
+	case *Int:
+		return o.cmp(&Decimal{Value: big.NewInt(t.Value)}) == 0
+	case *BigInt:
+		return o.cmp(&Decimal{Value: t.Value}) == 0
+	}
+	return false
+}
+
+// HashKey returns the hash key of the value. Equal decimal values have the
+// same hash key regardless of their scales, and an integral decimal value
+// has the same hash key as the int or big-int value.
+func (o *Decimal) HashKey() (HashKey, bool) {
+	d := o.trim(0)
+	if d.Scale == 0 {
+		return (&BigInt{Value: d.Value}).HashKey()
+	}
+	return HashKey{Type: "decimal", Value: d.String()}, true
+}
+
+// Round returns the value rounded to the given number of digits after the
+// decimal point using the rounding mode. If the value has fewer digits, it
+// is padded with zeros.
+func (o *Decimal) Round(places int, mode RoundingMode) *Decimal {
+	if places >= o.Scale {
+		return &Decimal{Value: o.unscaled(places), Scale: places}
+	}
+	v := roundQuo(o.Value, pow10(o.Scale-places), mode)
+	if places < 0 {
+		return &Decimal{Value: v.Mul(v, pow10(-places))}
+	}
+	return &Decimal{Value: v, Scale: places}
+}
+
+// unscaled returns the unscaled value for the scale, which must not be less
+// than the scale of the value.
+func (o *Decimal) unscaled(scale int) *big.Int {
+	if scale == o.Scale {
+		return o.Value
+	}
+	return new(big.Int).Mul(o.Value, pow10(scale-o.Scale))
+}
+
+func (o *Decimal) cmp(x *Decimal) int {
+	scale := o.Scale
+	if x.Scale > scale {
+		scale = x.Scale
+	}
+	return o.unscaled(scale).Cmp(x.unscaled(scale))
+}
+
+// trim removes the trailing zeros after the decimal point, keeping at least
+// the given number of digits.
+func (o *Decimal) trim(scale int) *Decimal {
+	v, s := o.Value, o.Scale
+	ten := big.NewInt(10)
+	for s > scale {
+		q, r := new(big.Int).QuoRem(v, ten, new(big.Int))
+		if r.Sign() != 0 {
+			break
+		}
+		v, s = q, s-1
+	}
+	return &Decimal{Value: v, Scale: s}
+}
+
+func decimalBinaryOp(x *Decimal, op token.Token, y *Decimal) (Object, error) {
+	scale := x.Scale
+	if y.Scale > scale {
+		scale = y.Scale
+	}
+	switch op {
+	case token.Add:
+		return &Decimal{
+			Value: new(big.Int).Add(x.unscaled(scale), y.unscaled(scale)),
+			Scale: scale,
+		}, nil
+	case token.Sub:
+		return &Decimal{
+			Value: new(big.Int).Sub(x.unscaled(scale), y.unscaled(scale)),
+			Scale: scale,
+		}, nil
+	case token.Mul:
+		return &Decimal{
+			Value: new(big.Int).Mul(x.Value, y.Value),
+			Scale: x.Scale + y.Scale,
+		}, nil
+	case token.Quo:
+		if y.Value.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		// the quotient is rounded to at least decimalQuoScale digits, and
+		// the trailing zeros beyond the scales of the operands are removed.
+		quoScale := scale
+		if quoScale < decimalQuoScale {
+			quoScale = decimalQuoScale
+		}
+		num := new(big.Int).Mul(x.Value, pow10(quoScale+y.Scale-x.Scale))
+		q := &Decimal{
+			Value: roundQuo(num, y.Value, RoundHalfEven),
+			Scale: quoScale,
+		}
+		return q.trim(scale), nil
+	case token.Less:
+		return boolObject(x.cmp(y) < 0), nil
+	case token.Greater:
+		return boolObject(x.cmp(y) > 0), nil
+	case token.LessEq:
+		return boolObject(x.cmp(y) <= 0), nil
+	case token.GreaterEq:
+		return boolObject(x.cmp(y) >= 0), nil
+	}
+	return nil, ErrInvalidOperator
+}
+
+// roundQuo returns the quotient x/y rounded to an integer using the rounding
+// mode.
+func roundQuo(x, y *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 || mode == RoundDown {
+		return q
+	}
+	// compare the remainder with the half of the divisor
+	r.Abs(r).Lsh(r, 1)
+	c := r.Cmp(new(big.Int).Abs(y))
+	if c > 0 || c == 0 && (mode == RoundHalfUp || q.Bit(0) == 1) {
+		if x.Sign() == y.Sign() {
+			q.Add(q, big.NewInt(1))
+		} else {
+			q.Sub(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
 // Error represents an error value.
 type Error struct {
 	ObjectImpl
@@ -689,6 +1172,9 @@ func (o *Float) TypeName() string {
 // operator and a right-hand side object.
 func (o *Float) BinaryOp(op token.Token, rhs Object) (Object, error) {
 	switch rhs := rhs.(type) {
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(rhs.Value).Float64()
+		return o.BinaryOp(op, &Float{Value: f})
 	case *Float:
 		switch op {
 		case token.Add:
@@ -809,6 +1295,20 @@ func (o *Float) Equals(x Object) bool {
 	return false
 }
 
+// HashKey returns the hash key of the value. A float with an integer value
+// has the same key as the int, as they are equal. NaN is not hashable as it
+// is not equal to itself.
+func (o *Float) HashKey() (HashKey, bool) {
+	if math.IsNaN(o.Value) {
+		return HashKey{}, false
+	}
+	if o.Value == math.Trunc(o.Value) &&
+		o.Value >= math.MinInt64 && o.Value < math.MaxInt64 {
+		return HashKey{Type: "int", Value: int64(o.Value)}, true
+	}
+	return HashKey{Type: "float", Value: o.Value}, true
+}
+
 // ImmutableArray represents an immutable array of objects.
 type ImmutableArray struct {
 	ObjectImpl
@@ -877,6 +1377,20 @@ func (o *ImmutableArray) Equals(x Object) bool {
 	return true
 }
 
+// HashKey returns the hash key of the value. It's hashable only if all its
+// elements are hashable.
+func (o *ImmutableArray) HashKey() (HashKey, bool) {
+	var next interface{}
+	for i := len(o.Value) - 1; i >= 0; i-- {
+		k, ok := hashKeyOf(o.Value[i])
+		if !ok {
+			return HashKey{}, false
+		}
+		next = tupleKey{Elem: k, Next: next}
+	}
+	return HashKey{Type: "tuple", Value: next}, true
+}
+
 // IndexGet returns an element at a given index.
 func (o *ImmutableArray) IndexGet(index Object) (res Object, err error) {
 	intIdx, ok := index.(*Int)
@@ -893,6 +1407,17 @@ func (o *ImmutableArray) IndexGet(index Object) (res Object, err error) {
 	return
 }
 
+// Contains returns true if any element of the array is equal to the
+// value.
+func (o *ImmutableArray) Contains(x Object) (bool, error) {
+	for _, e := range o.Value {
+		if e.Equals(x) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Iterate creates an array iterator.
 func (o *ImmutableArray) Iterate() Iterator {
 	return &ArrayIterator{
@@ -909,7 +1434,8 @@ func (o *ImmutableArray) CanIterate() bool {
 // ImmutableMap represents an immutable map object.
 type ImmutableMap struct {
 	ObjectImpl
-	Value map[string]Object
+	Value  map[string]Object
+	Hashed map[HashKey]MapEntry // entries with keys other than strings
 }
 
 // TypeName returns the name of the type.
@@ -918,11 +1444,7 @@ func (o *ImmutableMap) TypeName() string {
 }
 
 func (o *ImmutableMap) String() string {
-	var pairs []string
-	for k, v := range o.Value {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.String()))
-	}
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	return mapString(o.Value, o.Hashed)
 }
 
 // Copy returns a copy of the type.
@@ -931,63 +1453,51 @@ func (o *ImmutableMap) Copy() Object {
 	for k, v := range o.Value {
 		c[k] = v.Copy()
 	}
-	return &Map{Value: c}
+	return &Map{Value: c, Hashed: copyHashed(o.Hashed)}
 }
 
 // IsFalsy returns true if the value of the type is falsy.
 func (o *ImmutableMap) IsFalsy() bool {
-	return len(o.Value) == 0
+	return len(o.Value) == 0 && len(o.Hashed) == 0
 }
 
 // IndexGet returns the value for the given key.
 func (o *ImmutableMap) IndexGet(index Object) (res Object, err error) {
-	strIdx, ok := ToString(index)
-	if !ok {
-		err = ErrInvalidIndexType
-		return
-	}
-	res, ok = o.Value[strIdx]
-	if !ok {
-		res = UndefinedValue
-	}
-	return
+	return mapIndexGet(o.Value, o.Hashed, index)
 }
 
 // Equals returns true if the value of the type is equal to the value of
 // another object.
 func (o *ImmutableMap) Equals(x Object) bool {
-	var xVal map[string]Object
-	switch x := x.(type) {
-	case *Map:
-		xVal = x.Value
-	case *ImmutableMap:
-		xVal = x.Value
-	default:
-		return false
-	}
-	if len(o.Value) != len(xVal) {
-		return false
-	}
-	for k, v := range o.Value {
-		tv := xVal[k]
-		if !v.Equals(tv) {
-			return false
-		}
-	}
-	return true
+	return mapEquals(o.Value, o.Hashed, x)
+}
+
+// Contains returns true if the map has the key.
+func (o *ImmutableMap) Contains(x Object) (bool, error) {
+	return mapHasKey(o.Value, o.Hashed, x), nil
 }
 
 // Iterate creates an immutable map iterator.
 func (o *ImmutableMap) Iterate() Iterator {
-	var keys []string
-	for k := range o.Value {
-		keys = append(keys, k)
-	}
-	return &MapIterator{
-		v: o.Value,
-		k: keys,
-		l: len(keys),
-	}
+	return newMapIterator(o.Value, o.Hashed)
+}
+
+// Len returns the number of entries, including the entries with keys other
+// than strings.
+func (o *ImmutableMap) Len() int {
+	return len(o.Value) + len(o.Hashed)
+}
+
+// Get returns the value for the given key and whether the key exists. Unlike
+// IndexGet, the keys other than strings are looked up in Hashed.
+func (o *ImmutableMap) Get(key Object) (Object, bool) {
+	return mapGet(o.Value, o.Hashed, key)
+}
+
+// Range calls fn for each entry until fn returns false. The string keys are
+// passed as String objects.
+func (o *ImmutableMap) Range(fn func(key, value Object) bool) {
+	mapRange(o.Value, o.Hashed, fn)
 }
 
 // CanIterate returns whether the Object can be Iterated.
@@ -995,12 +1505,90 @@ func (o *ImmutableMap) CanIterate() bool {
 	return true
 }
 
-// Int represents an integer value.
+// ImmutableSet represents an immutable set of hashable objects.
+type ImmutableSet struct {
+	ObjectImpl
+	Value map[HashKey]Object
+}
+
+// TypeName returns the name of the type.
+func (o *ImmutableSet) TypeName() string {
+	return "immutable-set"
+}
+
+func (o *ImmutableSet) String() string {
+	return setString(o.Value)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *ImmutableSet) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return setBinaryOp(o.Value, op, rhs)
+}
+
+// Copy returns a copy of the type.
+func (o *ImmutableSet) Copy() Object {
+	return &Set{Value: copySet(o.Value)}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *ImmutableSet) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *ImmutableSet) Equals(x Object) bool {
+	return setEquals(o.Value, x)
+}
+
+// Contains returns true if the set contains the object. It returns
+// ErrNotHashable if the object is not hashable.
+func (o *ImmutableSet) Contains(x Object) (bool, error) {
+	return setContains(o.Value, x)
+}
+
+// Iterate creates a set iterator.
+func (o *ImmutableSet) Iterate() Iterator {
+	return newSetIterator(o.Value)
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *ImmutableSet) CanIterate() bool {
+	return true
+}
+
+// Int represents an integer value. The VM shares the Int objects of small
+// values, so an Int must not be modified once it is created.
 type Int struct {
 	ObjectImpl
 	Value int64
 }
 
+// The range of the int values cached by newInt.
+const (
+	minSmallInt = -128
+	maxSmallInt = 1023
+)
+
+// smallInts are the cached int values. They are shared by all VMs and must
+// not be modified.
+var smallInts = func() (ints [maxSmallInt - minSmallInt + 1]Int) {
+	for i := range ints {
+		ints[i].Value = int64(i + minSmallInt)
+	}
+	return
+}()
+
+// newInt returns an Int of the value. Small values are not allocated but
+// shared from a cache.
+func newInt(v int64) *Int {
+	if v >= minSmallInt && v <= maxSmallInt {
+		return &smallInts[v-minSmallInt]
+	}
+	return &Int{Value: v}
+}
+
 func (o *Int) String() string {
 	return strconv.FormatInt(o.Value, 10)
 }
@@ -1035,12 +1623,18 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return &Int{Value: r}, nil
 		case token.Quo:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value / rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
 			return &Int{Value: r}, nil
 		case token.Rem:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value % rhs.Value
 			if r == o.Value {
 				return o, nil
@@ -1134,6 +1728,10 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return FalseValue, nil
 		}
+	case *BigInt:
+		return bigIntBinaryOp(big.NewInt(o.Value), op, rhs.Value)
+	case *Decimal:
+		return decimalBinaryOp(&Decimal{Value: big.NewInt(o.Value)}, op, rhs)
 	case *Char:
 		switch op {
 		case token.Add:
@@ -1183,14 +1781,27 @@ func (o *Int) Equals(x Object) bool {
 		return o.Value == t.Value
 	case *Float:
 		return float64(o.Value) == t.Value
+	case *BigInt:
+		return t.Value.IsInt64() && t.Value.Int64() == o.Value
+	case *Decimal:
+		return t.Equals(o)
 	}
 	return false
 }
 
-// Map represents a map of objects.
+// HashKey returns the hash key of the value.
+func (o *Int) HashKey() (HashKey, bool) {
+	return HashKey{Type: "int", Value: o.Value}, true
+}
+
+// Map represents a map of objects. The entries with string keys are in
+// Value, and the entries with other hashable keys are in Hashed. Keys are
+// not converted to strings, so the int key 1 and the string key "1" are
+// different entries.
 type Map struct {
 	ObjectImpl
-	Value map[string]Object
+	Value  map[string]Object
+	Hashed map[HashKey]MapEntry // entries with keys other than strings
 }
 
 // TypeName returns the name of the type.
@@ -1199,11 +1810,7 @@ func (o *Map) TypeName() string {
 }
 
 func (o *Map) String() string {
-	var pairs []string
-	for k, v := range o.Value {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.String()))
-	}
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	return mapString(o.Value, o.Hashed)
 }
 
 // Copy returns a copy of the type.
@@ -1212,81 +1819,213 @@ func (o *Map) Copy() Object {
 	for k, v := range o.Value {
 		c[k] = v.Copy()
 	}
-	return &Map{Value: c}
+	return &Map{Value: c, Hashed: copyHashed(o.Hashed)}
 }
 
 // IsFalsy returns true if the value of the type is falsy.
 func (o *Map) IsFalsy() bool {
-	return len(o.Value) == 0
+	return len(o.Value) == 0 && len(o.Hashed) == 0
 }
 
 // Equals returns true if the value of the type is equal to the value of
 // another object.
 func (o *Map) Equals(x Object) bool {
-	var xVal map[string]Object
-	switch x := x.(type) {
-	case *Map:
-		xVal = x.Value
-	case *ImmutableMap:
-		xVal = x.Value
-	default:
-		return false
+	return mapEquals(o.Value, o.Hashed, x)
+}
+
+// IndexGet returns the value for the given key.
+func (o *Map) IndexGet(index Object) (res Object, err error) {
+	return mapIndexGet(o.Value, o.Hashed, index)
+}
+
+// IndexSet sets the value for the given key.
+func (o *Map) IndexSet(index, value Object) (err error) {
+	if s, ok := index.(*String); ok {
+		o.Value[s.Value] = value
+		return nil
 	}
-	if len(o.Value) != len(xVal) {
-		return false
+	key, ok := hashKeyOf(index)
+	if !ok {
+		return ErrInvalidIndexType
 	}
-	for k, v := range o.Value {
-		tv := xVal[k]
-		if !v.Equals(tv) {
-			return false
-		}
+	if o.Hashed == nil {
+		o.Hashed = make(map[HashKey]MapEntry)
 	}
+	o.Hashed[key] = MapEntry{Key: index, Value: value}
+	return nil
+}
+
+// Contains returns true if the map has the key.
+func (o *Map) Contains(x Object) (bool, error) {
+	return mapHasKey(o.Value, o.Hashed, x), nil
+}
+
+// Iterate creates a map iterator.
+func (o *Map) Iterate() Iterator {
+	return newMapIterator(o.Value, o.Hashed)
+}
+
+// Len returns the number of entries, including the entries with keys other
+// than strings.
+func (o *Map) Len() int {
+	return len(o.Value) + len(o.Hashed)
+}
+
+// Get returns the value for the given key and whether the key exists. Unlike
+// IndexGet, the keys other than strings are looked up in Hashed.
+func (o *Map) Get(key Object) (Object, bool) {
+	return mapGet(o.Value, o.Hashed, key)
+}
+
+// Range calls fn for each entry until fn returns false. The string keys are
+// passed as String objects.
+func (o *Map) Range(fn func(key, value Object) bool) {
+	mapRange(o.Value, o.Hashed, fn)
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *Map) CanIterate() bool {
 	return true
 }
 
-// IndexGet returns the value for the given key.
-func (o *Map) IndexGet(index Object) (res Object, err error) {
-	strIdx, ok := ToString(index)
+// hashKeyOf returns the hash key of the object used as a map key.
+func hashKeyOf(o Object) (HashKey, bool) {
+	if h, ok := o.(Hashable); ok {
+		return h.HashKey()
+	}
+	return HashKey{}, false
+}
+
+func mapString(v map[string]Object, h map[HashKey]MapEntry) string {
+	var pairs []string
+	for k, v := range v {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.String()))
+	}
+	for _, e := range h {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", e.Key.String(),
+			e.Value.String()))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+func mapIndexGet(
+	v map[string]Object,
+	h map[HashKey]MapEntry,
+	index Object,
+) (res Object, err error) {
+	if s, ok := index.(*String); ok {
+		res, ok = v[s.Value]
+		if !ok {
+			res = UndefinedValue
+		}
+		return
+	}
+	key, ok := hashKeyOf(index)
 	if !ok {
 		err = ErrInvalidIndexType
 		return
 	}
-	res, ok = o.Value[strIdx]
+	e, ok := h[key]
 	if !ok {
 		res = UndefinedValue
+		return
 	}
+	res = e.Value
 	return
 }
 
-// IndexSet sets the value for the given key.
-func (o *Map) IndexSet(index, value Object) (err error) {
-	strIdx, ok := ToString(index)
+func mapGet(
+	v map[string]Object,
+	h map[HashKey]MapEntry,
+	key Object,
+) (Object, bool) {
+	if s, ok := key.(*String); ok {
+		res, ok := v[s.Value]
+		return res, ok
+	}
+	k, ok := hashKeyOf(key)
 	if !ok {
-		err = ErrInvalidIndexType
-		return
+		return nil, false
 	}
-	o.Value[strIdx] = value
-	return nil
+	e, ok := h[k]
+	return e.Value, ok
 }
 
-// Iterate creates a map iterator.
-func (o *Map) Iterate() Iterator {
-	var keys []string
-	for k := range o.Value {
-		keys = append(keys, k)
+func mapRange(
+	v map[string]Object,
+	h map[HashKey]MapEntry,
+	fn func(key, value Object) bool,
+) {
+	for k, v := range v {
+		if !fn(&String{Value: k}, v) {
+			return
+		}
 	}
-	return &MapIterator{
-		v: o.Value,
-		k: keys,
-		l: len(keys),
+	for _, e := range h {
+		if !fn(e.Key, e.Value) {
+			return
+		}
 	}
 }
 
-// CanIterate returns whether the Object can be Iterated.
-func (o *Map) CanIterate() bool {
+func mapHasKey(
+	v map[string]Object,
+	h map[HashKey]MapEntry,
+	index Object,
+) bool {
+	if s, ok := index.(*String); ok {
+		_, ok = v[s.Value]
+		return ok
+	}
+	key, ok := hashKeyOf(index)
+	if !ok {
+		return false
+	}
+	_, ok = h[key]
+	return ok
+}
+
+func mapEquals(v map[string]Object, h map[HashKey]MapEntry, x Object) bool {
+	var xVal map[string]Object
+	var xHashed map[HashKey]MapEntry
+	switch x := x.(type) {
+	case *Map:
+		xVal, xHashed = x.Value, x.Hashed
+	case *ImmutableMap:
+		xVal, xHashed = x.Value, x.Hashed
+	default:
+		return false
+	}
+	if len(v) != len(xVal) || len(h) != len(xHashed) {
+		return false
+	}
+	for k, v := range v {
+		tv := xVal[k]
+		if !v.Equals(tv) {
+			return false
+		}
+	}
+	for k, e := range h {
+		te, ok := xHashed[k]
+		if !ok || !e.Value.Equals(te.Value) {
+			return false
+		}
+	}
 	return true
 }
 
+// copyHashed returns a copy of the entries with the values copied.
+func copyHashed(h map[HashKey]MapEntry) map[HashKey]MapEntry {
+	if h == nil {
+		return nil
+	}
+	c := make(map[HashKey]MapEntry, len(h))
+	for k, e := range h {
+		c[k] = MapEntry{Key: e.Key, Value: e.Value.Copy()}
+	}
+	return c
+}
+
 // ObjectPtr represents a free variable.
 type ObjectPtr struct {
 	ObjectImpl
@@ -1318,6 +2057,235 @@ func (o *ObjectPtr) Equals(x Object) bool {
 	return o == x
 }
 
+// Set represents a set of hashable objects. The elements are keyed by their
+// hash keys.
+type Set struct {
+	ObjectImpl
+	Value   map[HashKey]Object
+	methods map[string]*UserFunction // 'add' and 'remove' bound to the set
+}
+
+// NewSet creates a new set with the given elements. It returns an error if
+// any of the elements is not hashable.
+func NewSet(elements ...Object) (*Set, error) {
+	s := &Set{Value: make(map[HashKey]Object, len(elements))}
+	if err := s.Add(elements...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TypeName returns the name of the type.
+func (o *Set) TypeName() string {
+	return "set"
+}
+
+func (o *Set) String() string {
+	return setString(o.Value)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. The operators '|', '&', '-' and
+// '^' return the union, intersection, difference and symmetric difference
+// of the sets.
+func (o *Set) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return setBinaryOp(o.Value, op, rhs)
+}
+
+// Copy returns a copy of the type.
+func (o *Set) Copy() Object {
+	return &Set{Value: copySet(o.Value)}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *Set) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *Set) Equals(x Object) bool {
+	return setEquals(o.Value, x)
+}
+
+// IndexGet returns the 'add' and 'remove' methods of the set. The methods
+// are created once for each set.
+func (o *Set) IndexGet(index Object) (Object, error) {
+	name, ok := index.(*String)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	if fn, ok := o.methods[name.Value]; ok {
+		return fn, nil
+	}
+	var fn *UserFunction
+	switch name.Value {
+	case "add":
+		fn = &UserFunction{
+			Name: "add",
+			Value: func(args ...Object) (Object, error) {
+				if err := o.Add(args...); err != nil {
+					return nil, err
+				}
+				return UndefinedValue, nil
+			},
+		}
+	case "remove":
+		fn = &UserFunction{
+			Name: "remove",
+			Value: func(args ...Object) (Object, error) {
+				for _, arg := range args {
+					if key, ok := hashKeyOf(arg); ok {
+						delete(o.Value, key)
+					}
+				}
+				return UndefinedValue, nil
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown method '%s' of set", name.Value)
+	}
+	if o.methods == nil {
+		o.methods = make(map[string]*UserFunction, 2)
+	}
+	o.methods[name.Value] = fn
+	return fn, nil
+}
+
+// Add adds the elements to the set. It returns an error if any of the
+// elements is not hashable.
+func (o *Set) Add(elements ...Object) error {
+	if o.Value == nil {
+		o.Value = make(map[HashKey]Object, len(elements))
+	}
+	for _, e := range elements {
+		key, ok := hashKeyOf(e)
+		if !ok {
+			return ErrInvalidArgumentType{
+				Name:     "element",
+				Expected: "hashable",
+				Found:    e.TypeName(),
+			}
+		}
+		o.Value[key] = e
+	}
+	return nil
+}
+
+// Contains returns true if the set contains the object. It returns
+// ErrNotHashable if the object is not hashable.
+func (o *Set) Contains(x Object) (bool, error) {
+	return setContains(o.Value, x)
+}
+
+// Iterate creates a set iterator.
+func (o *Set) Iterate() Iterator {
+	return newSetIterator(o.Value)
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *Set) CanIterate() bool {
+	return true
+}
+
+func setString(v map[HashKey]Object) string {
+	var elements []string
+	for _, e := range v {
+		elements = append(elements, e.String())
+	}
+	return fmt.Sprintf("set(%s)", strings.Join(elements, ", "))
+}
+
+func setContains(v map[HashKey]Object, x Object) (bool, error) {
+	key, ok := hashKeyOf(x)
+	if !ok {
+		return false, ErrNotHashable
+	}
+	_, ok = v[key]
+	return ok, nil
+}
+
+func setEquals(v map[HashKey]Object, x Object) bool {
+	var xVal map[HashKey]Object
+	switch x := x.(type) {
+	case *Set:
+		xVal = x.Value
+	case *ImmutableSet:
+		xVal = x.Value
+	default:
+		return false
+	}
+	if len(v) != len(xVal) {
+		return false
+	}
+	for k := range v {
+		if _, ok := xVal[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func setBinaryOp(
+	v map[HashKey]Object,
+	op token.Token,
+	rhs Object,
+) (Object, error) {
+	var rv map[HashKey]Object
+	switch rhs := rhs.(type) {
+	case *Set:
+		rv = rhs.Value
+	case *ImmutableSet:
+		rv = rhs.Value
+	default:
+		return nil, ErrInvalidOperator
+	}
+	res := make(map[HashKey]Object)
+	switch op {
+	case token.Or:
+		for k, e := range v {
+			res[k] = e
+		}
+		for k, e := range rv {
+			res[k] = e
+		}
+	case token.And:
+		for k, e := range v {
+			if _, ok := rv[k]; ok {
+				res[k] = e
+			}
+		}
+	case token.Sub:
+		for k, e := range v {
+			if _, ok := rv[k]; !ok {
+				res[k] = e
+			}
+		}
+	case token.Xor:
+		for k, e := range v {
+			if _, ok := rv[k]; !ok {
+				res[k] = e
+			}
+		}
+		for k, e := range rv {
+			if _, ok := v[k]; !ok {
+				res[k] = e
+			}
+		}
+	default:
+		return nil, ErrInvalidOperator
+	}
+	return &Set{Value: res}, nil
+}
+
+func copySet(v map[HashKey]Object) map[HashKey]Object {
+	c := make(map[HashKey]Object, len(v))
+	for k, e := range v {
+		c[k] = e
+	}
+	return c
+}
+
 // String represents a string value.
 type String struct {
 	ObjectImpl
@@ -1408,6 +2376,11 @@ func (o *String) Equals(x Object) bool {
 	return o.Value == t.Value
 }
 
+// HashKey returns the hash key of the value.
+func (o *String) HashKey() (HashKey, bool) {
+	return HashKey{Type: "string", Value: o.Value}, true
+}
+
 // IndexGet returns a character at a given index.
 func (o *String) IndexGet(index Object) (res Object, err error) {
 	intIdx, ok := index.(*Int)
@@ -1427,6 +2400,18 @@ func (o *String) IndexGet(index Object) (res Object, err error) {
 	return
 }
 
+// Contains returns true if the string contains the given substring or
+// character.
+func (o *String) Contains(x Object) (bool, error) {
+	switch x := x.(type) {
+	case *String:
+		return strings.Contains(o.Value, x.Value), nil
+	case *Char:
+		return strings.ContainsRune(o.Value, x.Value), nil
+	}
+	return false, ErrInvalidOperator
+}
+
 // Iterate creates a string iterator.
 func (o *String) Iterate() Iterator {
 	if o.runeStr == nil {
@@ -1524,6 +2509,14 @@ func (o *Time) Equals(x Object) bool {
 	return o.Value.Equal(t.Value)
 }
 
+// HashKey returns the hash key of the value.
+func (o *Time) HashKey() (HashKey, bool) {
+	return HashKey{
+		Type:  "time",
+		Value: [2]int64{o.Value.Unix(), int64(o.Value.Nanosecond())},
+	}, true
+}
+
 // Undefined represents an undefined value.
 type Undefined struct {
 	ObjectImpl
@@ -1587,8 +2580,9 @@ func (o *Undefined) Value() Object {
 // UserFunction represents a user function.
 type UserFunction struct {
 	ObjectImpl
-	Name  string
-	Value CallableFunc
+	Name    string
+	Value   CallableFunc
+	VMValue CallableVMFunc // used instead of Value if set
 }
 
 // TypeName returns the name of the type.
@@ -1602,7 +2596,7 @@ func (o *UserFunction) String() string {
 
 // Copy returns a copy of the type.
 func (o *UserFunction) Copy() Object {
-	return &UserFunction{Value: o.Value, Name: o.Name}
+	return &UserFunction{Value: o.Value, VMValue: o.VMValue, Name: o.Name}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -1613,6 +2607,14 @@ func (o *UserFunction) Equals(_ Object) bool {
 
 // Call invokes a user function.
 func (o *UserFunction) Call(args ...Object) (Object, error) {
+	return o.CallVM(nil, args...)
+}
+
+// CallVM invokes a user function with the calling VM.
+func (o *UserFunction) CallVM(vm *VM, args ...Object) (Object, error) {
+	if o.VMValue != nil {
+		return o.VMValue(vm, args...)
+	}
 	return o.Value(args...)
 }
 
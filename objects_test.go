@@ -1,6 +1,8 @@
 package tengo_test
 
 import (
+	"math"
+	"math/big"
 	"testing"
 
 	"github.com/d5/tengo/v2"
@@ -13,6 +15,10 @@ func TestObject_TypeName(t *testing.T) {
 	require.Equal(t, "int", o.TypeName())
 	o = &tengo.Float{}
 	require.Equal(t, "float", o.TypeName())
+	o = &tengo.BigInt{}
+	require.Equal(t, "big-int", o.TypeName())
+	o = &tengo.Decimal{}
+	require.Equal(t, "decimal", o.TypeName())
 	o = &tengo.Char{}
 	require.Equal(t, "char", o.TypeName())
 	o = &tengo.String{}
@@ -41,6 +47,12 @@ func TestObject_TypeName(t *testing.T) {
 	require.Equal(t, "error", o.TypeName())
 	o = &tengo.Bytes{}
 	require.Equal(t, "bytes", o.TypeName())
+	o = &tengo.Set{}
+	require.Equal(t, "set", o.TypeName())
+	o = &tengo.ImmutableSet{}
+	require.Equal(t, "immutable-set", o.TypeName())
+	o = &tengo.SetIterator{}
+	require.Equal(t, "set-iterator", o.TypeName())
 }
 
 func TestObject_IsFalsy(t *testing.T) {
@@ -50,6 +62,14 @@ func TestObject_IsFalsy(t *testing.T) {
 	require.False(t, o.IsFalsy())
 	o = &tengo.Float{Value: 0}
 	require.False(t, o.IsFalsy())
+	o = &tengo.BigInt{Value: big.NewInt(0)}
+	require.True(t, o.IsFalsy())
+	o = &tengo.BigInt{Value: big.NewInt(1)}
+	require.False(t, o.IsFalsy())
+	o = &tengo.Decimal{Value: big.NewInt(0), Scale: 2}
+	require.True(t, o.IsFalsy())
+	o = &tengo.Decimal{Value: big.NewInt(1), Scale: 2}
+	require.False(t, o.IsFalsy())
 	o = &tengo.Float{Value: 1}
 	require.False(t, o.IsFalsy())
 	o = &tengo.Char{Value: ' '}
@@ -86,6 +106,10 @@ func TestObject_IsFalsy(t *testing.T) {
 	require.True(t, o.IsFalsy())
 	o = &tengo.Bytes{Value: []byte{1, 2}}
 	require.False(t, o.IsFalsy())
+	o = &tengo.Set{}
+	require.True(t, o.IsFalsy())
+	o = newSet(&tengo.Int{Value: 1})
+	require.False(t, o.IsFalsy())
 }
 
 func TestObject_String(t *testing.T) {
@@ -125,6 +149,12 @@ func TestObject_String(t *testing.T) {
 	require.Equal(t, "", o.String())
 	o = &tengo.Bytes{Value: []byte("foo")}
 	require.Equal(t, "foo", o.String())
+	o = &tengo.Decimal{Value: big.NewInt(-5), Scale: 3}
+	require.Equal(t, "-0.005", o.String())
+	o = &tengo.Decimal{Value: big.NewInt(1230), Scale: 2}
+	require.Equal(t, "12.30", o.String())
+	o = &tengo.Decimal{Value: big.NewInt(0)}
+	require.Equal(t, "0", o.String())
 }
 
 func TestObject_BinaryOp(t *testing.T) {
@@ -214,6 +244,42 @@ func TestArray_BinaryOp(t *testing.T) {
 	}})
 }
 
+func TestSet_BinaryOp(t *testing.T) {
+	s12 := newSet(&tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	s23 := newSet(&tengo.Int{Value: 2}, &tengo.Int{Value: 3})
+	testBinaryOp(t, s12, token.Or, s23, newSet(&tengo.Int{Value: 1},
+		&tengo.Int{Value: 2}, &tengo.Int{Value: 3}))
+	testBinaryOp(t, s12, token.And, s23, newSet(&tengo.Int{Value: 2}))
+	testBinaryOp(t, s12, token.Sub, s23, newSet(&tengo.Int{Value: 1}))
+	testBinaryOp(t, s12, token.Xor, s23, newSet(&tengo.Int{Value: 1},
+		&tengo.Int{Value: 3}))
+	testBinaryOp(t, &tengo.ImmutableSet{Value: s12.Value}, token.Or,
+		&tengo.Set{}, s12)
+
+	_, err := s12.BinaryOp(token.Add, s23)
+	require.Equal(t, tengo.ErrInvalidOperator, err)
+	_, err = s12.BinaryOp(token.Or, &tengo.Array{})
+	require.Equal(t, tengo.ErrInvalidOperator, err)
+}
+
+func TestSet_Methods(t *testing.T) {
+	s := newSet(&tengo.Int{Value: 1})
+	add, err := s.IndexGet(&tengo.String{Value: "add"})
+	require.NoError(t, err)
+	add2, err := s.IndexGet(&tengo.String{Value: "add"})
+	require.NoError(t, err)
+	require.True(t, add == add2)
+	_, err = add.(*tengo.UserFunction).Call(&tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(s.Value))
+
+	ok, err := s.Contains(&tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = s.Contains(&tengo.Array{})
+	require.Equal(t, tengo.ErrNotHashable, err)
+}
+
 func TestError_Equals(t *testing.T) {
 	err1 := &tengo.Error{Value: &tengo.String{Value: "some error"}}
 	err2 := err1
@@ -706,6 +772,89 @@ func TestInt_Equals(t *testing.T) {
 	}
 }
 
+func TestBigInt_Equals(t *testing.T) {
+	one := &tengo.BigInt{Value: big.NewInt(1)}
+	require.True(t, one.Equals(&tengo.BigInt{Value: big.NewInt(1)}))
+	require.False(t, one.Equals(&tengo.BigInt{Value: big.NewInt(2)}))
+	require.True(t, one.Equals(&tengo.Int{Value: 1}))
+	require.True(t, (&tengo.Int{Value: 1}).Equals(one))
+	require.False(t, one.Equals(&tengo.Float{Value: 1}))
+
+	// equal values must have the same hash key
+	h1, ok := one.HashKey()
+	require.True(t, ok)
+	h2, ok := (&tengo.Int{Value: 1}).HashKey()
+	require.True(t, ok)
+	require.True(t, h1 == h2)
+}
+
+func TestDecimal_Round(t *testing.T) {
+	for _, c := range []struct {
+		in       string
+		places   int
+		halfEven string
+		halfUp   string
+		down     string
+	}{
+		{"2.5", 0, "2", "3", "2"},
+		{"3.5", 0, "4", "4", "3"},
+		{"-2.5", 0, "-2", "-3", "-2"},
+		{"2.51", 0, "3", "3", "2"},
+		{"-2.49", 0, "-2", "-2", "-2"},
+		{"0.125", 2, "0.12", "0.13", "0.12"},
+		{"0.135", 2, "0.14", "0.14", "0.13"},
+		{"1.5", 3, "1.500", "1.500", "1.500"},
+		{"150", -2, "200", "200", "100"},
+		{"250", -2, "200", "300", "200"},
+	} {
+		d, err := tengo.ParseDecimal(c.in)
+		require.NoError(t, err)
+		require.Equal(t, c.halfEven, d.Round(c.places, tengo.RoundHalfEven).String(), c.in)
+		require.Equal(t, c.halfUp, d.Round(c.places, tengo.RoundHalfUp).String(), c.in)
+		require.Equal(t, c.down, d.Round(c.places, tengo.RoundDown).String(), c.in)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for in, expected := range map[string]string{
+		"12.34":   "12.34",
+		"-12.340": "-12.340",
+		"+1":      "1",
+		".5":      "0.5",
+		"5.":      "5",
+		"1.5e3":   "1500",
+		"1.5E-3":  "0.0015",
+		"-0":      "0",
+	} {
+		d, err := tengo.ParseDecimal(in)
+		require.NoError(t, err, in)
+		require.Equal(t, expected, d.String(), in)
+	}
+	for _, in := range []string{"", ".", "-", "1e", "1.2.3", "1_000", "0x10",
+		"1e99999999", "abc", " 1"} {
+		_, err := tengo.ParseDecimal(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestDecimal_Equals(t *testing.T) {
+	d := &tengo.Decimal{Value: big.NewInt(100), Scale: 2}
+	require.True(t, d.Equals(&tengo.Decimal{Value: big.NewInt(1)}))
+	require.True(t, d.Equals(&tengo.Int{Value: 1}))
+	require.True(t, d.Equals(&tengo.BigInt{Value: big.NewInt(1)}))
+	require.True(t, (&tengo.Int{Value: 1}).Equals(d))
+	require.False(t, d.Equals(&tengo.Float{Value: 1}))
+	require.False(t, d.Equals(&tengo.Decimal{Value: big.NewInt(101), Scale: 2}))
+
+	// equal values must have the same hash key
+	h1, _ := d.HashKey()
+	h2, _ := (&tengo.Int{Value: 1}).HashKey()
+	require.True(t, h1 == h2)
+	h1, _ = (&tengo.Decimal{Value: big.NewInt(15), Scale: 1}).HashKey()
+	h2, _ = (&tengo.Decimal{Value: big.NewInt(1500), Scale: 3}).HashKey()
+	require.True(t, h1 == h2)
+}
+
 func TestFloat_Equals(t *testing.T) {
 	require.True(t, (&tengo.Float{Value: 1.5}).Equals(&tengo.Float{Value: 1.5}))
 	require.False(t, (&tengo.Float{Value: 1.5}).Equals(&tengo.Float{Value: 2.5}))
@@ -741,6 +890,73 @@ func TestMap_Index(t *testing.T) {
 	require.Equal(t, v, res)
 }
 
+func TestMap_Accessors(t *testing.T) {
+	m := &tengo.Map{Value: map[string]tengo.Object{
+		"a": &tengo.Int{Value: 1},
+	}}
+	require.NoError(t, m.IndexSet(&tengo.Int{Value: 1}, &tengo.Int{Value: 2}))
+	require.NoError(t, m.IndexSet(
+		&tengo.ImmutableArray{Value: []tengo.Object{&tengo.Char{Value: 'x'}}},
+		&tengo.Int{Value: 3}))
+	require.Equal(t, 3, m.Len())
+
+	v, ok := m.Get(&tengo.String{Value: "a"})
+	require.True(t, ok)
+	require.Equal(t, &tengo.Int{Value: 1}, v)
+	v, ok = m.Get(&tengo.Float{Value: 1})
+	require.True(t, ok)
+	require.Equal(t, &tengo.Int{Value: 2}, v)
+	v, ok = m.Get(
+		&tengo.ImmutableArray{Value: []tengo.Object{&tengo.Char{Value: 'x'}}})
+	require.True(t, ok)
+	require.Equal(t, &tengo.Int{Value: 3}, v)
+	_, ok = m.Get(&tengo.String{Value: "1"})
+	require.False(t, ok)
+	_, ok = m.Get(&tengo.Array{})
+	require.False(t, ok)
+
+	var sum int64
+	m.Range(func(key, value tengo.Object) bool {
+		sum += value.(*tengo.Int).Value
+		return true
+	})
+	require.Equal(t, int64(6), sum)
+
+	var n int
+	im := &tengo.ImmutableMap{Value: m.Value, Hashed: m.Hashed}
+	im.Range(func(key, value tengo.Object) bool {
+		n++
+		return false
+	})
+	require.Equal(t, 1, n)
+	require.Equal(t, 3, im.Len())
+}
+
+func TestImmutableArray_HashKey(t *testing.T) {
+	tuple := func(elems ...tengo.Object) *tengo.ImmutableArray {
+		return &tengo.ImmutableArray{Value: elems}
+	}
+	hashKey := func(o *tengo.ImmutableArray) tengo.HashKey {
+		k, ok := o.HashKey()
+		require.True(t, ok)
+		return k
+	}
+	one, two := &tengo.Int{Value: 1}, &tengo.Int{Value: 2}
+	require.True(t, hashKey(tuple(one, two)) ==
+		hashKey(tuple(&tengo.Float{Value: 1}, two)))
+	require.False(t, hashKey(tuple(one, two)) == hashKey(tuple(two, one)))
+	require.False(t, hashKey(tuple(tuple(one, two), two)) ==
+		hashKey(tuple(one, tuple(two, two))))
+	require.False(t, hashKey(tuple()) == hashKey(tuple(tuple())))
+	require.False(t, hashKey(tuple(one)) ==
+		hashKey(tuple(&tengo.String{Value: "1"})))
+
+	_, ok := tuple(one, &tengo.Array{}).HashKey()
+	require.False(t, ok)
+	_, ok = (&tengo.Float{Value: math.NaN()}).HashKey()
+	require.False(t, ok)
+}
+
 func TestString_BinaryOp(t *testing.T) {
 	lstr := "abcde"
 	rstr := "01234"
@@ -773,6 +989,14 @@ func testBinaryOp(
 	require.Equal(t, expected, actual)
 }
 
+func newSet(elements ...tengo.Object) *tengo.Set {
+	s, err := tengo.NewSet(elements...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
 func boolValue(b bool) tengo.Object {
 	if b {
 		return tengo.TrueValue
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"math/big"
 	"strings"
 
 	"github.com/d5/tengo/v2/token"
@@ -61,6 +62,30 @@ func (e *BadExpr) String() string {
 	return "<bad expression>"
 }
 
+// BigIntLit represents a big-int literal, an integer literal with the 'n'
+// suffix.
+type BigIntLit struct {
+	Value    *big.Int
+	ValuePos Pos
+	Literal  string
+}
+
+func (e *BigIntLit) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *BigIntLit) Pos() Pos {
+	return e.ValuePos
+}
+
+// End returns the position of first character immediately after the node.
+func (e *BigIntLit) End() Pos {
+	return Pos(int(e.ValuePos) + len(e.Literal))
+}
+
+func (e *BigIntLit) String() string {
+	return e.Literal
+}
+
 // BinaryExpr represents a binary operator expression.
 type BinaryExpr struct {
 	LHS      Expr
@@ -116,6 +141,7 @@ type CallExpr struct {
 	Args     []Expr
 	Ellipsis Pos
 	RParen   Pos
+	Optional bool // called with "?."
 }
 
 func (e *CallExpr) exprNode() {}
@@ -138,7 +164,31 @@ func (e *CallExpr) String() string {
 	if len(args) > 0 && e.Ellipsis.IsValid() {
 		args[len(args)-1] = args[len(args)-1] + "..."
 	}
-	return e.Func.String() + "(" + strings.Join(args, ", ") + ")"
+	return e.Func.String() + optionalString(e.Optional) + "(" +
+		strings.Join(args, ", ") + ")"
+}
+
+// ChainExpr represents a chain of selector, index, slice and call
+// expressions that contains an optional element, e.g. "a?.b.c". The chain
+// evaluates to undefined if the operand of an optional element is undefined.
+type ChainExpr struct {
+	Expr Expr
+}
+
+func (e *ChainExpr) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *ChainExpr) Pos() Pos {
+	return e.Expr.Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (e *ChainExpr) End() Pos {
+	return e.Expr.End()
+}
+
+func (e *ChainExpr) String() string {
+	return e.Expr.String()
 }
 
 // CharLit represents a character literal.
@@ -190,6 +240,30 @@ func (e *CondExpr) String() string {
 		" : " + e.False.String() + ")"
 }
 
+// DecimalLit represents a decimal literal, a number literal with the 'd'
+// suffix. Value is the literal without the suffix.
+type DecimalLit struct {
+	Value    string
+	ValuePos Pos
+	Literal  string
+}
+
+func (e *DecimalLit) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *DecimalLit) Pos() Pos {
+	return e.ValuePos
+}
+
+// End returns the position of first character immediately after the node.
+func (e *DecimalLit) End() Pos {
+	return Pos(int(e.ValuePos) + len(e.Literal))
+}
+
+func (e *DecimalLit) String() string {
+	return e.Literal
+}
+
 // ErrorExpr represents an error expression
 type ErrorExpr struct {
 	Expr     Expr
@@ -356,10 +430,11 @@ func (e *ImportExpr) String() string {
 
 // IndexExpr represents an index expression.
 type IndexExpr struct {
-	Expr   Expr
-	LBrack Pos
-	Index  Expr
-	RBrack Pos
+	Expr     Expr
+	LBrack   Pos
+	Index    Expr
+	RBrack   Pos
+	Optional bool // indexed with "?."
 }
 
 func (e *IndexExpr) exprNode() {}
@@ -379,7 +454,36 @@ func (e *IndexExpr) String() string {
 	if e.Index != nil {
 		index = e.Index.String()
 	}
-	return e.Expr.String() + "[" + index + "]"
+	return e.Expr.String() + optionalString(e.Optional) + "[" + index + "]"
+}
+
+// InterpStringLit represents an interpolated string literal.
+type InterpStringLit struct {
+	Parts []*StringLit // string parts around the expressions
+	Exprs []Expr       // interpolated expressions
+}
+
+func (e *InterpStringLit) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *InterpStringLit) Pos() Pos {
+	return e.Parts[0].Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (e *InterpStringLit) End() Pos {
+	return e.Parts[len(e.Parts)-1].End()
+}
+
+func (e *InterpStringLit) String() string {
+	var sb strings.Builder
+	for i, part := range e.Parts {
+		sb.WriteString(part.Literal)
+		if i < len(e.Exprs) {
+			sb.WriteString(e.Exprs[i].String())
+		}
+	}
+	return sb.String()
 }
 
 // IntLit represents an integer literal.
@@ -409,7 +513,7 @@ func (e *IntLit) String() string {
 type MapElementLit struct {
 	Key      string
 	KeyPos   Pos
-	ColonPos Pos
+	ColonPos Pos // position of ":"; or NoPos for shorthand "key"
 	Value    Expr
 }
 
@@ -426,9 +530,22 @@ func (e *MapElementLit) End() Pos {
 }
 
 func (e *MapElementLit) String() string {
+	if e.IsSpread() {
+		return e.Value.String()
+	}
+	if !e.ColonPos.IsValid() {
+		return e.Key
+	}
 	return e.Key + ": " + e.Value.String()
 }
 
+// IsSpread returns true if the element spreads a map ("src...") instead of
+// defining a single key.
+func (e *MapElementLit) IsSpread() bool {
+	_, ok := e.Value.(*SpreadExpr)
+	return ok && !e.ColonPos.IsValid()
+}
+
 // MapLit represents a map literal.
 type MapLit struct {
 	LBrace   Pos
@@ -481,8 +598,9 @@ func (e *ParenExpr) String() string {
 
 // SelectorExpr represents a selector expression.
 type SelectorExpr struct {
-	Expr Expr
-	Sel  Expr
+	Expr     Expr
+	Sel      Expr
+	Optional bool // selected with "?."
 }
 
 func (e *SelectorExpr) exprNode() {}
@@ -498,16 +616,20 @@ func (e *SelectorExpr) End() Pos {
 }
 
 func (e *SelectorExpr) String() string {
+	if e.Optional {
+		return e.Expr.String() + "?." + e.Sel.String()
+	}
 	return e.Expr.String() + "." + e.Sel.String()
 }
 
 // SliceExpr represents a slice expression.
 type SliceExpr struct {
-	Expr   Expr
-	LBrack Pos
-	Low    Expr
-	High   Expr
-	RBrack Pos
+	Expr     Expr
+	LBrack   Pos
+	Low      Expr
+	High     Expr
+	RBrack   Pos
+	Optional bool // sliced with "?."
 }
 
 func (e *SliceExpr) exprNode() {}
@@ -530,7 +652,31 @@ func (e *SliceExpr) String() string {
 	if e.High != nil {
 		high = e.High.String()
 	}
-	return e.Expr.String() + "[" + low + ":" + high + "]"
+	return e.Expr.String() + optionalString(e.Optional) + "[" + low + ":" +
+		high + "]"
+}
+
+// SpreadExpr represents an element of an array or map literal that is
+// spread with "...".
+type SpreadExpr struct {
+	Expr     Expr
+	Ellipsis Pos
+}
+
+func (e *SpreadExpr) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *SpreadExpr) Pos() Pos {
+	return e.Expr.Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (e *SpreadExpr) End() Pos {
+	return e.Ellipsis + 3
+}
+
+func (e *SpreadExpr) String() string {
+	return e.Expr.String() + "..."
 }
 
 // StringLit represents a string literal.
@@ -599,3 +745,10 @@ func (e *UndefinedLit) End() Pos {
 func (e *UndefinedLit) String() string {
 	return "undefined"
 }
+
+func optionalString(optional bool) string {
+	if optional {
+		return "?."
+	}
+	return ""
+}
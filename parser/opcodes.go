@@ -47,6 +47,23 @@ const (
 	OpIteratorValue               // Iterator value
 	OpBinaryOp                    // Binary operation
 	OpSuspend                     // Suspend VM
+	OpTry                         // Set up error handler
+	OpTryEnd                      // Remove error handlers
+	OpThrow                       // Rethrow error
+	OpDefer                       // Defer function call
+	OpConcat                      // Concatenate strings
+	OpUnpack                      // Unpack multiple values
+	OpUnpackIndex                 // Unpack elements of a pattern
+	OpChainJump                   // Optional chaining jump
+	OpCoalesceJump                // Nil-coalescing jump
+	OpYield                       // Yield value of generator
+	OpType                        // Record type object
+	OpMethod                      // Add method to record type
+	OpContains                    // Membership test 'in'
+	OpSpread                      // Mark a spread literal element
+	OpAssignLocal                 // Binary operation of a local and a constant
+	OpIndexLocals                 // Index a local with a local
+	OpReturnConst                 // Return a constant
 )
 
 // OpcodeNames are string representation of opcodes.
@@ -93,6 +110,23 @@ var OpcodeNames = [...]string{
 	OpIteratorValue: "ITVAL",
 	OpBinaryOp:      "BINARYOP",
 	OpSuspend:       "SUSPEND",
+	OpTry:           "TRY",
+	OpTryEnd:        "TRYEND",
+	OpThrow:         "THROW",
+	OpDefer:         "DEFER",
+	OpConcat:        "CONCAT",
+	OpUnpack:        "UNPACK",
+	OpUnpackIndex:   "UNPACKIDX",
+	OpChainJump:     "CHAINJMP",
+	OpCoalesceJump:  "COALJMP",
+	OpYield:         "YIELD",
+	OpType:          "TYPE",
+	OpMethod:        "METHOD",
+	OpContains:      "CONTAINS",
+	OpSpread:        "SPREAD",
+	OpAssignLocal:   "ASSIGNL",
+	OpIndexLocals:   "INDEXL",
+	OpReturnConst:   "RETC",
 }
 
 // OpcodeOperands is the number of operands.
@@ -139,6 +173,23 @@ var OpcodeOperands = [...][]int{
 	OpIteratorValue: {},
 	OpBinaryOp:      {1},
 	OpSuspend:       {},
+	OpTry:           {4, 1},
+	OpTryEnd:        {1},
+	OpThrow:         {},
+	OpDefer:         {1, 1},
+	OpConcat:        {2},
+	OpUnpack:        {1},
+	OpUnpackIndex:   {1},
+	OpChainJump:     {4},
+	OpCoalesceJump:  {4},
+	OpYield:         {},
+	OpType:          {2},
+	OpMethod:        {},
+	OpContains:      {},
+	OpSpread:        {},
+	OpAssignLocal:   {1, 2, 1},
+	OpIndexLocals:   {1, 1},
+	OpReturnConst:   {2},
 }
 
 // ReadOperands reads operands from the bytecode.
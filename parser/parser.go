@@ -3,8 +3,10 @@ package parser
 import (
 	"fmt"
 	"io"
+	"math/big"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/d5/tengo/v2/token"
 )
@@ -18,6 +20,10 @@ var stmtStart = map[token.Token]bool{
 	token.If:       true,
 	token.Return:   true,
 	token.Export:   true,
+	token.Try:      true,
+	token.Switch:   true,
+	token.Defer:    true,
+	token.Yield:    true,
 }
 
 // Error represents a parser error.
@@ -98,9 +104,10 @@ type Parser struct {
 	pos       Pos
 	token     token.Token
 	tokenLit  string
-	exprLevel int // < 0: in control clause, >= 0: in expression
-	syncPos   Pos // last sync position
-	syncCount int // number of advance calls without progress
+	exprLevel int  // < 0: in control clause, >= 0: in expression
+	forHeader bool // parsing the first clause of a for statement
+	syncPos   Pos  // last sync position
+	syncCount int  // number of advance calls without progress
 	trace     bool
 	indent    int
 	traceOut  io.Writer
@@ -177,12 +184,19 @@ func (p *Parser) parseBinaryExpr(prec1 int) Expr {
 	x := p.parseUnaryExpr()
 
 	for {
-		op, prec := p.token, p.token.Precedence()
+		op, prec := p.binaryOp()
 		if prec < prec1 {
 			return x
 		}
 
-		pos := p.expect(op)
+		var pos Pos
+		if op == token.NotIn {
+			pos = p.pos
+			p.next()
+			p.expect(token.In)
+		} else {
+			pos = p.expect(op)
+		}
 
 		y := p.parseBinaryExpr(prec + 1)
 
@@ -195,6 +209,21 @@ func (p *Parser) parseBinaryExpr(prec1 int) Expr {
 	}
 }
 
+// binaryOp returns the binary operator at the current token and its
+// precedence. 'not' followed by 'in' is the 'not in' operator, and 'in' is not
+// an operator in the first clause of a for statement, unless parenthesized,
+// so that it's parsed as a for-in statement.
+func (p *Parser) binaryOp() (token.Token, int) {
+	switch {
+	case p.token == token.Ident && p.tokenLit == "not" &&
+		p.peek(1)[0] == token.In:
+		return token.NotIn, token.NotIn.Precedence()
+	case p.token == token.In && p.forHeader && p.exprLevel < 0:
+		return p.token, token.LowestPrec
+	}
+	return p.token, p.token.Precedence()
+}
+
 func (p *Parser) parseCondExpr(cond Expr) Expr {
 	questionPos := p.expect(token.Question)
 	trueExpr := p.parseExpr()
@@ -235,6 +264,7 @@ func (p *Parser) parsePrimaryExpr() Expr {
 	}
 
 	x := p.parseOperand()
+	var chain bool
 
 L:
 	for {
@@ -244,25 +274,45 @@ L:
 
 			switch p.token {
 			case token.Ident:
-				x = p.parseSelector(x)
+				x = p.parseSelector(x, false)
 			default:
 				pos := p.pos
 				p.errorExpected(pos, "selector")
 				p.advance(stmtStart)
 				return &BadExpr{From: pos, To: p.pos}
 			}
+		case token.QuestionDot:
+			p.next()
+			chain = true
+
+			switch p.token {
+			case token.Ident:
+				x = p.parseSelector(x, true)
+			case token.LBrack:
+				x = p.parseIndexOrSlice(x, true)
+			case token.LParen:
+				x = p.parseCall(x, true)
+			default:
+				pos := p.pos
+				p.errorExpected(pos, "selector, index or call")
+				p.advance(stmtStart)
+				return &BadExpr{From: pos, To: p.pos}
+			}
 		case token.LBrack:
-			x = p.parseIndexOrSlice(x)
+			x = p.parseIndexOrSlice(x, false)
 		case token.LParen:
-			x = p.parseCall(x)
+			x = p.parseCall(x, false)
 		default:
 			break L
 		}
 	}
+	if chain {
+		return &ChainExpr{Expr: x}
+	}
 	return x
 }
 
-func (p *Parser) parseCall(x Expr) *CallExpr {
+func (p *Parser) parseCall(x Expr, optional bool) *CallExpr {
 	if p.trace {
 		defer untracep(tracep(p, "Call"))
 	}
@@ -291,6 +341,7 @@ func (p *Parser) parseCall(x Expr) *CallExpr {
 		RParen:   rparen,
 		Ellipsis: ellipsis,
 		Args:     list,
+		Optional: optional,
 	}
 }
 
@@ -311,7 +362,7 @@ func (p *Parser) expectComma(closing token.Token, want string) bool {
 	return false
 }
 
-func (p *Parser) parseIndexOrSlice(x Expr) Expr {
+func (p *Parser) parseIndexOrSlice(x Expr, optional bool) Expr {
 	if p.trace {
 		defer untracep(tracep(p, "IndexOrSlice"))
 	}
@@ -339,22 +390,24 @@ func (p *Parser) parseIndexOrSlice(x Expr) Expr {
 	if numColons > 0 {
 		// slice expression
 		return &SliceExpr{
-			Expr:   x,
-			LBrack: lbrack,
-			RBrack: rbrack,
-			Low:    index[0],
-			High:   index[1],
+			Expr:     x,
+			LBrack:   lbrack,
+			RBrack:   rbrack,
+			Low:      index[0],
+			High:     index[1],
+			Optional: optional,
 		}
 	}
 	return &IndexExpr{
-		Expr:   x,
-		LBrack: lbrack,
-		RBrack: rbrack,
-		Index:  index[0],
+		Expr:     x,
+		LBrack:   lbrack,
+		RBrack:   rbrack,
+		Index:    index[0],
+		Optional: optional,
 	}
 }
 
-func (p *Parser) parseSelector(x Expr) Expr {
+func (p *Parser) parseSelector(x Expr, optional bool) Expr {
 	if p.trace {
 		defer untracep(tracep(p, "Selector"))
 	}
@@ -364,7 +417,7 @@ func (p *Parser) parseSelector(x Expr) Expr {
 		Value:    sel.Name,
 		ValuePos: sel.NamePos,
 		Literal:  sel.Name,
-	}}
+	}, Optional: optional}
 }
 
 func (p *Parser) parseOperand() Expr {
@@ -376,6 +429,20 @@ func (p *Parser) parseOperand() Expr {
 	case token.Ident:
 		return p.parseIdent()
 	case token.Int:
+		if strings.HasSuffix(p.tokenLit, "n") {
+			v, ok := new(big.Int).SetString(
+				strings.TrimSuffix(p.tokenLit, "n"), 0)
+			if !ok {
+				p.error(p.pos, "invalid integer")
+			}
+			x := &BigIntLit{
+				Value:    v,
+				ValuePos: p.pos,
+				Literal:  p.tokenLit,
+			}
+			p.next()
+			return x
+		}
 		v, err := strconv.ParseInt(p.tokenLit, 0, 64)
 		if err == strconv.ErrRange {
 			p.error(p.pos, "number out of range")
@@ -391,6 +458,18 @@ func (p *Parser) parseOperand() Expr {
 		return x
 
 	case token.Float:
+		if strings.HasSuffix(p.tokenLit, "d") {
+			if strings.ContainsAny(p.tokenLit, "_pP") {
+				p.error(p.pos, "invalid decimal")
+			}
+			x := &DecimalLit{
+				Value:    strings.TrimSuffix(p.tokenLit, "d"),
+				ValuePos: p.pos,
+				Literal:  p.tokenLit,
+			}
+			p.next()
+			return x
+		}
 		v, err := strconv.ParseFloat(p.tokenLit, 64)
 		if err == strconv.ErrRange {
 			p.error(p.pos, "number out of range")
@@ -407,14 +486,15 @@ func (p *Parser) parseOperand() Expr {
 	case token.Char:
 		return p.parseCharLit()
 	case token.String:
-		v, _ := strconv.Unquote(p.tokenLit)
 		x := &StringLit{
-			Value:    v,
+			Value:    stringValue(p.token, p.tokenLit, p.tokenLit[0] == '`'),
 			ValuePos: p.pos,
 			Literal:  p.tokenLit,
 		}
 		p.next()
 		return x
+	case token.StringHead:
+		return p.parseInterpStringLit()
 	case token.True:
 		x := &BoolLit{
 			Value:    true,
@@ -479,7 +559,7 @@ func (p *Parser) parseImportExpr() Expr {
 	}
 
 	// module name
-	moduleName, _ := strconv.Unquote(p.tokenLit)
+	moduleName := stringValue(p.token, p.tokenLit, p.tokenLit[0] == '`')
 	expr := &ImportExpr{
 		ModuleName: moduleName,
 		Token:      token.Import,
@@ -491,6 +571,40 @@ func (p *Parser) parseImportExpr() Expr {
 	return expr
 }
 
+func (p *Parser) parseInterpStringLit() Expr {
+	if p.trace {
+		defer untracep(tracep(p, "InterpStringLit"))
+	}
+
+	pos := p.pos
+	raw := p.tokenLit[0] == '`'
+	x := &InterpStringLit{}
+	for {
+		x.Parts = append(x.Parts, &StringLit{
+			Value:    stringValue(p.token, p.tokenLit, raw),
+			ValuePos: p.pos,
+			Literal:  p.tokenLit,
+		})
+		if p.token == token.StringTail {
+			p.next()
+			return x
+		}
+		p.next()
+
+		p.exprLevel++
+		x.Exprs = append(x.Exprs, p.parseExpr())
+		p.exprLevel--
+		if p.token == token.Semicolon && p.tokenLit == "\n" {
+			p.next() // newline before the closing "}"
+		}
+		if p.token != token.StringMid && p.token != token.StringTail {
+			p.errorExpected(p.pos, "'}'")
+			p.advance(stmtStart)
+			return &BadExpr{From: pos, To: p.pos}
+		}
+	}
+}
+
 func (p *Parser) parseCharLit() Expr {
 	if n := len(p.tokenLit); n >= 3 {
 		code, _, _, err := strconv.UnquoteChar(p.tokenLit[1:n-1], '\'')
@@ -539,7 +653,12 @@ func (p *Parser) parseArrayLit() Expr {
 
 	var elements []Expr
 	for p.token != token.RBrack && p.token != token.EOF {
-		elements = append(elements, p.parseExpr())
+		elem := p.parseExpr()
+		if p.token == token.Ellipsis {
+			elem = &SpreadExpr{Expr: elem, Ellipsis: p.pos}
+			p.next()
+		}
+		elements = append(elements, elem)
 
 		if !p.expectComma(token.RBrack, "array element") {
 			break
@@ -618,7 +737,14 @@ func (p *Parser) parseStmtList() (list []Stmt) {
 		defer untracep(tracep(p, "StatementList"))
 	}
 
-	for p.token != token.RBrace && p.token != token.EOF {
+	// statements in a block, e.g. of a function literal, are not in the
+	// header of the enclosing for statement
+	prevHeader := p.forHeader
+	p.forHeader = false
+	defer func() { p.forHeader = prevHeader }()
+
+	for p.token != token.RBrace && p.token != token.EOF &&
+		p.token != token.Case && p.token != token.Default {
 		list = append(list, p.parseStmt())
 	}
 	return
@@ -680,9 +806,24 @@ func (p *Parser) parseStmt() (stmt Stmt) {
 	}
 
 	switch p.token {
+	case token.Func:
+		if p.isMethodStmt() {
+			return p.parseMethodStmt()
+		}
+		s := p.parseSimpleStmt(false)
+		p.expectSemi()
+		return s
+	case token.Ident:
+		if p.isTypeStmt() {
+			return p.parseTypeStmt()
+		}
+		s := p.parseSimpleStmt(false)
+		p.expectSemi()
+		return s
 	case // simple statements
-		token.Func, token.Error, token.Immutable, token.Ident, token.Int,
-		token.Float, token.Char, token.String, token.True, token.False,
+		token.Error, token.Immutable, token.Int,
+		token.Float, token.Char, token.String, token.StringHead, token.True,
+		token.False,
 		token.Undefined, token.Import, token.LParen, token.LBrace,
 		token.LBrack, token.Add, token.Sub, token.Mul, token.And, token.Xor,
 		token.Not:
@@ -697,6 +838,14 @@ func (p *Parser) parseStmt() (stmt Stmt) {
 		return p.parseIfStmt()
 	case token.For:
 		return p.parseForStmt()
+	case token.Switch:
+		return p.parseSwitchStmt()
+	case token.Try:
+		return p.parseTryStmt()
+	case token.Defer:
+		return p.parseDeferStmt()
+	case token.Yield:
+		return p.parseYieldStmt()
 	case token.Break, token.Continue:
 		return p.parseBranchStmt(p.token)
 	case token.Semicolon:
@@ -737,7 +886,10 @@ func (p *Parser) parseForStmt() Stmt {
 
 	var s1 Stmt
 	if p.token != token.Semicolon { // skipping init
+		prevHeader := p.forHeader
+		p.forHeader = true
 		s1 = p.parseSimpleStmt(true)
+		p.forHeader = prevHeader
 	}
 
 	// for _ in seq {}            or
@@ -836,6 +988,100 @@ func (p *Parser) parseIfStmt() Stmt {
 	}
 }
 
+func (p *Parser) parseSwitchStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "SwitchStmt"))
+	}
+
+	pos := p.expect(token.Switch)
+
+	var tag Expr
+	if p.token != token.LBrace {
+		outer := p.exprLevel
+		p.exprLevel = -1
+		tag = p.parseExpr()
+		p.exprLevel = outer
+	}
+
+	lbrace := p.expect(token.LBrace)
+	var body []*CaseClause
+	var hasDefault bool
+	for p.token == token.Case || p.token == token.Default {
+		clause := p.parseCaseClause()
+		if clause.List == nil {
+			if hasDefault {
+				p.error(clause.CasePos, "multiple defaults in switch")
+			}
+			hasDefault = true
+		}
+		body = append(body, clause)
+	}
+	rbrace := p.expect(token.RBrace)
+	p.expectSemi()
+
+	return &SwitchStmt{
+		SwitchPos: pos,
+		Tag:       tag,
+		LBrace:    lbrace,
+		Body:      body,
+		RBrace:    rbrace,
+	}
+}
+
+func (p *Parser) parseCaseClause() *CaseClause {
+	if p.trace {
+		defer untracep(tracep(p, "CaseClause"))
+	}
+
+	pos := p.pos
+	var list []Expr
+	if p.token == token.Case {
+		p.next()
+		list = p.parseExprList()
+	} else {
+		p.expect(token.Default)
+	}
+	colon := p.expect(token.Colon)
+	body := p.parseStmtList()
+
+	return &CaseClause{
+		CasePos: pos,
+		List:    list,
+		Colon:   colon,
+		Body:    body,
+	}
+}
+
+func (p *Parser) parseTryStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "TryStmt"))
+	}
+
+	pos := p.expect(token.Try)
+	stmt := &TryStmt{
+		TryPos: pos,
+		Body:   p.parseBlockStmt(),
+	}
+	if p.token == token.Catch {
+		stmt.CatchPos = p.pos
+		p.next()
+		if p.token == token.Ident {
+			stmt.Ident = p.parseIdent()
+		}
+		stmt.Catch = p.parseBlockStmt()
+	}
+	if p.token == token.Finally {
+		stmt.FinallyPos = p.pos
+		p.next()
+		stmt.Finally = p.parseBlockStmt()
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorExpected(p.pos, "catch or finally")
+	}
+	p.expectSemi()
+	return stmt
+}
+
 func (p *Parser) parseBlockStmt() *BlockStmt {
 	if p.trace {
 		defer untracep(tracep(p, "BlockStmt"))
@@ -913,14 +1159,134 @@ func (p *Parser) parseReturnStmt() Stmt {
 	pos := p.pos
 	p.expect(token.Return)
 
+	var x []Expr
+	if p.token != token.Semicolon && p.token != token.RBrace {
+		x = p.parseExprList()
+	}
+	p.expectSemi()
+	s := &ReturnStmt{ReturnPos: pos}
+	if len(x) == 1 {
+		s.Result = x[0]
+	} else {
+		s.Results = x
+	}
+	return s
+}
+
+func (p *Parser) parseYieldStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "YieldStmt"))
+	}
+
+	pos := p.pos
+	p.expect(token.Yield)
+
 	var x Expr
 	if p.token != token.Semicolon && p.token != token.RBrace {
 		x = p.parseExpr()
 	}
 	p.expectSemi()
-	return &ReturnStmt{
-		ReturnPos: pos,
-		Result:    x,
+	return &YieldStmt{
+		YieldPos: pos,
+		Result:   x,
+	}
+}
+
+func (p *Parser) parseTypeStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "TypeStmt"))
+	}
+
+	pos := p.pos
+	p.next() // "type"
+	name := p.parseIdent()
+	lbrace := p.expect(token.LBrace)
+
+	// fields are separated by commas or newlines
+	var fields []*Ident
+	for p.token != token.RBrace && p.token != token.EOF {
+		fields = append(fields, p.parseIdent())
+		if p.token != token.Comma && p.token != token.Semicolon {
+			break
+		}
+		p.next()
+	}
+
+	rbrace := p.expect(token.RBrace)
+	p.expectSemi()
+	return &TypeStmt{
+		TypePos: pos,
+		Name:    name,
+		LBrace:  lbrace,
+		Fields:  fields,
+		RBrace:  rbrace,
+	}
+}
+
+// isTypeStmt reports whether the identifier "type" starts a type
+// declaration, "type Name {...}". Otherwise "type" is a plain identifier.
+func (p *Parser) isTypeStmt() bool {
+	if p.tokenLit != token.Type.String() {
+		return false
+	}
+	toks := p.peek(2)
+	return toks[0] == token.Ident && toks[1] == token.LBrace
+}
+
+// isMethodStmt reports whether the "func" keyword starts a method
+// declaration, "func (recv Type) name(...) {...}", rather than a function
+// literal.
+func (p *Parser) isMethodStmt() bool {
+	toks := p.peek(3)
+	return toks[0] == token.LParen && toks[1] == token.Ident &&
+		toks[2] == token.Ident
+}
+
+func (p *Parser) parseMethodStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "MethodStmt"))
+	}
+
+	pos := p.expect(token.Func)
+	p.expect(token.LParen)
+	recv := p.parseIdent()
+	recvType := p.parseIdent()
+	p.expect(token.RParen)
+	name := p.parseIdent()
+	params := p.parseIdentList()
+	p.exprLevel++
+	body := p.parseBody()
+	p.exprLevel--
+	p.expectSemi()
+	return &MethodStmt{
+		Recv:     recv,
+		RecvType: recvType,
+		Name:     name,
+		Type: &FuncType{
+			FuncPos: pos,
+			Params:  params,
+		},
+		Body: body,
+	}
+}
+
+func (p *Parser) parseDeferStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "DeferStmt"))
+	}
+
+	pos := p.pos
+	p.expect(token.Defer)
+	x := p.parseExpr()
+	p.expectSemi()
+	call, ok := x.(*CallExpr)
+	if !ok {
+		p.error(x.Pos(), "expression in defer must be function call")
+		return &BadStmt{From: pos, To: x.End()}
+	}
+	return &DeferStmt{
+		DeferPos: pos,
+		Call:     call,
 	}
 }
 
@@ -960,6 +1326,7 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 	case token.In:
 		if forIn {
 			p.next()
+			p.forHeader = false
 			y := p.parseExpr()
 
 			var key, value *Ident
@@ -1040,16 +1407,28 @@ func (p *Parser) parseMapElementLit() *MapElementLit {
 	}
 
 	pos := p.pos
+	if !p.atMapKey() {
+		return p.parseMapSpreadLit()
+	}
+
 	name := "_"
-	if p.token == token.Ident {
+	isIdent := p.token == token.Ident
+	if isIdent || p.token.IsKeyword() {
 		name = p.tokenLit
 	} else if p.token == token.String {
-		v, _ := strconv.Unquote(p.tokenLit)
-		name = v
+		name = stringValue(p.token, p.tokenLit, p.tokenLit[0] == '`')
 	} else {
 		p.errorExpected(pos, "map key")
 	}
 	p.next()
+	if isIdent && p.token != token.Colon {
+		// shorthand element of a destructuring pattern
+		return &MapElementLit{
+			Key:    name,
+			KeyPos: pos,
+			Value:  &Ident{Name: name, NamePos: pos},
+		}
+	}
 	colonPos := p.expect(token.Colon)
 	valueExpr := p.parseExpr()
 	return &MapElementLit{
@@ -1060,6 +1439,42 @@ func (p *Parser) parseMapElementLit() *MapElementLit {
 	}
 }
 
+// atMapKey reports whether the current token is the key of a map element,
+// rather than the start of a spread element.
+func (p *Parser) atMapKey() bool {
+	switch p.token {
+	case token.String:
+		return p.peek(1)[0] == token.Colon
+	case token.Ident:
+		switch p.peek(1)[0] {
+		case token.Colon, token.Comma, token.RBrace, token.Semicolon,
+			token.EOF:
+			return true
+		}
+	default:
+		// keywords can be used as keys followed by a colon
+		return p.token.IsKeyword() && p.peek(1)[0] == token.Colon
+	}
+	return false
+}
+
+// parseMapSpreadLit parses a "src..." element of a map literal. The element
+// has no key and its value is a SpreadExpr.
+func (p *Parser) parseMapSpreadLit() *MapElementLit {
+	pos := p.pos
+	expr := p.parseExpr()
+	if p.token != token.Ellipsis {
+		p.errorExpected(pos, "map key")
+		return &MapElementLit{KeyPos: pos, Value: expr}
+	}
+	ellipsis := p.pos
+	p.next()
+	return &MapElementLit{
+		KeyPos: pos,
+		Value:  &SpreadExpr{Expr: expr, Ellipsis: ellipsis},
+	}
+}
+
 func (p *Parser) parseMapLit() *MapLit {
 	if p.trace {
 		defer untracep(tracep(p, "MapLit"))
@@ -1174,6 +1589,19 @@ func (p *Parser) next() {
 	p.token, p.tokenLit, p.pos = p.scanner.Scan()
 }
 
+// peek returns the next n tokens after the current one without consuming
+// them.
+func (p *Parser) peek(n int) []token.Token {
+	s := *p.scanner
+	s.interps = append([]interp(nil), s.interps...)
+	s.errorHandler = nil
+	toks := make([]token.Token, n)
+	for i := range toks {
+		toks[i], _, _ = s.Scan()
+	}
+	return toks
+}
+
 func (p *Parser) printTrace(a ...interface{}) {
 	const (
 		dots = ". . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . "
@@ -1212,3 +1640,36 @@ func untracep(p *Parser) {
 	p.indent--
 	p.printTrace(")")
 }
+
+// stringValue returns the value of a string literal, or a part of an
+// interpolated string literal, of the token tok. A dollar sign followed by
+// "{" can be escaped with a backslash, in raw string literals as well.
+func stringValue(tok token.Token, lit string, raw bool) string {
+	// strip the opening quote or "}", and the closing quote or "${"
+	start, end := 1, len(lit)-1
+	if tok == token.StringHead || tok == token.StringMid {
+		end--
+	}
+	if end < start {
+		return ""
+	}
+	body := lit[start:end]
+	if raw {
+		return strings.ReplaceAll(body, `\${`, "${")
+	}
+	if strings.Contains(body, `\$`) {
+		var sb strings.Builder
+		for i := 0; i < len(body); i++ {
+			if body[i] == '\\' && i+1 < len(body) {
+				i++
+				if body[i] != '$' {
+					sb.WriteByte('\\')
+				}
+			}
+			sb.WriteByte(body[i])
+		}
+		body = sb.String()
+	}
+	v, _ := strconv.Unquote(`"` + body + `"`)
+	return v
+}
@@ -3,6 +3,7 @@ package parser_test
 import (
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
@@ -250,6 +251,44 @@ func TestParseAssignment(t *testing.T) {
 				token.MulAssign,
 				p(1, 3)))
 	})
+
+	expectParse(t, "a, b := f()", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(
+					ident("a", p(1, 1)),
+					ident("b", p(1, 4))),
+				exprs(
+					callExpr(ident("f", p(1, 9)), p(1, 10), p(1, 11), NoPos)),
+				token.Define,
+				p(1, 6)))
+	})
+
+	expectParse(t, "[x, y] := arr", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(arrayLit(p(1, 1), p(1, 6),
+					ident("x", p(1, 2)),
+					ident("y", p(1, 5)))),
+				exprs(ident("arr", p(1, 11))),
+				token.Define,
+				p(1, 8)))
+	})
+
+	expectParse(t, "{name, age: n} := m", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(mapLit(p(1, 1), p(1, 14),
+					mapElementLit("name", p(1, 2), NoPos,
+						ident("name", p(1, 2))),
+					mapElementLit("age", p(1, 8), p(1, 11),
+						ident("n", p(1, 13))))),
+				exprs(ident("m", p(1, 19))),
+				token.Define,
+				p(1, 16)))
+	})
+
+	expectParseString(t, "{a, b: [c, _]} = m", "{a, b: [c, _]} = m")
 }
 
 func TestParseBoolean(t *testing.T) {
@@ -443,6 +482,53 @@ func TestParseCall(t *testing.T) {
 	expectParseError(t, `add(...a)`)
 }
 
+func TestParseChain(t *testing.T) {
+	expectParse(t, "a?.b.c", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				chainExpr(
+					selectorExpr(
+						optional(selectorExpr(
+							ident("a", p(1, 1)),
+							stringLit("b", p(1, 4)))),
+						stringLit("c", p(1, 6))))))
+	})
+
+	expectParse(t, "f?.(x)?.[0]", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				chainExpr(
+					optional(indexExpr(
+						optional(callExpr(
+							ident("f", p(1, 1)),
+							p(1, 4), p(1, 6), NoPos,
+							ident("x", p(1, 5)))),
+						intLit(0, p(1, 10)),
+						p(1, 9), p(1, 11))))))
+	})
+
+	expectParse(t, "a ?? b", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				binaryExpr(
+					ident("a", p(1, 1)),
+					ident("b", p(1, 6)),
+					token.Coalesce,
+					p(1, 3))))
+	})
+
+	expectParseString(t, "a?.b?.[c]?.(d)", "a?.b?.[c]?.(d)")
+	expectParseString(t, "a?.[1:]", "a?.[1:]")
+	expectParseString(t, "f(a?.b)", "f(a?.b)")
+	expectParseString(t, "a ?? b || c", "((a ?? b) || c)")
+	expectParseString(t, "a ?? b && c", "(a ?? (b && c))")
+	expectParseString(t, "x ?? y?.z ?? 1", "((x ?? y?.z) ?? 1)")
+	expectParseString(t, "a ?.5 : b", "(a ? .5 : b)")
+
+	expectParseError(t, "a?.+")
+	expectParseError(t, "a?.1")
+}
+
 func TestParseChar(t *testing.T) {
 	expectParse(t, `'A'`, func(p pfn) []Stmt {
 		return stmts(
@@ -505,6 +591,47 @@ c`, func(p pfn) []Stmt {
 	expectParseError(t, `(a ? b) : e`)
 }
 
+func TestParseDefer(t *testing.T) {
+	expectParse(t, "defer f(a, b...)", func(p pfn) []Stmt {
+		return stmts(
+			deferStmt(p(1, 1),
+				callExpr(
+					ident("f", p(1, 7)),
+					p(1, 8), p(1, 16), p(1, 13),
+					ident("a", p(1, 9)),
+					ident("b", p(1, 12)))))
+	})
+
+	expectParse(t, "defer a.close()", func(p pfn) []Stmt {
+		return stmts(
+			deferStmt(p(1, 1),
+				callExpr(
+					selectorExpr(
+						ident("a", p(1, 7)),
+						stringLit("close", p(1, 9))),
+					p(1, 14), p(1, 15), NoPos)))
+	})
+
+	expectParseString(t, "defer func() { a = 1 }()", "defer func() {a = 1}()")
+	expectParseString(t, "defer f(a, b...)", "defer f(a, b...)")
+
+	// defer is allowed as a selector and a map key
+	expectParse(t, "{defer: 1}.defer", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				selectorExpr(
+					mapLit(p(1, 1), p(1, 10),
+						mapElementLit(
+							"defer", p(1, 2), p(1, 7), intLit(1, p(1, 9)))),
+					stringLit("defer", p(1, 12)))))
+	})
+	expectParseString(t, "defer a.defer()", "defer a.defer()")
+
+	expectParseError(t, "defer f")
+	expectParseError(t, "defer (f())")
+	expectParseError(t, "defer")
+}
+
 func TestParseError(t *testing.T) {
 	expectParse(t, `error(1234)`, func(p pfn) []Stmt {
 		return stmts(
@@ -603,6 +730,47 @@ func TestParseForIn(t *testing.T) {
 	})
 }
 
+func TestParseIn(t *testing.T) {
+	expectParse(t, "a in b", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				binaryExpr(
+					ident("a", p(1, 1)),
+					ident("b", p(1, 6)),
+					token.In,
+					p(1, 3))))
+	})
+
+	expectParse(t, "a not in b", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				binaryExpr(
+					ident("a", p(1, 1)),
+					ident("b", p(1, 10)),
+					token.NotIn,
+					p(1, 3))))
+	})
+
+	expectParseString(t, "a + b in c", "((a + b) in c)")
+	expectParseString(t, "a in b && c not in d",
+		"((a in b) && (c not in d))")
+	expectParseString(t, "a in b == c", "((a in b) == c)")
+	expectParseString(t, "!(a in b)", "(!((a in b)))")
+	expectParseString(t, "not in b", "(not in b)")
+	expectParseString(t, "not := 1", "not := 1")
+	expectParseString(t, "for x in a in b {}", "for _, x in (a in b) {}")
+	expectParseString(t, "for (x in y) {}", "for ((x in y)) {}")
+	expectParseString(t, "for i := 0; i in a; i++ {}",
+		"for i := 0 ; (i in a)  ; i++{}")
+	expectParseString(t, "for x in y { if a in b {} }",
+		"for _, x in y {if (a in b) {}}")
+	expectParseString(t, "for f := func() { a in b }; f; {}",
+		"for f := func() {(a in b)} ; f  ; {}")
+
+	expectParseError(t, "a not b")
+	expectParseError(t, "a in")
+}
+
 func TestParseFor(t *testing.T) {
 	expectParse(t, "for {}", func(p pfn) []Stmt {
 		return stmts(
@@ -732,6 +900,22 @@ func TestParseFunction(t *testing.T) {
 				token.Assign,
 				p(1, 3)))
 	})
+	expectParse(t, "a = func() { return b, c }", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(ident("a", p(1, 1))),
+				exprs(
+					funcLit(
+						funcType(
+							identList(p(1, 9), p(1, 10), false),
+							p(1, 5)),
+						blockStmt(p(1, 12), p(1, 26),
+							returnStmts(p(1, 14),
+								ident("b", p(1, 21)),
+								ident("c", p(1, 24)))))),
+				token.Assign,
+				p(1, 3)))
+	})
 }
 
 func TestParseVariadicFunction(t *testing.T) {
@@ -1486,6 +1670,46 @@ func TestParseSemicolon(t *testing.T) {
 	})
 }
 
+func TestParseSpread(t *testing.T) {
+	expectParse(t, "[a..., 1, f()...]", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				arrayLit(p(1, 1), p(1, 17),
+					spreadExpr(ident("a", p(1, 2)), p(1, 3)),
+					intLit(1, p(1, 8)),
+					spreadExpr(
+						callExpr(ident("f", p(1, 11)), p(1, 12), p(1, 13),
+							NoPos),
+						p(1, 14)))))
+	})
+
+	expectParse(t, "{a..., b: 1, c.d...}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 20),
+					mapElementLit(
+						"", p(1, 2), NoPos,
+						spreadExpr(ident("a", p(1, 2)), p(1, 3))),
+					mapElementLit(
+						"b", p(1, 8), p(1, 9), intLit(1, p(1, 11))),
+					mapElementLit(
+						"", p(1, 14), NoPos,
+						spreadExpr(
+							selectorExpr(
+								ident("c", p(1, 14)),
+								stringLit("d", p(1, 16))),
+							p(1, 17))))))
+	})
+
+	expectParseString(t, "[a..., 1]", "[a..., 1]")
+	expectParseString(t, "{a..., b: 1}", "{a..., b: 1}")
+
+	expectParseError(t, `[...]`)
+	expectParseError(t, `{1: 2}`)
+	expectParseError(t, `{a + b}`)
+	expectParseError(t, `{a...: 1}`)
+}
+
 func TestParseString(t *testing.T) {
 	expectParse(t, `a = "foo\nbar"`, func(p pfn) []Stmt {
 		return stmts(
@@ -1504,6 +1728,295 @@ func TestParseString(t *testing.T) {
 				token.Assign,
 				p(1, 3)))
 	})
+
+	expectParse(t, `a = "id=${id} name=${user.name}!"`, func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(ident("a", p(1, 1))),
+				exprs(interpStringLit(
+					parts(
+						stringLit("id=", p(1, 5)),
+						stringLit(" name=", p(1, 13)),
+						stringLit("!", p(1, 31))),
+					ident("id", p(1, 11)),
+					selectorExpr(
+						ident("user", p(1, 22)),
+						stringLit("name", p(1, 27))))),
+				token.Assign,
+				p(1, 3)))
+	})
+
+	expectParse(t, "`${a}\n${b + 1}`", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				interpStringLit(
+					parts(
+						stringLit("", p(1, 1)),
+						stringLit("\n", p(1, 5)),
+						stringLit("", p(2, 8))),
+					ident("a", p(1, 4)),
+					binaryExpr(
+						ident("b", p(2, 3)),
+						intLit(1, p(2, 7)),
+						token.Add,
+						p(2, 5)))))
+	})
+
+	expectParse(t, `"\${a}\\"; `+"`\\${a}\\`", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(stringLit("${a}\\", p(1, 1))),
+			exprStmt(stringLit("${a}\\", p(1, 12))))
+	})
+
+	expectParseString(t, `"a ${b} c ${ {d: "${e}"}.d } f"`,
+		`"a ${b} c ${{d: "${e}"}.d} f"`)
+	expectParseString(t, "`\\${a} ${ a + b }`", "`\\${a} ${(a + b)}`")
+
+	expectParseError(t, `"${}"`)
+	expectParseError(t, `"${a b}"`)
+	expectParseError(t, `"${a}`)
+	expectParseError(t, `"${a"`)
+	expectParseError(t, `"${"${a}"`)
+	expectParseError(t, `{"${a}": 1}`)
+}
+
+func TestParseSwitch(t *testing.T) {
+	expectParse(t, "switch a { case 1, 2: b; default: c }", func(p pfn) []Stmt {
+		return stmts(
+			switchStmt(
+				ident("a", p(1, 8)),
+				p(1, 1), p(1, 10), p(1, 37),
+				caseClause(p(1, 12), p(1, 21),
+					exprs(intLit(1, p(1, 17)), intLit(2, p(1, 20))),
+					exprStmt(ident("b", p(1, 23)))),
+				caseClause(p(1, 26), p(1, 33), nil,
+					exprStmt(ident("c", p(1, 35))))))
+	})
+
+	expectParse(t, `switch {
+case a > 1:
+case a < 1:
+	b
+	c
+}`, func(p pfn) []Stmt {
+		return stmts(
+			switchStmt(
+				nil,
+				p(1, 1), p(1, 8), p(6, 1),
+				caseClause(p(2, 1), p(2, 11),
+					exprs(binaryExpr(ident("a", p(2, 6)), intLit(1, p(2, 10)),
+						token.Greater, p(2, 8)))),
+				caseClause(p(3, 1), p(3, 11),
+					exprs(binaryExpr(ident("a", p(3, 6)), intLit(1, p(3, 10)),
+						token.Less, p(3, 8))),
+					exprStmt(ident("b", p(4, 2))),
+					exprStmt(ident("c", p(5, 2))))))
+	})
+
+	expectParse(t, "switch {}", func(p pfn) []Stmt {
+		return stmts(switchStmt(nil, p(1, 1), p(1, 8), p(1, 9)))
+	})
+
+	expectParseString(t, `switch x { case 1, 2: a = 1; b = 2; case 3: default: c() }`,
+		"switch x {case 1, 2: a = 1; b = 2; case 3:; default: c()}")
+	expectParseString(t, `switch { case a > 1: break }`,
+		"switch {case (a > 1): break}")
+	expectParseString(t, `switch { case a > 1 && b: break }`,
+		"switch {case ((a > 1) && b): break}")
+
+	// switch keywords are allowed as selectors and map keys
+	expectParse(t, "cfg.default", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				selectorExpr(
+					ident("cfg", p(1, 1)),
+					stringLit("default", p(1, 5)))))
+	})
+	expectParse(t, "{case: 1, default: 2}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 21),
+					mapElementLit(
+						"case", p(1, 2), p(1, 6), intLit(1, p(1, 8))),
+					mapElementLit(
+						"default", p(1, 11), p(1, 18), intLit(2, p(1, 20))))))
+	})
+	expectParseString(t, "a.switch = {switch: b}", "a.switch = {switch: b}")
+	expectParseString(t, "switch x.case { case x.default: }",
+		"switch x.case {case x.default:}")
+
+	expectParseError(t, "switch a { default: b; default: c }")
+	expectParseError(t, "switch a { b }")
+	expectParseError(t, "switch a { case: b }")
+	expectParseError(t, "case 1: b")
+}
+
+func TestParseTry(t *testing.T) {
+	expectParse(t, "try {} catch e {}", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 6)),
+				ident("e", p(1, 14)),
+				blockStmt(p(1, 16), p(1, 17)),
+				nil,
+				p(1, 1), p(1, 8), NoPos))
+	})
+
+	expectParse(t, "try { a() } catch { b() } finally { c() }", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 11),
+					exprStmt(callExpr(ident("a", p(1, 7)),
+						p(1, 8), p(1, 9), NoPos))),
+				nil,
+				blockStmt(p(1, 19), p(1, 25),
+					exprStmt(callExpr(ident("b", p(1, 21)),
+						p(1, 22), p(1, 23), NoPos))),
+				blockStmt(p(1, 35), p(1, 41),
+					exprStmt(callExpr(ident("c", p(1, 37)),
+						p(1, 38), p(1, 39), NoPos))),
+				p(1, 1), p(1, 13), p(1, 27)))
+	})
+
+	expectParse(t, "try {} finally {}", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 6)),
+				nil,
+				nil,
+				blockStmt(p(1, 16), p(1, 17)),
+				p(1, 1), NoPos, p(1, 8)))
+	})
+
+	expectParseString(t, "try { a = 1 } catch e { b = e } finally { c = 2 }",
+		"try {a = 1} catch e {b = e} finally {c = 2}")
+
+	// try keywords are allowed as selectors and map keys
+	expectParse(t, "r.catch", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				selectorExpr(
+					ident("r", p(1, 1)),
+					stringLit("catch", p(1, 3)))))
+	})
+	expectParse(t, "{try: 1, finally: 2}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 20),
+					mapElementLit(
+						"try", p(1, 2), p(1, 5), intLit(1, p(1, 7))),
+					mapElementLit(
+						"finally", p(1, 10), p(1, 17), intLit(2, p(1, 19))))))
+	})
+	expectParseString(t, "try { r.try = 1 } catch e { e.catch }",
+		"try {r.try = 1} catch e {e.catch}")
+
+	expectParseError(t, "try {}")
+	expectParseError(t, `try {}
+catch e {}`)
+	expectParseError(t, "try {} catch e, f {}")
+	expectParseError(t, "try := 1")
+}
+
+func TestParseYield(t *testing.T) {
+	expectParse(t, "func() { yield a + 1; yield }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(identList(p(1, 5), p(1, 6), false), p(1, 1)),
+					blockStmt(p(1, 8), p(1, 29),
+						yieldStmt(p(1, 10),
+							binaryExpr(
+								ident("a", p(1, 16)),
+								intLit(1, p(1, 20)),
+								token.Add,
+								p(1, 18))),
+						yieldStmt(p(1, 23), nil)))))
+	})
+
+	expectParseString(t, "func() {\n\tyield\n\tyield x\n}",
+		"func() {yield; yield x}")
+
+	// yield is allowed as a selector and a map key
+	expectParse(t, "m.yield", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				selectorExpr(
+					ident("m", p(1, 1)),
+					stringLit("yield", p(1, 3)))))
+	})
+	expectParse(t, "{yield: 1}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 10),
+					mapElementLit(
+						"yield", p(1, 2), p(1, 7), intLit(1, p(1, 9))))))
+	})
+	expectParseString(t, "func() { yield m.yield }", "func() {yield m.yield}")
+}
+
+func TestParseType(t *testing.T) {
+	expectParse(t, "type Point { x, y }", func(p pfn) []Stmt {
+		return stmts(
+			typeStmt(p(1, 1), ident("Point", p(1, 6)), p(1, 12), p(1, 19),
+				ident("x", p(1, 14)),
+				ident("y", p(1, 17))))
+	})
+	expectParse(t, "type Empty {}", func(p pfn) []Stmt {
+		return stmts(
+			typeStmt(p(1, 1), ident("Empty", p(1, 6)), p(1, 12), p(1, 13)))
+	})
+	expectParse(t, "func (p Point) dist(o) { return p }",
+		func(p pfn) []Stmt {
+			return stmts(
+				methodStmt(
+					ident("p", p(1, 7)),
+					ident("Point", p(1, 9)),
+					ident("dist", p(1, 16)),
+					funcType(identList(p(1, 20), p(1, 22), false,
+						ident("o", p(1, 21))), p(1, 1)),
+					blockStmt(p(1, 24), p(1, 35),
+						returnStmt(p(1, 26), ident("p", p(1, 33))))))
+		})
+
+	// function literals are not method declarations
+	expectParse(t, "func (a, b) {}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(identList(p(1, 6), p(1, 11), false,
+						ident("a", p(1, 7)),
+						ident("b", p(1, 10))), p(1, 1)),
+					blockStmt(p(1, 13), p(1, 14)))))
+	})
+
+	expectParseString(t, "type Point {\n\tx\n\ty,\n\tz\n}",
+		"type Point {x, y, z}")
+	expectParseString(t, "func (p Point) move(dx, dy) {\n\tp.x += dx\n}",
+		"func (p Point) move(dx, dy) {p.x += dx}")
+
+	// "type" is only a keyword at the start of a type declaration
+	expectParse(t, "m.type", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				selectorExpr(
+					ident("m", p(1, 1)),
+					stringLit("type", p(1, 3)))))
+	})
+	expectParse(t, "{type: 1}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 9),
+					mapElementLit(
+						"type", p(1, 2), p(1, 6), intLit(1, p(1, 8))))))
+	})
+	expectParseString(t, "type := 5", "type := 5")
+	expectParseString(t, "x := type", "x := type")
+	expectParseString(t, "type = type + 1", "type = (type + 1)")
+
+	expectParseError(t, "type {}")
+	expectParseError(t, "type Point { x: 1 }")
+	expectParseError(t, "func (p Point) {}")
 }
 
 func TestParseInt(t *testing.T) {
@@ -1563,6 +2076,53 @@ func TestParseInt(t *testing.T) {
 	}
 }
 
+func TestParseBigInt(t *testing.T) {
+	expectParse(t, "1n", func(p pfn) []Stmt {
+		return stmts(exprStmt(bigIntLit("1", p(1, 1))))
+	})
+	expectParse(t, "0x10n", func(p pfn) []Stmt {
+		return stmts(exprStmt(bigIntLit("16", p(1, 1))))
+	})
+	expectParse(t, "1_000n", func(p pfn) []Stmt {
+		return stmts(exprStmt(bigIntLit("1000", p(1, 1))))
+	})
+	expectParse(t, "170141183460469231731687303715884105727n",
+		func(p pfn) []Stmt {
+			return stmts(exprStmt(bigIntLit(
+				"170141183460469231731687303715884105727", p(1, 1))))
+		})
+	expectParse(t, "-1n", func(p pfn) []Stmt {
+		return stmts(exprStmt(unaryExpr(bigIntLit("1", p(1, 2)),
+			token.Sub, p(1, 1))))
+	})
+	expectParseString(t, "a + 1n", "(a + 1n)")
+
+	expectParseError(t, "1.5n")
+	expectParseError(t, "1e3n")
+	expectParseError(t, "08n")
+	expectParseError(t, "1_n")
+}
+
+func TestParseDecimal(t *testing.T) {
+	expectParse(t, "12.34d", func(p pfn) []Stmt {
+		return stmts(exprStmt(decimalLit("12.34", p(1, 1))))
+	})
+	expectParse(t, "5d", func(p pfn) []Stmt {
+		return stmts(exprStmt(decimalLit("5", p(1, 1))))
+	})
+	expectParse(t, "1.5e-3d", func(p pfn) []Stmt {
+		return stmts(exprStmt(decimalLit("1.5e-3", p(1, 1))))
+	})
+	expectParse(t, "0x1d", func(p pfn) []Stmt {
+		return stmts(exprStmt(intLit(29, p(1, 1))))
+	})
+	expectParseString(t, "a * 1.50d", "(a * 1.50d)")
+
+	expectParseError(t, "1_000.5d")
+	expectParseError(t, "1.5nd")
+	expectParseError(t, "1.5dd")
+}
+
 func TestParseFloat(t *testing.T) {
 	testCases := []string{
 		// Different placements of decimal point
@@ -1780,10 +2340,51 @@ func emptyStmt(implicit bool, pos Pos) *EmptyStmt {
 	return &EmptyStmt{Implicit: implicit, Semicolon: pos}
 }
 
+func deferStmt(pos Pos, call *CallExpr) *DeferStmt {
+	return &DeferStmt{DeferPos: pos, Call: call}
+}
+
+func yieldStmt(pos Pos, result Expr) *YieldStmt {
+	return &YieldStmt{YieldPos: pos, Result: result}
+}
+
+func typeStmt(
+	pos Pos,
+	name *Ident,
+	lbrace, rbrace Pos,
+	fields ...*Ident,
+) *TypeStmt {
+	return &TypeStmt{
+		TypePos: pos,
+		Name:    name,
+		LBrace:  lbrace,
+		Fields:  fields,
+		RBrace:  rbrace,
+	}
+}
+
+func methodStmt(
+	recv, recvType, name *Ident,
+	typ *FuncType,
+	body *BlockStmt,
+) *MethodStmt {
+	return &MethodStmt{
+		Recv:     recv,
+		RecvType: recvType,
+		Name:     name,
+		Type:     typ,
+		Body:     body,
+	}
+}
+
 func returnStmt(pos Pos, result Expr) *ReturnStmt {
 	return &ReturnStmt{Result: result, ReturnPos: pos}
 }
 
+func returnStmts(pos Pos, results ...Expr) *ReturnStmt {
+	return &ReturnStmt{Results: results, ReturnPos: pos}
+}
+
 func forStmt(
 	init Stmt,
 	cond Expr,
@@ -1819,6 +2420,33 @@ func ifStmt(
 	}
 }
 
+func switchStmt(
+	tag Expr,
+	pos, lbrace, rbrace Pos,
+	body ...*CaseClause,
+) *SwitchStmt {
+	return &SwitchStmt{
+		Tag: tag, Body: body, SwitchPos: pos, LBrace: lbrace, RBrace: rbrace,
+	}
+}
+
+func caseClause(pos, colon Pos, list []Expr, body ...Stmt) *CaseClause {
+	return &CaseClause{List: list, Body: body, CasePos: pos, Colon: colon}
+}
+
+func tryStmt(
+	body *BlockStmt,
+	ident *Ident,
+	catch *BlockStmt,
+	finally *BlockStmt,
+	pos, catchPos, finallyPos Pos,
+) *TryStmt {
+	return &TryStmt{
+		Body: body, Ident: ident, Catch: catch, Finally: finally,
+		TryPos: pos, CatchPos: catchPos, FinallyPos: finallyPos,
+	}
+}
+
 func incDecStmt(
 	expr Expr,
 	tok token.Token,
@@ -1885,6 +2513,19 @@ func intLit(value int64, pos Pos) *IntLit {
 	return &IntLit{Value: value, ValuePos: pos}
 }
 
+func bigIntLit(value string, pos Pos) *BigIntLit {
+	v, _ := new(big.Int).SetString(value, 10)
+	return &BigIntLit{Value: v, ValuePos: pos}
+}
+
+func decimalLit(value string, pos Pos) *DecimalLit {
+	return &DecimalLit{Value: value, ValuePos: pos}
+}
+
+func spreadExpr(x Expr, ellipsis Pos) *SpreadExpr {
+	return &SpreadExpr{Expr: x, Ellipsis: ellipsis}
+}
+
 func floatLit(value float64, pos Pos) *FloatLit {
 	return &FloatLit{Value: value, ValuePos: pos}
 }
@@ -1893,6 +2534,14 @@ func stringLit(value string, pos Pos) *StringLit {
 	return &StringLit{Value: value, ValuePos: pos}
 }
 
+func interpStringLit(parts []*StringLit, exprs ...Expr) *InterpStringLit {
+	return &InterpStringLit{Parts: parts, Exprs: exprs}
+}
+
+func parts(list ...*StringLit) []*StringLit {
+	return list
+}
+
 func charLit(value rune, pos Pos) *CharLit {
 	return &CharLit{
 		Value: value, ValuePos: pos, Literal: fmt.Sprintf("'%c'", value),
@@ -1974,6 +2623,25 @@ func selectorExpr(x, sel Expr) *SelectorExpr {
 	return &SelectorExpr{Expr: x, Sel: sel}
 }
 
+func chainExpr(x Expr) *ChainExpr {
+	return &ChainExpr{Expr: x}
+}
+
+// optional marks a selector, index, slice or call expression optional.
+func optional(x Expr) Expr {
+	switch x := x.(type) {
+	case *SelectorExpr:
+		x.Optional = true
+	case *IndexExpr:
+		x.Optional = true
+	case *SliceExpr:
+		x.Optional = true
+	case *CallExpr:
+		x.Optional = true
+	}
+	return x
+}
+
 func equalStmt(t *testing.T, expected, actual Stmt) {
 	if expected == nil || reflect.ValueOf(expected).IsNil() {
 		require.Nil(t, actual, "expected nil, but got not nil")
@@ -2012,6 +2680,30 @@ func equalStmt(t *testing.T, expected, actual Stmt) {
 		equalStmt(t, expected.Body, actual.(*IfStmt).Body)
 		equalStmt(t, expected.Else, actual.(*IfStmt).Else)
 		require.Equal(t, expected.IfPos, actual.(*IfStmt).IfPos)
+	case *SwitchStmt:
+		equalExpr(t, expected.Tag, actual.(*SwitchStmt).Tag)
+		require.Equal(t, len(expected.Body), len(actual.(*SwitchStmt).Body))
+		for i, c := range expected.Body {
+			equalStmt(t, c, actual.(*SwitchStmt).Body[i])
+		}
+		require.Equal(t, expected.SwitchPos,
+			actual.(*SwitchStmt).SwitchPos)
+		require.Equal(t, expected.LBrace, actual.(*SwitchStmt).LBrace)
+		require.Equal(t, expected.RBrace, actual.(*SwitchStmt).RBrace)
+	case *CaseClause:
+		equalExprs(t, expected.List, actual.(*CaseClause).List)
+		equalStmts(t, expected.Body, actual.(*CaseClause).Body)
+		require.Equal(t, expected.CasePos, actual.(*CaseClause).CasePos)
+		require.Equal(t, expected.Colon, actual.(*CaseClause).Colon)
+	case *TryStmt:
+		equalStmt(t, expected.Body, actual.(*TryStmt).Body)
+		equalExpr(t, expected.Ident, actual.(*TryStmt).Ident)
+		equalStmt(t, expected.Catch, actual.(*TryStmt).Catch)
+		equalStmt(t, expected.Finally, actual.(*TryStmt).Finally)
+		require.Equal(t, expected.TryPos, actual.(*TryStmt).TryPos)
+		require.Equal(t, expected.CatchPos, actual.(*TryStmt).CatchPos)
+		require.Equal(t, expected.FinallyPos,
+			actual.(*TryStmt).FinallyPos)
 	case *IncDecStmt:
 		equalExpr(t, expected.Expr,
 			actual.(*IncDecStmt).Expr)
@@ -2036,9 +2728,32 @@ func equalStmt(t *testing.T, expected, actual Stmt) {
 			actual.(*ForInStmt).Body)
 		require.Equal(t, expected.ForPos,
 			actual.(*ForInStmt).ForPos)
+	case *DeferStmt:
+		equalExpr(t, expected.Call, actual.(*DeferStmt).Call)
+		require.Equal(t, expected.DeferPos, actual.(*DeferStmt).DeferPos)
+	case *YieldStmt:
+		equalExpr(t, expected.Result, actual.(*YieldStmt).Result)
+		require.Equal(t, expected.YieldPos, actual.(*YieldStmt).YieldPos)
+	case *TypeStmt:
+		require.Equal(t, expected.TypePos, actual.(*TypeStmt).TypePos)
+		equalExpr(t, expected.Name, actual.(*TypeStmt).Name)
+		require.Equal(t, expected.LBrace, actual.(*TypeStmt).LBrace)
+		require.Equal(t, len(expected.Fields), len(actual.(*TypeStmt).Fields))
+		for i, f := range expected.Fields {
+			equalExpr(t, f, actual.(*TypeStmt).Fields[i])
+		}
+		require.Equal(t, expected.RBrace, actual.(*TypeStmt).RBrace)
+	case *MethodStmt:
+		equalExpr(t, expected.Recv, actual.(*MethodStmt).Recv)
+		equalExpr(t, expected.RecvType, actual.(*MethodStmt).RecvType)
+		equalExpr(t, expected.Name, actual.(*MethodStmt).Name)
+		equalFuncType(t, expected.Type, actual.(*MethodStmt).Type)
+		equalStmt(t, expected.Body, actual.(*MethodStmt).Body)
 	case *ReturnStmt:
 		equalExpr(t, expected.Result,
 			actual.(*ReturnStmt).Result)
+		equalExprs(t, expected.Results,
+			actual.(*ReturnStmt).Results)
 		require.Equal(t, expected.ReturnPos,
 			actual.(*ReturnStmt).ReturnPos)
 	case *BranchStmt:
@@ -2072,6 +2787,16 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*IntLit).Value)
 		require.Equal(t, int(expected.ValuePos),
 			int(actual.(*IntLit).ValuePos))
+	case *BigIntLit:
+		require.Equal(t, expected.Value.String(),
+			actual.(*BigIntLit).Value.String())
+		require.Equal(t, int(expected.ValuePos),
+			int(actual.(*BigIntLit).ValuePos))
+	case *DecimalLit:
+		require.Equal(t, expected.Value,
+			actual.(*DecimalLit).Value)
+		require.Equal(t, int(expected.ValuePos),
+			int(actual.(*DecimalLit).ValuePos))
 	case *FloatLit:
 		require.Equal(t, expected.Value,
 			actual.(*FloatLit).Value)
@@ -2092,6 +2817,13 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*StringLit).Value)
 		require.Equal(t, int(expected.ValuePos),
 			int(actual.(*StringLit).ValuePos))
+	case *InterpStringLit:
+		require.Equal(t, len(expected.Parts),
+			len(actual.(*InterpStringLit).Parts))
+		for i, part := range expected.Parts {
+			equalExpr(t, part, actual.(*InterpStringLit).Parts[i])
+		}
+		equalExprs(t, expected.Exprs, actual.(*InterpStringLit).Exprs)
 	case *ArrayLit:
 		require.Equal(t, expected.LBrack,
 			actual.(*ArrayLit).LBrack)
@@ -2136,6 +2868,11 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*CallExpr).RParen)
 		equalExprs(t, expected.Args,
 			actual.(*CallExpr).Args)
+		require.Equal(t, expected.Optional,
+			actual.(*CallExpr).Optional)
+	case *ChainExpr:
+		equalExpr(t, expected.Expr,
+			actual.(*ChainExpr).Expr)
 	case *ParenExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*ParenExpr).Expr)
@@ -2152,6 +2889,8 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*IndexExpr).LBrack)
 		require.Equal(t, expected.RBrack,
 			actual.(*IndexExpr).RBrack)
+		require.Equal(t, expected.Optional,
+			actual.(*IndexExpr).Optional)
 	case *SliceExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*SliceExpr).Expr)
@@ -2163,11 +2902,15 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*SliceExpr).LBrack)
 		require.Equal(t, expected.RBrack,
 			actual.(*SliceExpr).RBrack)
+		require.Equal(t, expected.Optional,
+			actual.(*SliceExpr).Optional)
 	case *SelectorExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*SelectorExpr).Expr)
 		equalExpr(t, expected.Sel,
 			actual.(*SelectorExpr).Sel)
+		require.Equal(t, expected.Optional,
+			actual.(*SelectorExpr).Optional)
 	case *ImportExpr:
 		require.Equal(t, expected.ModuleName,
 			actual.(*ImportExpr).ModuleName)
@@ -2195,6 +2938,11 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*CondExpr).QuestionPos)
 		require.Equal(t, expected.ColonPos,
 			actual.(*CondExpr).ColonPos)
+	case *SpreadExpr:
+		equalExpr(t, expected.Expr,
+			actual.(*SpreadExpr).Expr)
+		require.Equal(t, expected.Ellipsis,
+			actual.(*SpreadExpr).Ellipsis)
 	default:
 		panic(fmt.Errorf("unknown type: %T", expected))
 	}
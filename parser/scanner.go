@@ -33,11 +33,19 @@ type Scanner struct {
 	readOffset   int                 // reading offset (position after current character)
 	lineOffset   int                 // current line offset
 	insertSemi   bool                // insert a semicolon before next newline
+	afterDot     bool                // last token was a selector dot
 	errorHandler ScannerErrorHandler // error reporting; or nil
 	errorCount   int                 // number of errors encountered
+	interps      []interp            // interpolated strings being scanned
 	mode         ScanMode
 }
 
+// interp represents an interpolated string being scanned.
+type interp struct {
+	raw    bool // raw string literal
+	braces int  // number of unclosed braces in the current expression
+}
+
 // NewScanner creates a Scanner.
 func NewScanner(
 	file *SourceFile,
@@ -49,6 +57,7 @@ func NewScanner(
 		panic(fmt.Sprintf("file size (%d) does not match src len (%d)",
 			file.Size, len(src)))
 	}
+	file.src = src
 
 	s := &Scanner{
 		file:         file,
@@ -82,15 +91,22 @@ func (s *Scanner) Scan() (
 	pos = s.file.FileSetPos(s.offset)
 
 	insertSemi := false
+	afterDot := s.afterDot
+	s.afterDot = false
 
 	// determine token value
 	switch ch := s.ch; {
 	case isLetter(ch):
 		literal = s.scanIdentifier()
 		tok = token.Lookup(literal)
+		if afterDot {
+			// keywords can be used as selectors
+			tok = token.Ident
+		}
 		switch tok {
 		case token.Ident, token.Break, token.Continue, token.Return,
-			token.Export, token.True, token.False, token.Undefined:
+			token.Export, token.True, token.False, token.Undefined,
+			token.Yield:
 			insertSemi = true
 		}
 	case ('0' <= ch && ch <= '9') || (ch == '.' && '0' <= s.peek() && s.peek() <= '9'):
@@ -111,17 +127,15 @@ func (s *Scanner) Scan() (
 			s.insertSemi = false // newline consumed
 			return token.Semicolon, "\n", pos
 		case '"':
-			insertSemi = true
-			tok = token.String
-			literal = s.scanString()
+			tok, literal = s.scanString(token.String)
+			insertSemi = tok == token.String
 		case '\'':
 			insertSemi = true
 			tok = token.Char
 			literal = s.scanRune()
 		case '`':
-			insertSemi = true
-			tok = token.String
-			literal = s.scanRawString()
+			tok, literal = s.scanRawString(token.String)
+			insertSemi = tok == token.String
 		case ':':
 			tok = s.switch2(token.Colon, token.Define)
 		case '.':
@@ -131,10 +145,22 @@ func (s *Scanner) Scan() (
 				s.next() // consume last '.'
 				tok = token.Ellipsis
 			}
+			s.afterDot = tok == token.Period
 		case ',':
 			tok = token.Comma
 		case '?':
-			tok = token.Question
+			switch {
+			case s.ch == '.' && !isDigit(rune(s.peek())):
+				// "?.5" is a conditional with a float
+				s.next()
+				tok = token.QuestionDot
+				s.afterDot = true
+			case s.ch == '?':
+				s.next()
+				tok = token.Coalesce
+			default:
+				tok = token.Question
+			}
 		case ';':
 			tok = token.Semicolon
 			literal = ";"
@@ -150,9 +176,25 @@ func (s *Scanner) Scan() (
 			tok = token.RBrack
 		case '{':
 			tok = token.LBrace
+			if n := len(s.interps); n > 0 {
+				s.interps[n-1].braces++
+			}
 		case '}':
 			insertSemi = true
 			tok = token.RBrace
+			if n := len(s.interps); n > 0 {
+				if s.interps[n-1].braces == 0 {
+					// end of the interpolated expression
+					if s.interps[n-1].raw {
+						tok, literal = s.scanRawString(token.StringMid)
+					} else {
+						tok, literal = s.scanString(token.StringMid)
+					}
+					insertSemi = tok == token.StringTail
+				} else {
+					s.interps[n-1].braces--
+				}
+			}
 		case '+':
 			tok = s.switch3(token.Add, token.AddAssign, '+', token.Inc)
 			if tok == token.Inc {
@@ -425,6 +467,17 @@ func (s *Scanner) scanNumber() (token.Token, string) {
 		}
 	}
 
+	// big-int suffix
+	if tok == token.Int && s.ch == 'n' {
+		s.next()
+	}
+
+	// decimal suffix
+	if base == 10 && s.ch == 'd' {
+		tok = token.Float
+		s.next()
+	}
+
 	return tok, string(s.src[offs:s.offset])
 }
 
@@ -515,8 +568,11 @@ func (s *Scanner) scanRune() string {
 	return string(s.src[offs:s.offset])
 }
 
-func (s *Scanner) scanString() string {
-	offs := s.offset - 1 // '"' opening already consumed
+// scanString scans a string literal, or a part of an interpolated string
+// literal after "}" if tok is token.StringMid. It returns token.StringHead or
+// token.StringMid if the part is followed by an interpolated expression.
+func (s *Scanner) scanString(tok token.Token) (token.Token, string) {
+	offs := s.offset - 1 // '"' or '}' opening already consumed
 
 	for {
 		ch := s.ch
@@ -526,17 +582,29 @@ func (s *Scanner) scanString() string {
 		}
 		s.next()
 		if ch == '"' {
+			tok = s.endInterp(tok)
+			break
+		}
+		if ch == '$' && s.ch == '{' {
+			s.next()
+			tok = s.startInterp(tok, false)
 			break
 		}
 		if ch == '\\' {
-			s.scanEscape('"')
+			if s.ch == '$' {
+				s.next() // escaped dollar sign
+			} else {
+				s.scanEscape('"')
+			}
 		}
 	}
-	return string(s.src[offs:s.offset])
+	return tok, string(s.src[offs:s.offset])
 }
 
-func (s *Scanner) scanRawString() string {
-	offs := s.offset - 1 // '`' opening already consumed
+// scanRawString scans a raw string literal, or a part of an interpolated raw
+// string literal after "}" if tok is token.StringMid.
+func (s *Scanner) scanRawString(tok token.Token) (token.Token, string) {
+	offs := s.offset - 1 // '`' or '}' opening already consumed
 
 	hasCR := false
 	for {
@@ -549,8 +617,18 @@ func (s *Scanner) scanRawString() string {
 		s.next()
 
 		if ch == '`' {
+			tok = s.endInterp(tok)
+			break
+		}
+		if ch == '$' && s.ch == '{' {
+			s.next()
+			tok = s.startInterp(tok, true)
 			break
 		}
+		if ch == '\\' && s.ch == '$' && s.peek() == '{' {
+			s.next()
+			s.next() // escaped "${"
+		}
 
 		if ch == '\r' {
 			hasCR = true
@@ -561,7 +639,26 @@ func (s *Scanner) scanRawString() string {
 	if hasCR {
 		lit = StripCR(lit, false)
 	}
-	return string(lit)
+	return tok, string(lit)
+}
+
+// startInterp returns the token of a string part followed by an interpolated
+// expression.
+func (s *Scanner) startInterp(tok token.Token, raw bool) token.Token {
+	if tok == token.String {
+		s.interps = append(s.interps, interp{raw: raw})
+		return token.StringHead
+	}
+	return token.StringMid
+}
+
+// endInterp returns the token of a string part that ends the string literal.
+func (s *Scanner) endInterp(tok token.Token) token.Token {
+	if tok == token.StringMid {
+		s.interps = s.interps[:len(s.interps)-1]
+		return token.StringTail
+	}
+	return tok
 }
 
 // StripCR removes carriage return characters.
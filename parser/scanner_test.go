@@ -43,9 +43,15 @@ func TestScanner_Scan(t *testing.T) {
 		{token.Int, "123456789012345678890"},
 		{token.Int, "01234567"},
 		{token.Int, "0xcafebabe"},
+		{token.Int, "123n"},
+		{token.Int, "0xcafebaben"},
+		{token.Int, "0xcafed"},
 		{token.Float, "0."},
 		{token.Float, ".0"},
 		{token.Float, "3.14159265"},
+		{token.Float, "12d"},
+		{token.Float, "3.14d"},
+		{token.Float, "1e-3d"},
 		{token.Float, "1e0"},
 		{token.Float, "1e+100"},
 		{token.Float, "1e-100"},
@@ -108,6 +114,8 @@ func TestScanner_Scan(t *testing.T) {
 		{token.RBrace, "}"},
 		{token.Semicolon, ";"},
 		{token.Colon, ":"},
+		{token.QuestionDot, "?."},
+		{token.Coalesce, "??"},
 		{token.Break, "break"},
 		{token.Continue, "continue"},
 		{token.Else, "else"},
@@ -194,6 +202,67 @@ func TestScanner_Scan(t *testing.T) {
 		parser.DontInsertSemis, expectedSkipComments...)
 }
 
+func TestScanner_ScanOptional(t *testing.T) {
+	scanExpect(t, "a?.b ?? c?.(d)", 0,
+		scanResult{token.Ident, "a", 1, 1},
+		scanResult{token.QuestionDot, "", 1, 2},
+		scanResult{token.Ident, "b", 1, 4},
+		scanResult{token.Coalesce, "", 1, 6},
+		scanResult{token.Ident, "c", 1, 9},
+		scanResult{token.QuestionDot, "", 1, 10},
+		scanResult{token.LParen, "", 1, 12},
+		scanResult{token.Ident, "d", 1, 13},
+		scanResult{token.RParen, "", 1, 14},
+		scanResult{token.Semicolon, "\n", 1, 15})
+
+	// conditional expression with a float
+	scanExpect(t, "a?.5:b", 0,
+		scanResult{token.Ident, "a", 1, 1},
+		scanResult{token.Question, "", 1, 2},
+		scanResult{token.Float, ".5", 1, 3},
+		scanResult{token.Colon, "", 1, 5},
+		scanResult{token.Ident, "b", 1, 6},
+		scanResult{token.Semicolon, "\n", 1, 7})
+}
+
+func TestScanner_ScanInterpString(t *testing.T) {
+	scanExpect(t, `"a ${b} c ${ {d: "${e}"}.d } f" + g`, 0,
+		scanResult{token.StringHead, `"a ${`, 1, 1},
+		scanResult{token.Ident, "b", 1, 6},
+		scanResult{token.StringMid, "} c ${", 1, 7},
+		scanResult{token.LBrace, "", 1, 14},
+		scanResult{token.Ident, "d", 1, 15},
+		scanResult{token.Colon, "", 1, 16},
+		scanResult{token.StringHead, `"${`, 1, 18},
+		scanResult{token.Ident, "e", 1, 21},
+		scanResult{token.StringTail, `}"`, 1, 22},
+		scanResult{token.RBrace, "", 1, 24},
+		scanResult{token.Period, "", 1, 25},
+		scanResult{token.Ident, "d", 1, 26},
+		scanResult{token.StringTail, `} f"`, 1, 28},
+		scanResult{token.Add, "", 1, 33},
+		scanResult{token.Ident, "g", 1, 35},
+		scanResult{token.Semicolon, "\n", 1, 36})
+
+	scanExpect(t, "`a\n${b}\r\n`", 0,
+		scanResult{token.StringHead, "`a\n${", 1, 1},
+		scanResult{token.Ident, "b", 2, 3},
+		scanResult{token.StringTail, "}\n`", 2, 4},
+		scanResult{token.Semicolon, "\n", 3, 2})
+
+	// escaped "${"
+	scanExpect(t, `"\${a}" "\\${a}" "$ {a}"`, 0,
+		scanResult{token.String, `"\${a}"`, 1, 1},
+		scanResult{token.StringHead, `"\\${`, 1, 9},
+		scanResult{token.Ident, "a", 1, 14},
+		scanResult{token.StringTail, `}"`, 1, 15},
+		scanResult{token.String, `"$ {a}"`, 1, 18},
+		scanResult{token.Semicolon, "\n", 1, 25})
+	scanExpect(t, "`\\${a}`", 0,
+		scanResult{token.String, "`\\${a}`", 1, 1},
+		scanResult{token.Semicolon, "\n", 1, 8})
+}
+
 func TestStripCR(t *testing.T) {
 	for _, tc := range []struct {
 		input  string
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"sort"
 )
@@ -148,6 +149,8 @@ type SourceFile struct {
 	// Lines contains the offset of the first character for each line
 	// (the first entry is always 0)
 	Lines []int
+	// source of the file, set when it is scanned
+	src []byte
 }
 
 // Set returns SourceFileSet.
@@ -179,6 +182,23 @@ func (f *SourceFile) LineStart(line int) Pos {
 	return Pos(f.Base + f.Lines[line-1])
 }
 
+// LineText returns the text of the line without the line break. It returns
+// an empty string if the line is invalid or the source of the file is not
+// available, e.g. in the decoded bytecode.
+func (f *SourceFile) LineText(line int) string {
+	if f.src == nil || line < 1 || line > len(f.Lines) {
+		return ""
+	}
+	end := len(f.src)
+	if line < len(f.Lines) {
+		end = f.Lines[line]
+	}
+	text := f.src[f.Lines[line-1]:end]
+	text = bytes.TrimSuffix(text, []byte("\n"))
+	text = bytes.TrimSuffix(text, []byte("\r"))
+	return string(text)
+}
+
 // FileSetPos returns the position in the file set.
 func (f *SourceFile) FileSetPos(offset int) Pos {
 	if offset > f.Size {
@@ -124,6 +124,72 @@ func (s *BranchStmt) String() string {
 	return s.Token.String() + label
 }
 
+// CaseClause represents a case of a switch statement.
+type CaseClause struct {
+	CasePos Pos    // position of "case" or "default" keyword
+	List    []Expr // list of expressions; nil means default case
+	Colon   Pos
+	Body    []Stmt
+}
+
+func (s *CaseClause) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *CaseClause) Pos() Pos {
+	return s.CasePos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *CaseClause) End() Pos {
+	if n := len(s.Body); n > 0 {
+		return s.Body[n-1].End()
+	}
+	return s.Colon + 1
+}
+
+func (s *CaseClause) String() string {
+	var str string
+	if s.List == nil {
+		str = "default:"
+	} else {
+		var list []string
+		for _, e := range s.List {
+			list = append(list, e.String())
+		}
+		str = "case " + strings.Join(list, ", ") + ":"
+	}
+	var body []string
+	for _, e := range s.Body {
+		body = append(body, e.String())
+	}
+	if len(body) > 0 {
+		str += " " + strings.Join(body, "; ")
+	}
+	return str
+}
+
+// DeferStmt represents a defer statement.
+type DeferStmt struct {
+	DeferPos Pos
+	Call     *CallExpr
+}
+
+func (s *DeferStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *DeferStmt) Pos() Pos {
+	return s.DeferPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *DeferStmt) End() Pos {
+	return s.Call.End()
+}
+
+func (s *DeferStmt) String() string {
+	return "defer " + s.Call.String()
+}
+
 // EmptyStmt represents an empty statement.
 type EmptyStmt struct {
 	Semicolon Pos
@@ -320,10 +386,37 @@ func (s *IncDecStmt) String() string {
 	return s.Expr.String() + s.Token.String()
 }
 
+// MethodStmt represents a method declaration of a record type.
+type MethodStmt struct {
+	Recv     *Ident // receiver name
+	RecvType *Ident // receiver type name
+	Name     *Ident
+	Type     *FuncType
+	Body     *BlockStmt
+}
+
+func (s *MethodStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *MethodStmt) Pos() Pos {
+	return s.Type.FuncPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *MethodStmt) End() Pos {
+	return s.Body.End()
+}
+
+func (s *MethodStmt) String() string {
+	return "func (" + s.Recv.String() + " " + s.RecvType.String() + ") " +
+		s.Name.String() + s.Type.Params.String() + " " + s.Body.String()
+}
+
 // ReturnStmt represents a return statement.
 type ReturnStmt struct {
 	ReturnPos Pos
-	Result    Expr
+	Result    Expr   // result of a single value return; or nil
+	Results   []Expr // results of a multiple values return; or nil
 }
 
 func (s *ReturnStmt) stmtNode() {}
@@ -335,15 +428,162 @@ func (s *ReturnStmt) Pos() Pos {
 
 // End returns the position of first character immediately after the node.
 func (s *ReturnStmt) End() Pos {
-	if s.Result != nil {
-		return s.Result.End()
+	if values := s.Values(); len(values) > 0 {
+		return values[len(values)-1].End()
 	}
 	return s.ReturnPos + 6
 }
 
 func (s *ReturnStmt) String() string {
-	if s.Result != nil {
-		return "return " + s.Result.String()
+	if values := s.Values(); len(values) > 0 {
+		var results []string
+		for _, e := range values {
+			results = append(results, e.String())
+		}
+		return "return " + strings.Join(results, ", ")
 	}
 	return "return"
 }
+
+// Values returns the values returned by the statement, either the single
+// Result or the Results.
+func (s *ReturnStmt) Values() []Expr {
+	if s.Result != nil {
+		return []Expr{s.Result}
+	}
+	return s.Results
+}
+
+// SwitchStmt represents a switch statement.
+type SwitchStmt struct {
+	SwitchPos Pos
+	Tag       Expr // tag expression; or nil
+	LBrace    Pos
+	Body      []*CaseClause
+	RBrace    Pos
+}
+
+func (s *SwitchStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *SwitchStmt) Pos() Pos {
+	return s.SwitchPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *SwitchStmt) End() Pos {
+	return s.RBrace + 1
+}
+
+func (s *SwitchStmt) String() string {
+	var tag string
+	if s.Tag != nil {
+		tag = s.Tag.String() + " "
+	}
+	var body []string
+	for _, c := range s.Body {
+		body = append(body, c.String())
+	}
+	return "switch " + tag + "{" + strings.Join(body, "; ") + "}"
+}
+
+// TryStmt represents a try statement.
+type TryStmt struct {
+	TryPos     Pos
+	Body       *BlockStmt
+	CatchPos   Pos
+	Ident      *Ident     // catch variable; or nil
+	Catch      *BlockStmt // catch block; or nil
+	FinallyPos Pos
+	Finally    *BlockStmt // finally block; or nil
+}
+
+func (s *TryStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *TryStmt) Pos() Pos {
+	return s.TryPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *TryStmt) End() Pos {
+	if s.Finally != nil {
+		return s.Finally.End()
+	}
+	if s.Catch != nil {
+		return s.Catch.End()
+	}
+	return s.Body.End()
+}
+
+func (s *TryStmt) String() string {
+	str := "try " + s.Body.String()
+	if s.Catch != nil {
+		str += " catch "
+		if s.Ident != nil {
+			str += s.Ident.String() + " "
+		}
+		str += s.Catch.String()
+	}
+	if s.Finally != nil {
+		str += " finally " + s.Finally.String()
+	}
+	return str
+}
+
+// TypeStmt represents a record type declaration.
+type TypeStmt struct {
+	TypePos Pos
+	Name    *Ident
+	LBrace  Pos
+	Fields  []*Ident
+	RBrace  Pos
+}
+
+func (s *TypeStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *TypeStmt) Pos() Pos {
+	return s.TypePos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *TypeStmt) End() Pos {
+	return s.RBrace + 1
+}
+
+func (s *TypeStmt) String() string {
+	var fields []string
+	for _, f := range s.Fields {
+		fields = append(fields, f.String())
+	}
+	return "type " + s.Name.String() + " {" + strings.Join(fields, ", ") + "}"
+}
+
+// YieldStmt represents a yield statement.
+type YieldStmt struct {
+	YieldPos Pos
+	Result   Expr // yielded value; or nil
+}
+
+func (s *YieldStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *YieldStmt) Pos() Pos {
+	return s.YieldPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *YieldStmt) End() Pos {
+	if s.Result != nil {
+		return s.Result.End()
+	}
+	return s.YieldPos + 5
+}
+
+func (s *YieldStmt) String() string {
+	if s.Result != nil {
+		return "yield " + s.Result.String()
+	}
+	return "yield"
+}
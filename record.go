@@ -0,0 +1,215 @@
+package tengo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RecordType represents a record type declared by a type statement. Calling
+// it creates a new record with the field values given in order.
+type RecordType struct {
+	ObjectImpl
+	Name    string
+	Fields  []string
+	Methods map[string]Object
+	index   map[string]int
+}
+
+// NewRecordType creates a new record type with the given name and fields.
+func NewRecordType(name string, fields ...string) *RecordType {
+	index := make(map[string]int, len(fields))
+	for i, f := range fields {
+		index[f] = i
+	}
+	return &RecordType{
+		Name:    name,
+		Fields:  fields,
+		Methods: make(map[string]Object),
+		index:   index,
+	}
+}
+
+// TypeName returns the name of the type.
+func (o *RecordType) TypeName() string {
+	return "record-type"
+}
+
+func (o *RecordType) String() string {
+	return "<record-type " + o.Name + ">"
+}
+
+// Copy returns the record type itself, as the types are compared by
+// identity.
+func (o *RecordType) Copy() Object {
+	return o
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *RecordType) Equals(x Object) bool {
+	return o == x
+}
+
+// IndexGet returns the method for the given name. The receiver must be
+// passed as the first argument when calling it.
+func (o *RecordType) IndexGet(index Object) (Object, error) {
+	name, ok := index.(*String)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	if m, ok := o.Methods[name.Value]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown method '%s' of %s", name.Value, o.Name)
+}
+
+// AddMethod adds a method with the given name. The method is called with
+// the receiver as its first argument.
+func (o *RecordType) AddMethod(name string, fn Object) error {
+	if !fn.CanCall() {
+		return fmt.Errorf("not callable: %s", fn.TypeName())
+	}
+	if _, ok := o.index[name]; ok {
+		return fmt.Errorf("field and method with the same name '%s'", name)
+	}
+	o.Methods[name] = fn
+	return nil
+}
+
+// Call creates a new record. Fields without a value are undefined.
+func (o *RecordType) Call(args ...Object) (Object, error) {
+	if len(args) > len(o.Fields) {
+		return nil, fmt.Errorf("wrong number of arguments: want<=%d, got=%d",
+			len(o.Fields), len(args))
+	}
+	values := make([]Object, len(o.Fields))
+	copy(values, args)
+	for i := len(args); i < len(values); i++ {
+		values[i] = UndefinedValue
+	}
+	return &Record{Type: o, Values: values}, nil
+}
+
+// CanCall returns whether the Object can be Called.
+func (o *RecordType) CanCall() bool {
+	return true
+}
+
+// Record represents a value of a record type.
+type Record struct {
+	ObjectImpl
+	Type   *RecordType
+	Values []Object
+}
+
+// TypeName returns the name of the record type.
+func (o *Record) TypeName() string {
+	return o.Type.Name
+}
+
+func (o *Record) String() string {
+	var pairs []string
+	for i, v := range o.Values {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", o.Type.Fields[i],
+			v.String()))
+	}
+	return fmt.Sprintf("%s{%s}", o.Type.Name, strings.Join(pairs, ", "))
+}
+
+// Copy returns a copy of the type.
+func (o *Record) Copy() Object {
+	values := make([]Object, len(o.Values))
+	for i, v := range o.Values {
+		values[i] = v.Copy()
+	}
+	return &Record{Type: o.Type, Values: values}
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *Record) Equals(x Object) bool {
+	r, ok := x.(*Record)
+	if !ok || r.Type != o.Type {
+		return false
+	}
+	for i, v := range o.Values {
+		if !v.Equals(r.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexGet returns the value of the field, or the method bound to the
+// record, for the given name.
+func (o *Record) IndexGet(index Object) (Object, error) {
+	name, ok := index.(*String)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	if i, ok := o.Type.index[name.Value]; ok {
+		return o.Values[i], nil
+	}
+	if m, ok := o.Type.Methods[name.Value]; ok {
+		return &BoundMethod{Receiver: o, Method: m}, nil
+	}
+	return nil, fmt.Errorf("unknown field or method '%s' of %s",
+		name.Value, o.Type.Name)
+}
+
+// IndexSet sets the value of the field for the given name.
+func (o *Record) IndexSet(index, value Object) error {
+	name, ok := index.(*String)
+	if !ok {
+		return ErrInvalidIndexType
+	}
+	i, ok := o.Type.index[name.Value]
+	if !ok {
+		return fmt.Errorf("unknown field '%s' of %s", name.Value,
+			o.Type.Name)
+	}
+	o.Values[i] = value
+	return nil
+}
+
+// BoundMethod represents a method of a record type bound to its receiver.
+type BoundMethod struct {
+	ObjectImpl
+	Receiver Object
+	Method   Object
+}
+
+// TypeName returns the name of the type.
+func (o *BoundMethod) TypeName() string {
+	return "bound-method"
+}
+
+func (o *BoundMethod) String() string {
+	return "<bound-method>"
+}
+
+// Copy returns a copy of the type.
+func (o *BoundMethod) Copy() Object {
+	return &BoundMethod{Receiver: o.Receiver, Method: o.Method}
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *BoundMethod) Equals(x Object) bool {
+	return o == x
+}
+
+// Call invokes the method with the receiver as the first argument.
+func (o *BoundMethod) Call(args ...Object) (Object, error) {
+	return o.CallVM(nil, args...)
+}
+
+// CallVM invokes the method with the receiver as the first argument.
+func (o *BoundMethod) CallVM(vm *VM, args ...Object) (Object, error) {
+	return vm.Call(o.Method, append([]Object{o.Receiver}, args...)...)
+}
+
+// CanCall returns whether the Object can be Called.
+func (o *BoundMethod) CanCall() bool {
+	return true
+}
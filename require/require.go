@@ -138,6 +138,15 @@ func Equal(
 		Equal(t, expected.Value, actual.(*tengo.Int).Value, msg...)
 	case *tengo.Float:
 		Equal(t, expected.Value, actual.(*tengo.Float).Value, msg...)
+	case *tengo.BigInt:
+		if expected.Value.Cmp(actual.(*tengo.BigInt).Value) != 0 {
+			failExpectedActual(t, expected, actual, msg...)
+		}
+	case *tengo.Decimal:
+		a := actual.(*tengo.Decimal)
+		if expected.Scale != a.Scale || expected.Value.Cmp(a.Value) != 0 {
+			failExpectedActual(t, expected, actual, msg...)
+		}
 	case *tengo.String:
 		Equal(t, expected.Value, actual.(*tengo.String).Value, msg...)
 	case *tengo.Char:
@@ -160,9 +169,13 @@ func Equal(
 	case *tengo.Map:
 		equalObjectMap(t, expected.Value,
 			actual.(*tengo.Map).Value, msg...)
+		equalHashed(t, expected.Hashed,
+			actual.(*tengo.Map).Hashed, msg...)
 	case *tengo.ImmutableMap:
 		equalObjectMap(t, expected.Value,
 			actual.(*tengo.ImmutableMap).Value, msg...)
+		equalHashed(t, expected.Hashed,
+			actual.(*tengo.ImmutableMap).Hashed, msg...)
 	case *tengo.CompiledFunction:
 		equalCompiledFunction(t, expected,
 			actual.(*tengo.CompiledFunction), msg...)
@@ -295,6 +308,19 @@ func equalObjectMap(
 	}
 }
 
+func equalHashed(
+	t *testing.T,
+	expected, actual map[tengo.HashKey]tengo.MapEntry,
+	msg ...interface{},
+) {
+	Equal(t, len(expected), len(actual), msg...)
+	for key, expectedEntry := range expected {
+		actualEntry := actual[key]
+		Equal(t, expectedEntry.Key, actualEntry.Key, msg...)
+		Equal(t, expectedEntry.Value, actualEntry.Value, msg...)
+	}
+}
+
 func equalCompiledFunction(
 	t *testing.T,
 	expected, actual tengo.Object,
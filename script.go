@@ -15,8 +15,16 @@ type Script struct {
 	modules          ModuleGetter
 	input            []byte
 	maxAllocs        int64
+	maxInsts         int64
+	maxMemory        int64
+	maxStringLen     int
+	maxBytesLen      int
 	maxConstObjects  int
+	maxStack         int
+	maxFrames        int
+	maxGlobals       int
 	enableFileImport bool
+	overflowCheck    bool
 	importDir        string
 }
 
@@ -26,7 +34,14 @@ func NewScript(input []byte) *Script {
 		variables:       make(map[string]*Variable),
 		input:           input,
 		maxAllocs:       -1,
+		maxInsts:        -1,
+		maxMemory:       -1,
+		maxStringLen:    -1,
+		maxBytesLen:     -1,
 		maxConstObjects: -1,
+		maxStack:        StackSize,
+		maxFrames:       MaxFrames,
+		maxGlobals:      GlobalsSize,
 	}
 }
 
@@ -75,18 +90,77 @@ func (s *Script) SetMaxAllocs(n int64) {
 	s.maxAllocs = n
 }
 
+// SetMaxInstructions sets the maximum number of instructions executed during
+// the run time. Compiled script will return ErrInstructionLimit error if it
+// exceeds this limit.
+func (s *Script) SetMaxInstructions(n int64) {
+	s.maxInsts = n
+}
+
+// SetMaxMemory sets the maximum number of bytes allocated for strings,
+// bytes, arrays and maps during the run time. Compiled script will return
+// ErrMemoryLimit error if it exceeds this limit.
+func (s *Script) SetMaxMemory(n int64) {
+	s.maxMemory = n
+}
+
+// SetMaxStringLen sets the maximum byte-length of string values created
+// during the run time. Compiled script will return ErrStringLimit error if it
+// exceeds this limit. MaxStringLen is still applied to all scripts.
+func (s *Script) SetMaxStringLen(n int) {
+	s.maxStringLen = n
+}
+
+// SetMaxBytesLen sets the maximum length of bytes values created during the
+// run time. Compiled script will return ErrBytesLimit error if it exceeds
+// this limit. MaxBytesLen is still applied to all scripts.
+func (s *Script) SetMaxBytesLen(n int) {
+	s.maxBytesLen = n
+}
+
 // SetMaxConstObjects sets the maximum number of objects in the compiled
 // constants.
 func (s *Script) SetMaxConstObjects(n int) {
 	s.maxConstObjects = n
 }
 
+// SetMaxStackSize sets the maximum number of values the stack can hold during
+// the run time. Compiled script will return ErrStackOverflow error if it
+// exceeds this limit. The default is StackSize, and a negative value means no
+// limit.
+func (s *Script) SetMaxStackSize(n int) {
+	s.maxStack = n
+}
+
+// SetMaxFrames sets the maximum depth of function calls during the run time.
+// Compiled script will return ErrStackOverflow error if it exceeds this
+// limit. The default is MaxFrames, and a negative value means no limit.
+func (s *Script) SetMaxFrames(n int) {
+	s.maxFrames = n
+}
+
+// SetMaxGlobals sets the maximum number of global variables, including the
+// variables added to the script. Compile will return an error if the script
+// exceeds this limit. The default is GlobalsSize, and a negative value means
+// the limit is MaxGlobals, which also caps larger values.
+func (s *Script) SetMaxGlobals(n int) {
+	s.maxGlobals = n
+}
+
 // EnableFileImport enables or disables module loading from local files. Local
 // file modules are disabled by default.
 func (s *Script) EnableFileImport(enable bool) {
 	s.enableFileImport = enable
 }
 
+// EnableOverflowCheck enables or disables the overflow check of int values.
+// When enabled, the compiled script will return ErrIntOverflow error if the
+// result of an int operation overflows, instead of wrapping around. The
+// overflow check is disabled by default.
+func (s *Script) EnableOverflowCheck(enable bool) {
+	s.overflowCheck = enable
+}
+
 // Compile compiles the script with all the defined variables, and, returns
 // Compiled object.
 func (s *Script) Compile() (*Compiled, error) {
@@ -106,12 +180,21 @@ func (s *Script) Compile() (*Compiled, error) {
 	c := NewCompiler(srcFile, symbolTable, nil, s.modules, nil)
 	c.EnableFileImport(s.enableFileImport)
 	c.SetImportDir(s.importDir)
+	c.SetMaxStringLen(s.maxStringLen)
 	if err := c.Compile(file); err != nil {
 		return nil, err
 	}
 
-	// reduce globals size
-	globals = globals[:symbolTable.MaxSymbols()+1]
+	// allocate globals
+	numGlobals := symbolTable.MaxSymbols()
+	maxGlobals := s.maxGlobals
+	if maxGlobals < 0 || maxGlobals > MaxGlobals {
+		maxGlobals = MaxGlobals
+	}
+	if numGlobals > maxGlobals {
+		return nil, fmt.Errorf("exceeding globals limit: %d", numGlobals)
+	}
+	globals = append(globals, make([]Object, numGlobals+1-len(globals))...)
 
 	// global symbol names to indexes
 	globalIndexes := make(map[string]int, len(globals))
@@ -138,6 +221,13 @@ func (s *Script) Compile() (*Compiled, error) {
 		bytecode:      bytecode,
 		globals:       globals,
 		maxAllocs:     s.maxAllocs,
+		maxInsts:      s.maxInsts,
+		maxMemory:     s.maxMemory,
+		maxStringLen:  s.maxStringLen,
+		maxBytesLen:   s.maxBytesLen,
+		maxStack:      s.maxStack,
+		maxFrames:     s.maxFrames,
+		overflowCheck: s.overflowCheck,
 		fullClone:     true, // we do not share bytecode or global indexes with other clones
 	}, nil
 }
@@ -180,7 +270,7 @@ func (s *Script) prepCompile() (
 		symbolTable.DefineBuiltin(idx, fn.Name)
 	}
 
-	globals = make([]Object, GlobalsSize)
+	globals = make([]Object, len(names))
 
 	for idx, name := range names {
 		symbol := symbolTable.Define(name)
@@ -200,6 +290,14 @@ type Compiled struct {
 	bytecode      *Bytecode
 	globals       []Object
 	maxAllocs     int64
+	maxInsts      int64
+	maxMemory     int64
+	maxStringLen  int
+	maxBytesLen   int
+	maxStack      int
+	maxFrames     int
+	overflowCheck bool
+	executed      int64
 	lock          sync.RWMutex
 	fullClone     bool
 }
@@ -209,7 +307,8 @@ func (c *Compiled) Run() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	v := NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v := c.newVM()
+	defer c.countExecuted(v)
 	return v.Run()
 }
 
@@ -218,7 +317,8 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	v := NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v := c.newVM()
+	defer c.countExecuted(v)
 	ch := make(chan error, 1)
 	go func() {
 		defer func() {
@@ -246,6 +346,133 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 	return
 }
 
+// Call calls the script function identified by the name with the arguments
+// and returns its result. The function is run in a new virtual machine that
+// shares the globals of the compiled script, so the script should be run
+// before calling functions that are defined by it.
+func (c *Compiled) Call(
+	name string,
+	args ...interface{},
+) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fn, objArgs, err := c.prepCall(name, args)
+	if err != nil {
+		return nil, err
+	}
+	v := c.newVM()
+	defer c.countExecuted(v)
+	ret, err := v.RunCompiled(fn, objArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return ToInterface(ret), nil
+}
+
+// CallContext is like Call but includes a context.
+func (c *Compiled) CallContext(
+	ctx context.Context,
+	name string,
+	args ...interface{},
+) (res interface{}, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fn, objArgs, err := c.prepCall(name, args)
+	if err != nil {
+		return nil, err
+	}
+	v := c.newVM()
+	defer c.countExecuted(v)
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				switch e := r.(type) {
+				case string:
+					ch <- fmt.Errorf(e)
+				case error:
+					ch <- e
+				default:
+					ch <- fmt.Errorf("unknown panic: %v", e)
+				}
+			}
+		}()
+		ret, err := v.RunCompiled(fn, objArgs...)
+		if err == nil {
+			res = ToInterface(ret)
+		}
+		ch <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		v.Abort()
+		<-ch
+		res, err = nil, ctx.Err()
+	case err = <-ch:
+	}
+	return
+}
+
+// SetMaxInstructions sets the maximum number of instructions executed by each
+// subsequent run or call. It will return ErrInstructionLimit error if it
+// exceeds this limit.
+func (c *Compiled) SetMaxInstructions(n int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.maxInsts = n
+}
+
+// ExecutedInstructions returns the number of instructions executed by the
+// last run or call.
+func (c *Compiled) ExecutedInstructions() int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.executed
+}
+
+func (c *Compiled) newVM() *VM {
+	v := NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v.SetMaxInstructions(c.maxInsts)
+	v.SetMaxMemory(c.maxMemory)
+	v.SetMaxStringLen(c.maxStringLen)
+	v.SetMaxBytesLen(c.maxBytesLen)
+	v.SetMaxStackSize(c.maxStack)
+	v.SetMaxFrames(c.maxFrames)
+	v.SetOverflowCheck(c.overflowCheck)
+	return v
+}
+
+func (c *Compiled) countExecuted(v *VM) {
+	c.executed = v.ExecutedInstructions()
+}
+
+func (c *Compiled) prepCall(
+	name string,
+	args []interface{},
+) (fn *CompiledFunction, objArgs []Object, err error) {
+	idx, ok := c.globalIndexes[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("'%s' is not defined", name)
+	}
+	fn, ok = c.globals[idx].(*CompiledFunction)
+	if !ok {
+		return nil, nil, fmt.Errorf("'%s' is not a function", name)
+	}
+	objArgs = make([]Object, len(args))
+	for i, arg := range args {
+		objArgs[i], err = FromInterface(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return
+}
+
 // Size of compiled script in bytes
 // (as much as we can calculate it without reflection and black magic)
 func (c *Compiled) Size() int64 {
@@ -266,6 +493,13 @@ func (c *Compiled) Clone() *Compiled {
 		bytecode:      c.bytecode,
 		globals:       make([]Object, len(c.globals)),
 		maxAllocs:     c.maxAllocs,
+		maxInsts:      c.maxInsts,
+		maxMemory:     c.maxMemory,
+		maxStringLen:  c.maxStringLen,
+		maxBytesLen:   c.maxBytesLen,
+		maxStack:      c.maxStack,
+		maxFrames:     c.maxFrames,
+		overflowCheck: c.overflowCheck,
 		fullClone:     false, // this clone shares bytecode and global indexes with the 'original'
 	}
 	// copy global objects
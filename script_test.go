@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -112,7 +114,7 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	require.Equal(t, "exceeding constant objects limit: 1", err.Error())
 
 	// two constants '5' and '1'
-	s = tengo.NewScript([]byte(`a := 5 + 1`))
+	s = tengo.NewScript([]byte(`a := 5; b := a + 1`))
 	s.SetMaxConstObjects(2) // limit = 2
 	_, err = s.Compile()
 	require.NoError(t, err)
@@ -121,8 +123,18 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, "exceeding constant objects limit: 2", err.Error())
 
+	// constant expressions are folded into one constant
+	s = tengo.NewScript([]byte(`a := 5 + 1`))
+	s.SetMaxConstObjects(1) // limit = 1
+	_, err = s.Compile()
+	require.NoError(t, err)
+	s.SetMaxConstObjects(0) // limit = 0
+	_, err = s.Compile()
+	require.Error(t, err)
+	require.Equal(t, "exceeding constant objects limit: 1", err.Error())
+
 	// duplicates will be removed
-	s = tengo.NewScript([]byte(`a := 5 + 5`))
+	s = tengo.NewScript([]byte(`a := 5; b := a + 5`))
 	s.SetMaxConstObjects(1) // limit = 1
 	_, err = s.Compile()
 	require.NoError(t, err)
@@ -130,6 +142,10 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	_, err = s.Compile()
 	require.Error(t, err)
 	require.Equal(t, "exceeding constant objects limit: 1", err.Error())
+	s = tengo.NewScript([]byte(`a := 5 + 5`))
+	s.SetMaxConstObjects(1) // limit = 1
+	_, err = s.Compile()
+	require.NoError(t, err)
 
 	// no limit set
 	s = tengo.NewScript([]byte(`a := 1 + 2 + 3 + 4 + 5`))
@@ -137,6 +153,342 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestScript_SetMaxInstructions(t *testing.T) {
+	s := tengo.NewScript([]byte(`a := 0; for i := 0; i < 10; i++ { a += i }`))
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(45))
+	executed := c.ExecutedInstructions()
+	require.True(t, executed > 0)
+
+	s.SetMaxInstructions(executed)
+	c, err = s.Run()
+	require.NoError(t, err)
+	require.Equal(t, executed, c.ExecutedInstructions())
+
+	s.SetMaxInstructions(executed - 1)
+	c, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrInstructionLimit))
+	require.Equal(t, executed-1, c.ExecutedInstructions())
+
+	// loops that do not allocate are stopped too
+	s = tengo.NewScript([]byte(`for {}`))
+	s.SetMaxInstructions(1000)
+	c, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrInstructionLimit))
+	require.Equal(t, int64(1000), c.ExecutedInstructions())
+
+	// limit applies to each call separately
+	c = compile(t, `
+f := func(n) {
+	for i := 0; i < n; i++ {}
+}`, nil)
+	c.SetMaxInstructions(100)
+	compiledRun(t, c)
+	_, err = c.Call("f", 5)
+	require.NoError(t, err)
+	executed = c.ExecutedInstructions()
+	_, err = c.Call("f", 10)
+	require.NoError(t, err)
+	require.True(t, c.ExecutedInstructions() > executed)
+	_, err = c.Call("f", 100)
+	require.True(t, errors.Is(err, tengo.ErrInstructionLimit))
+	c.SetMaxInstructions(-1)
+	_, err = c.Call("f", 100)
+	require.NoError(t, err)
+}
+
+func TestScript_SetMaxMemory(t *testing.T) {
+	src := []byte(`
+s := ""
+for i := 0; i < 100; i++ { s += "0123456789" }`)
+	s := tengo.NewScript(src)
+	_, err := s.Run()
+	require.NoError(t, err)
+	s.SetMaxMemory(10000)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrMemoryLimit))
+	s.SetMaxMemory(100000)
+	_, err = s.Run()
+	require.NoError(t, err)
+
+	// arrays and maps
+	s = tengo.NewScript([]byte(`a := [1, 2, 3, 4]`))
+	s.SetMaxMemory(63)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrMemoryLimit))
+	s.SetMaxMemory(64)
+	_, err = s.Run()
+	require.NoError(t, err)
+	s = tengo.NewScript([]byte(`a := {}; for i := 0; i < 10; i++ { a = {a: a} }`))
+	s.SetMaxMemory(300)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrMemoryLimit))
+
+	// builtin returns
+	s = tengo.NewScript([]byte(`
+a := []
+for i := 0; i < 100; i++ { a = append(a, i) }`))
+	s.SetMaxMemory(10000)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrMemoryLimit))
+}
+
+func TestScript_SetMaxStringLen(t *testing.T) {
+	s := tengo.NewScript([]byte(`a := "foo" + "bar"`))
+	s.SetMaxStringLen(5)
+	_, err := s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStringLimit))
+	s.SetMaxStringLen(6)
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", "foobar")
+
+	// string interpolation
+	s = tengo.NewScript([]byte(`x := "foo"; a := "${x}-${x}"`))
+	s.SetMaxStringLen(6)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStringLimit))
+	s.SetMaxStringLen(7)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", "foo-foo")
+	s.SetMaxStringLen(-1)
+	s.SetMaxMemory(6)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrMemoryLimit))
+
+	s = tengo.NewScript([]byte(`a := string(123456)`))
+	s.SetMaxStringLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStringLimit))
+
+	// builtins and stdlib functions
+	s = tengo.NewScript([]byte(`a := format("%d-%d", 123, 45)`))
+	s.SetMaxStringLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStringLimit))
+	s.SetMaxStringLen(6)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", "123-45")
+	s = tengo.NewScript([]byte(`a := import("text").repeat("abc", 2)`))
+	s.SetImports(stdlib.GetModuleMap("text"))
+	s.SetMaxStringLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStringLimit))
+	s.SetMaxStringLen(6)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", "abcabc")
+
+	s = tengo.NewScript([]byte(`a := bytes("foo") + bytes("bar")`))
+	s.SetMaxBytesLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrBytesLimit))
+	s.SetMaxBytesLen(6)
+	_, err = s.Run()
+	require.NoError(t, err)
+	s = tengo.NewScript([]byte(`a := bytes(10)`))
+	s.SetMaxBytesLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrBytesLimit))
+	s = tengo.NewScript([]byte(`a := bytes("abcdef")`))
+	s.SetMaxBytesLen(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrBytesLimit))
+}
+
+func TestScript_LimitsBeforeAllocating(t *testing.T) {
+	// each script would allocate about 100MB before failing if the limits
+	// were checked after allocating
+	large := strings.Repeat("x", 50<<20)
+	for _, src := range []string{
+		`a := text.repeat("x", 100000000)`,
+		`a := text.pad_left("x", 100000000)`,
+		`a := text.pad_right("x", 100000000)`,
+		`a := text.replace("xxxx", "x", text.repeat("y", 25000000), -1)`,
+		`a := text.join(text.split(text.repeat(",", 1000), ","),
+	text.repeat("y", 100000))`,
+		`a := bytes(100000000)`,
+		`a := format("%s%s", large, large)`,
+		`a := fmt.sprintf("%x", large)`,
+		`a := large + large`,
+	} {
+		s := tengo.NewScript([]byte(
+			`text := import("text"); fmt := import("fmt")` + "\n" + src))
+		s.SetImports(stdlib.GetModuleMap("text", "fmt"))
+		require.NoError(t, s.Add("large", large))
+		s.SetMaxMemory(1 << 20)
+		var err error
+		allocated := allocatedBytes(func() { _, err = s.Run() })
+		require.True(t, errors.Is(err, tengo.ErrMemoryLimit), "%s: %v", src, err)
+		require.True(t, allocated < 10<<20, "%s: %d", src, allocated)
+	}
+}
+
+// allocatedBytes returns the number of bytes allocated while running fn.
+func allocatedBytes(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestScript_SetMaxFrames(t *testing.T) {
+	src := []byte(`
+f := func(n) { if n == 0 { return 0 }; return 1 + f(n - 1) }
+a := f(3000)`)
+	s := tengo.NewScript(src)
+	_, err := s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStackOverflow))
+	s.SetMaxFrames(5000)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStackOverflow))
+	s.SetMaxStackSize(-1)
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(3000))
+	s.SetMaxFrames(-1)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(3000))
+
+	s.SetMaxStackSize(100)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStackOverflow))
+
+	// clones keep the settings
+	s = tengo.NewScript(src)
+	s.SetMaxFrames(100)
+	c, err = s.Compile()
+	require.NoError(t, err)
+	s.SetMaxFrames(-1)
+	s.SetMaxStackSize(-1)
+	c2, err := s.Compile()
+	require.NoError(t, err)
+	require.True(t, errors.Is(c.Clone().Run(), tengo.ErrStackOverflow))
+	require.NoError(t, c2.Clone().Run())
+
+	// limits below the initial sizes
+	s = tengo.NewScript([]byte(`
+f := func(n) { if n == 0 { return 0 }; return 1 + f(n - 1) }
+a := f(3)
+b := f(10)`))
+	s.SetMaxFrames(5)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStackOverflow))
+	s = tengo.NewScript([]byte(`a := [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]`))
+	s.SetMaxStackSize(8)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrStackOverflow))
+	s = tengo.NewScript([]byte(`a := 1 + 2`))
+	s.SetMaxStackSize(8)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(3))
+}
+
+func TestScript_SetMaxGlobals(t *testing.T) {
+	s := tengo.NewScript([]byte(`a := 1; b := 2; if a { c := a + b + x }`))
+	require.NoError(t, s.Add("x", 1))
+	s.SetMaxGlobals(3)
+	_, err := s.Compile()
+	require.Error(t, err)
+	require.Equal(t, "exceeding globals limit: 4", err.Error())
+	s.SetMaxGlobals(4)
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "b", int64(2))
+
+	var src strings.Builder
+	for i := 0; i < 1500; i++ {
+		_, _ = fmt.Fprintf(&src, "a%d := %d\n", i, i)
+	}
+	s = tengo.NewScript([]byte(src.String()))
+	_, err = s.Compile()
+	require.Error(t, err)
+	require.Equal(t, "exceeding globals limit: 1500", err.Error())
+	s.SetMaxGlobals(-1)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a1499", int64(1499))
+
+	// global indexes are 2-byte operands
+	src.Reset()
+	for i := 0; i < tengo.MaxGlobals; i++ {
+		_, _ = fmt.Fprintf(&src, "a%d := %d\n", i, i)
+	}
+	s = tengo.NewScript([]byte(src.String()))
+	s.SetMaxGlobals(-1)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a65535", int64(65535))
+	s = tengo.NewScript([]byte(src.String() + "b := 1"))
+	s.SetMaxGlobals(-1)
+	_, err = s.Compile()
+	require.Error(t, err)
+	require.Equal(t, "exceeding globals limit: 65537", err.Error())
+	s.SetMaxGlobals(1 << 20)
+	_, err = s.Compile()
+	require.Error(t, err)
+	require.Equal(t, "exceeding globals limit: 65537", err.Error())
+}
+
+func TestScript_EnableOverflowCheck(t *testing.T) {
+	s := tengo.NewScript([]byte(`a := 9223372036854775807 + 1`))
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(math.MinInt64))
+	s.EnableOverflowCheck(true)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, tengo.ErrIntOverflow))
+
+	for _, src := range []string{
+		`a := -9223372036854775807 - 2`,
+		`a := 4611686018427387904 * 2`,
+		`a := -9223372036854775807 - 1; b := a / -1`,
+		`a := -9223372036854775807 - 1; b := -a`,
+		`a := 1 << 63`,
+		`a := 9223372036854775807; a++`,
+		`a := 9223372036854775807; a += 1`,
+	} {
+		s := tengo.NewScript([]byte(src))
+		s.EnableOverflowCheck(true)
+		_, err := s.Run()
+		require.True(t, errors.Is(err, tengo.ErrIntOverflow), src)
+	}
+
+	// no overflow
+	s = tengo.NewScript([]byte(`
+a := 9223372036854775806 + 1
+b := -9223372036854775807 - 1
+c := 3037000499 * 3037000499
+d := 1 << 62
+e := 9223372036854775807n + 1
+f := -4611686018427387904 * 2`))
+	s.EnableOverflowCheck(true)
+	c, err = s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(math.MaxInt64))
+	compiledGet(t, c, "b", int64(math.MinInt64))
+	compiledGet(t, c, "c", int64(9223372030926249001))
+	compiledGet(t, c, "d", int64(1<<62))
+	compiledGet(t, c, "f", int64(math.MinInt64))
+	require.Equal(t, "9223372036854775808", c.Get("e").String())
+
+	// clones keep the setting
+	s = tengo.NewScript([]byte(`b := a + 1`))
+	require.NoError(t, s.Add("a", 0))
+	s.EnableOverflowCheck(true)
+	c, err = s.Compile()
+	require.NoError(t, err)
+	clone := c.Clone()
+	require.NoError(t, clone.Set("a", math.MaxInt64))
+	require.True(t, errors.Is(clone.Run(), tengo.ErrIntOverflow))
+}
+
 func TestScriptConcurrency(t *testing.T) {
 	solve := func(a, b, c int) (d, e int) {
 		a += 2
@@ -288,6 +640,14 @@ func (o *Counter) CanCall() bool {
 	return true
 }
 
+func (o *Counter) Contains(x tengo.Object) (bool, error) {
+	i, ok := x.(*tengo.Int)
+	if !ok {
+		return false, tengo.ErrInvalidOperator
+	}
+	return i.Value >= 0 && i.Value < o.value, nil
+}
+
 func TestScript_CustomObjects(t *testing.T) {
 	c := compile(t, `a := c1(); s := string(c1); c2 := c1; c2++`, M{
 		"c1": &Counter{value: 5},
@@ -308,6 +668,21 @@ out := c1()
 	})
 	compiledRun(t, c)
 	compiledGet(t, c, "out", int64(15))
+
+	c = compile(t, `a := 4 in c1; b := 5 not in c1`, M{
+		"c1": &Counter{value: 5},
+	})
+	compiledRun(t, c)
+	compiledGet(t, c, "a", true)
+	compiledGet(t, c, "b", true)
+
+	c = compile(t, `a := "x" in c1`, M{
+		"c1": &Counter{value: 5},
+	})
+	err := c.Run()
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(),
+		"invalid operation: string in counter"))
 }
 
 func compiledGetCounter(
@@ -480,6 +855,124 @@ func TestCompiled_RunContext(t *testing.T) {
 	require.Equal(t, context.DeadlineExceeded, err)
 }
 
+func TestCompiled_Call(t *testing.T) {
+	c := compile(t, `
+count := 0
+add := func(a, b) {
+	count += 1
+	return a + b
+}
+sum := func(...args) {
+	s := 0
+	for a in args { s = add(s, a) }
+	return s
+}
+fail := func(x) {
+	return x + "foo"
+}
+loop := func() { for {} }
+`, nil)
+	compiledRun(t, c)
+
+	res, err := c.Call("add", 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), res)
+	res, err = c.Call("add", "foo", "bar")
+	require.NoError(t, err)
+	require.Equal(t, "foobar", res)
+	res, err = c.Call("sum", 1, 2, 3, 4)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), res)
+	compiledGet(t, c, "count", int64(6))
+
+	_, err = c.Call("add", 1)
+	require.Error(t, err)
+	require.Equal(t, "Runtime Error: wrong number of arguments: want=2, got=1",
+		err.Error())
+	_, err = c.Call("fail", 1)
+	require.Error(t, err)
+	require.Equal(t,
+		"Runtime Error: invalid operation: int + string\n\tat (main):13:9",
+		err.Error())
+	_, err = c.Call("count")
+	require.Error(t, err)
+	_, err = c.Call("foo")
+	require.Error(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		1*time.Millisecond)
+	defer cancel()
+	_, err = c.CallContext(ctx, "loop")
+	require.Equal(t, context.DeadlineExceeded, err)
+	res, err = c.CallContext(context.Background(), "add", 5, 6)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), res)
+
+	s := tengo.NewScript([]byte(`
+alloc := func(n) {
+	a := []
+	for i := 0; i < n; i++ { a = append(a, i) }
+	return a
+}`))
+	s.SetMaxAllocs(30)
+	c, err = s.Run()
+	require.NoError(t, err)
+	_, err = c.Call("alloc", 5)
+	require.NoError(t, err)
+	_, err = c.Call("alloc", 20)
+	require.True(t, errors.Is(err, tengo.ErrObjectAllocLimit))
+}
+
+func TestCompiled_Generator(t *testing.T) {
+	c := compile(t, `
+gen := func(n) {
+	for i := 0; i < n; i++ { yield i * 10 }
+	yield 1 + "a"
+}
+g := gen(2)`, nil)
+	compiledRun(t, c)
+
+	// the generator is resumed by Go code after the script has finished
+	g := c.Get("g").Value().(*tengo.Generator)
+	require.True(t, g.Next())
+	require.Equal(t, &tengo.Int{Value: 0}, g.Key())
+	require.Equal(t, &tengo.Int{Value: 0}, g.Value())
+	require.True(t, g.Next())
+	require.Equal(t, &tengo.Int{Value: 1}, g.Key())
+	require.Equal(t, &tengo.Int{Value: 10}, g.Value())
+	require.False(t, g.Next())
+	require.Equal(t,
+		"Runtime Error: invalid operation: int + string\n\tat (main):4:8",
+		g.Err().Error())
+	require.False(t, g.Next())
+
+	res, err := c.Call("gen", 1)
+	require.NoError(t, err)
+	g = res.(*tengo.Generator)
+	require.True(t, g.Next())
+	require.Equal(t, &tengo.Int{Value: 0}, g.Value())
+	require.NoError(t, g.Err())
+
+	// a generator stored in a global is resumed on the VM iterating it, so
+	// the limits of that VM apply
+	c = compile(t, `
+gen := func() {
+	for {
+		for i := 0; i < 1000; i++ {}
+		yield 1
+	}
+}
+g := gen()
+next := func() { for v in g { return v } }`, nil)
+	compiledRun(t, c)
+	res, err = c.Call("next")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res)
+	c.SetMaxInstructions(100)
+	_, err = c.Call("next")
+	require.True(t, errors.Is(err, tengo.ErrInstructionLimit))
+}
+
 func TestCompiled_CustomObject(t *testing.T) {
 	c := compile(t, `r := (t<130)`, M{"t": &customNumber{value: 123}})
 	compiledRun(t, c)
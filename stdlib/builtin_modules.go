@@ -6,13 +6,14 @@ import (
 
 // BuiltinModules are builtin type standard library modules.
 var BuiltinModules = map[string]map[string]tengo.Object{
-	"math":   mathModule,
-	"os":     osModule,
-	"text":   textModule,
-	"times":  timesModule,
-	"rand":   randModule,
-	"fmt":    fmtModule,
-	"json":   jsonModule,
-	"base64": base64Module,
-	"hex":    hexModule,
+	"math":    mathModule,
+	"os":      osModule,
+	"text":    textModule,
+	"times":   timesModule,
+	"rand":    randModule,
+	"fmt":     fmtModule,
+	"json":    jsonModule,
+	"base64":  base64Module,
+	"hex":     hexModule,
+	"decimal": decimalModule,
 }
@@ -0,0 +1,91 @@
+package stdlib
+
+import (
+	"github.com/d5/tengo/v2"
+)
+
+var decimalModule = map[string]tengo.Object{
+	"half_even": &tengo.Int{Value: int64(tengo.RoundHalfEven)},
+	"half_up":   &tengo.Int{Value: int64(tengo.RoundHalfUp)},
+	"down":      &tengo.Int{Value: int64(tengo.RoundDown)},
+	"round": &tengo.UserFunction{
+		Name:  "round",
+		Value: decimalRound,
+	},
+	"scale": &tengo.UserFunction{
+		Name:  "scale",
+		Value: decimalScale,
+	},
+}
+
+func decimalRound(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+
+	d, ok := tengo.ToDecimal(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "decimal(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	places, ok := tengo.ToInt(args[1])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	if places < -tengo.MaxDecimalScale || places > tengo.MaxDecimalScale {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "decimal places",
+			Found:    args[1].String(),
+		}
+	}
+
+	mode := tengo.RoundHalfEven
+	if len(args) == 3 {
+		m, ok := args[2].(*tengo.Int)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "third",
+				Expected: "int",
+				Found:    args[2].TypeName(),
+			}
+		}
+		switch tengo.RoundingMode(m.Value) {
+		case tengo.RoundHalfEven, tengo.RoundHalfUp, tengo.RoundDown:
+			mode = tengo.RoundingMode(m.Value)
+		default:
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "third",
+				Expected: "rounding mode",
+				Found:    m.String(),
+			}
+		}
+	}
+
+	return d.Round(places, mode), nil
+}
+
+func decimalScale(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+
+	d, ok := tengo.ToDecimal(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "decimal(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	return &tengo.Int{Value: int64(d.Scale)}, nil
+}
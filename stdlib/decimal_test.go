@@ -0,0 +1,44 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/d5/tengo/v2"
+)
+
+func TestDecimal(t *testing.T) {
+	module(t, "decimal").call("round", dec("2.345"), 2).expect(dec("2.34"))
+	module(t, "decimal").call("round", dec("2.355"), 2).expect(dec("2.36"))
+	module(t, "decimal").call("round", dec("-2.345"), 2).expect(dec("-2.34"))
+	module(t, "decimal").call("round", dec("2.345"), 2, 0).expect(dec("2.34"))
+	module(t, "decimal").call("round", dec("2.345"), 2, 1).expect(dec("2.35"))
+	module(t, "decimal").call("round", dec("-2.345"), 2, 1).expect(dec("-2.35"))
+	module(t, "decimal").call("round", dec("2.349"), 2, 2).expect(dec("2.34"))
+	module(t, "decimal").call("round", dec("-2.349"), 2, 2).expect(dec("-2.34"))
+	module(t, "decimal").call("round", dec("1.5"), 3).expect(dec("1.500"))
+	module(t, "decimal").call("round", dec("1250"), -2).expect(dec("1200"))
+	module(t, "decimal").call("round", dec("1350"), -2).expect(dec("1400"))
+	module(t, "decimal").call("round", "12.345", 1).expect(dec("12.3"))
+	module(t, "decimal").call("round", 5, 2).expect(dec("5.00"))
+	module(t, "decimal").call("round", dec("1.5"), 0, 3).expectError()
+	module(t, "decimal").call("round", dec("1.5"), 1<<20).expectError()
+	module(t, "decimal").call("round", "foo", 2).expectError()
+	module(t, "decimal").call("round", dec("1.5")).expectError()
+
+	module(t, "decimal").call("scale", dec("12.340")).expect(3)
+	module(t, "decimal").call("scale", 12).expect(0)
+	module(t, "decimal").call("scale", "foo").expectError()
+
+	expect(t, `
+dec := import("decimal")
+out := dec.round(10d / 3, 2, dec.half_up) + dec.round(0.125d, 2, dec.down)`,
+		dec("3.45"))
+}
+
+func dec(s string) *tengo.Decimal {
+	d, err := tengo.ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
@@ -10,7 +10,11 @@ var fmtModule = map[string]tengo.Object{
 	"print":   &tengo.UserFunction{Name: "print", Value: fmtPrint},
 	"printf":  &tengo.UserFunction{Name: "printf", Value: fmtPrintf},
 	"println": &tengo.UserFunction{Name: "println", Value: fmtPrintln},
-	"sprintf": &tengo.UserFunction{Name: "sprintf", Value: fmtSprintf},
+	"sprintf": &tengo.UserFunction{
+		Name:    "sprintf",
+		Value:   fmtSprintf,
+		VMValue: fmtSprintfVM,
+	},
 }
 
 func fmtPrint(args ...tengo.Object) (ret tengo.Object, err error) {
@@ -60,6 +64,13 @@ func fmtPrintln(args ...tengo.Object) (ret tengo.Object, err error) {
 }
 
 func fmtSprintf(args ...tengo.Object) (ret tengo.Object, err error) {
+	return fmtSprintfVM(nil, args...)
+}
+
+func fmtSprintfVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	numArgs := len(args)
 	if numArgs == 0 {
 		return nil, tengo.ErrWrongNumArguments
@@ -77,7 +88,7 @@ func fmtSprintf(args ...tengo.Object) (ret tengo.Object, err error) {
 		// okay to return 'format' directly as String is immutable
 		return format, nil
 	}
-	s, err := tengo.Format(format.Value, args[1:]...)
+	s, err := vm.Format(format.Value, args[1:]...)
 	if err != nil {
 		return nil, err
 	}
@@ -16,4 +16,17 @@ func TestFmtSprintf(t *testing.T) {
 		expect(`foo {a: {b: {c: [1, 2, 3]}}}`)
 	module(t, `fmt`).call("sprintf", "%v", IARR{1, IARR{2, IARR{3, 4}}}).
 		expect(`[1, [2, [3, 4]]]`)
+
+	// decimal values are formatted without converting to float
+	module(t, `fmt`).call("sprintf", "%v %s %f", dec("12.30"),
+		dec("0.1"), dec("-123456789.123456789123456789")).
+		expect(`12.30 0.1 -123456789.123456789123456789`)
+	module(t, `fmt`).call("sprintf", "%.2f %.2f %.0f %.3f", dec("1.005"),
+		dec("1.015"), dec("2.5"), dec("1.5")).
+		expect(`1.00 1.02 2 1.500`)
+	module(t, `fmt`).call("sprintf", "[%8.2f] [%-8.2f] [%08.2f] [%+.1f]",
+		dec("3.14159"), dec("3.14159"), dec("-3.14159"), dec("2")).
+		expect(`[    3.14] [3.14    ] [-0003.14] [+2.0]`)
+	module(t, `fmt`).call("sprintf", "%d", dec("1")).
+		expect(`%!d(1=1)`)
 }
@@ -7,6 +7,7 @@
 package json
 
 import (
+	"math/big"
 	"strconv"
 	"unicode"
 	"unicode/utf16"
@@ -218,7 +219,12 @@ func (d *decodeState) literal() (tengo.Object, error) {
 			n, _ := strconv.ParseFloat(string(item), 10)
 			return &tengo.Float{Value: n}, nil
 		}
-		n, _ := strconv.ParseInt(string(item), 10, 64)
+		n, err := strconv.ParseInt(string(item), 10, 64)
+		if err != nil {
+			// integers out of the int64 range are decoded as big-int
+			v, _ := new(big.Int).SetString(string(item), 10)
+			return &tengo.BigInt{Value: v}, nil
+		}
 		return &tengo.Int{Value: n}, nil
 	}
 }
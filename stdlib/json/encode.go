@@ -158,41 +158,9 @@ func Encode(o tengo.Object) ([]byte, error) {
 		}
 		b = append(b, ']')
 	case *tengo.Map:
-		b = append(b, '{')
-		len1 := len(o.Value) - 1
-		idx := 0
-		for key, value := range o.Value {
-			b = encodeString(b, key)
-			b = append(b, ':')
-			eb, err := Encode(value)
-			if err != nil {
-				return nil, err
-			}
-			b = append(b, eb...)
-			if idx < len1 {
-				b = append(b, ',')
-			}
-			idx++
-		}
-		b = append(b, '}')
+		return encodeMap(b, o.Value, o.Hashed)
 	case *tengo.ImmutableMap:
-		b = append(b, '{')
-		len1 := len(o.Value) - 1
-		idx := 0
-		for key, value := range o.Value {
-			b = encodeString(b, key)
-			b = append(b, ':')
-			eb, err := Encode(value)
-			if err != nil {
-				return nil, err
-			}
-			b = append(b, eb...)
-			if idx < len1 {
-				b = append(b, ',')
-			}
-			idx++
-		}
-		b = append(b, '}')
+		return encodeMap(b, o.Value, o.Hashed)
 	case *tengo.Bool:
 		if o.IsFalsy() {
 			b = strconv.AppendBool(b, false)
@@ -238,6 +206,10 @@ func Encode(o tengo.Object) ([]byte, error) {
 		b = append(b, y...)
 	case *tengo.Int:
 		b = strconv.AppendInt(b, o.Value, 10)
+	case *tengo.BigInt:
+		b = o.Value.Append(b, 10)
+	case *tengo.Decimal:
+		b = append(b, o.String()...)
 	case *tengo.String:
 		// string encoding bug is fixed with newly introduced function
 		// encodeString(). See: https://github.com/d5/tengo/issues/268
@@ -256,6 +228,49 @@ func Encode(o tengo.Object) ([]byte, error) {
 	return b, nil
 }
 
+// encodeMap encodes the entries of a map as a JSON object. The keys other
+// than strings are encoded using their string form.
+func encodeMap(
+	b []byte,
+	v map[string]tengo.Object,
+	h map[tengo.HashKey]tengo.MapEntry,
+) ([]byte, error) {
+	b = append(b, '{')
+	idx := 0
+	encodeEntry := func(key string, value tengo.Object) error {
+		if idx > 0 {
+			b = append(b, ',')
+		}
+		idx++
+		b = encodeString(b, key)
+		b = append(b, ':')
+		eb, err := Encode(value)
+		if err != nil {
+			return err
+		}
+		b = append(b, eb...)
+		return nil
+	}
+	for key, value := range v {
+		if err := encodeEntry(key, value); err != nil {
+			return nil, err
+		}
+	}
+	seen := make(map[string]bool, len(h))
+	for _, e := range h {
+		key, _ := tengo.ToString(e.Key)
+		if _, ok := v[key]; ok || seen[key] {
+			return nil, errors.New("duplicate key: " + strconv.Quote(key))
+		}
+		seen[key] = true
+		if err := encodeEntry(key, e.Value); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, '}')
+	return b, nil
+}
+
 // encodeString encodes given string as JSON string according to
 // https://www.json.org/img/string.png
 // Implementation is inspired by https://github.com/json-iterator/go
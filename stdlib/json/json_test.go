@@ -2,6 +2,7 @@ package json_test
 
 import (
 	gojson "encoding/json"
+	"math/big"
 	"testing"
 
 	"github.com/d5/tengo/v2"
@@ -60,6 +61,40 @@ func TestJSON(t *testing.T) {
 
 	testJSONEncodeDecode(t, MAP{"id1": 7075984636689534001, "id2": 7075984636689534002})
 	testJSONEncodeDecode(t, ARR{1e3, 1E7})
+
+	big1, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	big2, _ := new(big.Int).SetString("-98765432109876543210", 10)
+	testJSONEncodeDecode(t, big1)
+	testJSONEncodeDecode(t, MAP{"a": big1, "b": ARR{big2, 1}})
+}
+
+func TestEncodeHashedKeys(t *testing.T) {
+	m := &tengo.Map{Value: map[string]tengo.Object{
+		"a": &tengo.Int{Value: 1},
+	}}
+	require.NoError(t, m.IndexSet(&tengo.Int{Value: 2},
+		&tengo.String{Value: "two"}))
+	expected := &tengo.Map{Value: map[string]tengo.Object{
+		"a": &tengo.Int{Value: 1},
+		"2": &tengo.String{Value: "two"},
+	}}
+	b, err := json.Encode(m)
+	require.NoError(t, err)
+	a, err := json.Decode(b)
+	require.NoError(t, err)
+	require.Equal(t, expected, a)
+
+	b, err = json.Encode(&tengo.ImmutableMap{Value: m.Value, Hashed: m.Hashed})
+	require.NoError(t, err)
+	a, err = json.Decode(b)
+	require.NoError(t, err)
+	require.Equal(t, expected, a)
+
+	// keys with the same string form
+	require.NoError(t, m.IndexSet(&tengo.String{Value: "2"},
+		&tengo.String{Value: "dup"}))
+	_, err = json.Encode(m)
+	require.Error(t, err)
 }
 
 func TestDecode(t *testing.T) {
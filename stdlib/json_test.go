@@ -3,6 +3,9 @@ package stdlib_test
 import "testing"
 
 func TestJSON(t *testing.T) {
+	module(t, "json").call("encode", MAP{"a": dec("12.345678901234567890")}).
+		expect([]byte(`{"a":12.345678901234567890}`))
+
 	module(t, "json").call("encode", 5).
 		expect([]byte("5"))
 	module(t, "json").call("encode", "foobar").
@@ -72,8 +72,9 @@ var textModule = map[string]tengo.Object{
 		Value: FuncASSRI(strings.IndexAny),
 	}, // index_any(s, chars) => int
 	"join": &tengo.UserFunction{
-		Name:  "join",
-		Value: textJoin,
+		Name:    "join",
+		Value:   textJoin,
+		VMValue: textJoinVM,
 	}, // join(arr, sep) => string
 	"last_index": &tengo.UserFunction{
 		Name:  "last_index",
@@ -84,12 +85,14 @@ var textModule = map[string]tengo.Object{
 		Value: FuncASSRI(strings.LastIndexAny),
 	}, // last_index_any(s, chars) => int
 	"repeat": &tengo.UserFunction{
-		Name:  "repeat",
-		Value: textRepeat,
+		Name:    "repeat",
+		Value:   textRepeat,
+		VMValue: textRepeatVM,
 	}, // repeat(s, count) => string
 	"replace": &tengo.UserFunction{
-		Name:  "replace",
-		Value: textReplace,
+		Name:    "replace",
+		Value:   textReplace,
+		VMValue: textReplaceVM,
 	}, // replace(s, old, new, n) => string
 	"substr": &tengo.UserFunction{
 		Name:  "substr",
@@ -128,12 +131,14 @@ var textModule = map[string]tengo.Object{
 		Value: FuncASRS(strings.ToUpper),
 	}, // to_upper(s) => string
 	"pad_left": &tengo.UserFunction{
-		Name:  "pad_left",
-		Value: textPadLeft,
+		Name:    "pad_left",
+		Value:   textPadLeft,
+		VMValue: textPadLeftVM,
 	}, // pad_left(s, pad_len, pad_with) => string
 	"pad_right": &tengo.UserFunction{
-		Name:  "pad_right",
-		Value: textPadRight,
+		Name:    "pad_right",
+		Value:   textPadRight,
+		VMValue: textPadRightVM,
 	}, // pad_right(s, pad_len, pad_with) => string
 	"trim": &tengo.UserFunction{
 		Name:  "trim",
@@ -470,6 +475,13 @@ func textRECompile(args ...tengo.Object) (ret tengo.Object, err error) {
 }
 
 func textReplace(args ...tengo.Object) (ret tengo.Object, err error) {
+	return textReplaceVM(nil, args...)
+}
+
+func textReplaceVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	if len(args) != 4 {
 		err = tengo.ErrWrongNumArguments
 		return
@@ -515,9 +527,8 @@ func textReplace(args ...tengo.Object) (ret tengo.Object, err error) {
 		return
 	}
 
-	s, ok := doTextReplace(s1, s2, s3, i4)
-	if !ok {
-		err = tengo.ErrStringLimit
+	s, err := doTextReplace(vm, s1, s2, s3, i4)
+	if err != nil {
 		return
 	}
 
@@ -590,6 +601,13 @@ func textSubstring(args ...tengo.Object) (ret tengo.Object, err error) {
 }
 
 func textPadLeft(args ...tengo.Object) (ret tengo.Object, err error) {
+	return textPadLeftVM(nil, args...)
+}
+
+func textPadLeftVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	argslen := len(args)
 	if argslen != 2 && argslen != 3 {
 		err = tengo.ErrWrongNumArguments
@@ -616,16 +634,16 @@ func textPadLeft(args ...tengo.Object) (ret tengo.Object, err error) {
 		return
 	}
 
-	if i2 > tengo.MaxStringLen {
-		return nil, tengo.ErrStringLimit
-	}
-
 	sLen := len(s1)
 	if sLen >= i2 {
 		ret = &tengo.String{Value: s1}
 		return
 	}
 
+	if err = vm.CheckStringLen(i2); err != nil {
+		return
+	}
+
 	s3 := " "
 	if argslen == 3 {
 		s3, ok = tengo.ToString(args[2])
@@ -653,6 +671,13 @@ func textPadLeft(args ...tengo.Object) (ret tengo.Object, err error) {
 }
 
 func textPadRight(args ...tengo.Object) (ret tengo.Object, err error) {
+	return textPadRightVM(nil, args...)
+}
+
+func textPadRightVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	argslen := len(args)
 	if argslen != 2 && argslen != 3 {
 		err = tengo.ErrWrongNumArguments
@@ -679,16 +704,16 @@ func textPadRight(args ...tengo.Object) (ret tengo.Object, err error) {
 		return
 	}
 
-	if i2 > tengo.MaxStringLen {
-		return nil, tengo.ErrStringLimit
-	}
-
 	sLen := len(s1)
 	if sLen >= i2 {
 		ret = &tengo.String{Value: s1}
 		return
 	}
 
+	if err = vm.CheckStringLen(i2); err != nil {
+		return
+	}
+
 	s3 := " "
 	if argslen == 3 {
 		s3, ok = tengo.ToString(args[2])
@@ -716,6 +741,13 @@ func textPadRight(args ...tengo.Object) (ret tengo.Object, err error) {
 }
 
 func textRepeat(args ...tengo.Object) (ret tengo.Object, err error) {
+	return textRepeatVM(nil, args...)
+}
+
+func textRepeatVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	if len(args) != 2 {
 		return nil, tengo.ErrWrongNumArguments
 	}
@@ -738,14 +770,24 @@ func textRepeat(args ...tengo.Object) (ret tengo.Object, err error) {
 		}
 	}
 
-	if len(s1)*i2 > tengo.MaxStringLen {
+	if i2 > 0 && len(s1) > tengo.MaxStringLen/i2 {
 		return nil, tengo.ErrStringLimit
 	}
+	if err = vm.CheckStringLen(len(s1) * i2); err != nil {
+		return
+	}
 
 	return &tengo.String{Value: strings.Repeat(s1, i2)}, nil
 }
 
 func textJoin(args ...tengo.Object) (ret tengo.Object, err error) {
+	return textJoinVM(nil, args...)
+}
+
+func textJoinVM(
+	vm *tengo.VM,
+	args ...tengo.Object,
+) (ret tengo.Object, err error) {
 	if len(args) != 2 {
 		return nil, tengo.ErrWrongNumArguments
 	}
@@ -797,8 +839,11 @@ func textJoin(args ...tengo.Object) (ret tengo.Object, err error) {
 	}
 
 	// make sure output length does not exceed the limit
-	if slen+len(s2)*(len(ss1)-1) > tengo.MaxStringLen {
-		return nil, tengo.ErrStringLimit
+	if len(ss1) > 0 {
+		slen += len(s2) * (len(ss1) - 1)
+	}
+	if err = vm.CheckStringLen(slen); err != nil {
+		return
 	}
 
 	return &tengo.String{Value: strings.Join(ss1, s2)}, nil
@@ -1028,20 +1073,31 @@ func textParseInt(args ...tengo.Object) (ret tengo.Object, err error) {
 
 // Modified implementation of strings.Replace
 // to limit the maximum length of output string.
-func doTextReplace(s, old, new string, n int) (string, bool) {
+func doTextReplace(
+	vm *tengo.VM,
+	s, old, new string,
+	n int,
+) (string, error) {
 	if old == new || n == 0 {
-		return s, true // avoid allocation
+		return s, nil // avoid allocation
 	}
 
 	// Compute number of replacements.
 	if m := strings.Count(s, old); m == 0 {
-		return s, true // avoid allocation
+		return s, nil // avoid allocation
 	} else if n < 0 || m < n {
 		n = m
 	}
 
 	// Apply replacements to buffer.
-	t := make([]byte, len(s)+n*(len(new)-len(old)))
+	if d := len(new) - len(old); d > 0 && n > (tengo.MaxStringLen-len(s))/d {
+		return "", tengo.ErrStringLimit
+	}
+	tlen := len(s) + n*(len(new)-len(old))
+	if err := vm.CheckStringLen(tlen); err != nil {
+		return "", err
+	}
+	t := make([]byte, tlen)
 	w := 0
 	start := 0
 	for i := 0; i < n; i++ {
@@ -1057,7 +1113,7 @@ func doTextReplace(s, old, new string, n int) (string, bool) {
 
 		ssj := s[start:j]
 		if w+len(ssj)+len(new) > tengo.MaxStringLen {
-			return "", false
+			return "", tengo.ErrStringLimit
 		}
 
 		w += copy(t[w:], ssj)
@@ -1067,10 +1123,10 @@ func doTextReplace(s, old, new string, n int) (string, bool) {
 
 	ss := s[start:]
 	if w+len(ss) > tengo.MaxStringLen {
-		return "", false
+		return "", tengo.ErrStringLimit
 	}
 
 	w += copy(t[w:], ss)
 
-	return string(t[0:w]), true
+	return string(t[0:w]), nil
 }
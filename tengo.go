@@ -3,6 +3,9 @@ package tengo
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
 	"strconv"
 	"time"
 )
@@ -18,15 +21,26 @@ var (
 )
 
 const (
-	// GlobalsSize is the maximum number of global variables for a VM.
+	// GlobalsSize is the default maximum number of global variables for a
+	// VM. See Script.SetMaxGlobals.
 	GlobalsSize = 1024
 
-	// StackSize is the maximum stack size for a VM.
+	// MaxGlobals is the maximum number of global variables, as the global
+	// indexes are 2-byte operands.
+	MaxGlobals = 1 << 16
+
+	// StackSize is the default maximum stack size for a VM. See
+	// VM.SetMaxStackSize.
 	StackSize = 2048
 
-	// MaxFrames is the maximum number of function frames for a VM.
+	// MaxFrames is the default maximum number of function frames for a VM.
+	// See VM.SetMaxFrames.
 	MaxFrames = 1024
 
+	// MaxReturnValues is the maximum number of values a function can return
+	// or an assignment can unpack.
+	MaxReturnValues = 255
+
 	// SourceFileExtDefault is the default extension for source files.
 	SourceFileExtDefault = ".tengo"
 )
@@ -34,6 +48,12 @@ const (
 // CallableFunc is a function signature for the callable functions.
 type CallableFunc = func(args ...Object) (ret Object, err error)
 
+// CallableVMFunc is a function signature for the callable functions that
+// receive the calling VM. The VM can be used to invoke script functions
+// passed as arguments (see VM.Call). Note that vm can be nil if the function
+// is called outside of a VM.
+type CallableVMFunc = func(vm *VM, args ...Object) (ret Object, err error)
+
 // CountObjects returns the number of objects that a given object o contains.
 // For scalar value types, it will always be 1. For compound value types,
 // this will include its elements and all of their elements recursively.
@@ -52,10 +72,24 @@ func CountObjects(o Object) (c int) {
 		for _, v := range o.Value {
 			c += CountObjects(v)
 		}
+		for _, e := range o.Hashed {
+			c += CountObjects(e.Value)
+		}
 	case *ImmutableMap:
 		for _, v := range o.Value {
 			c += CountObjects(v)
 		}
+		for _, e := range o.Hashed {
+			c += CountObjects(e.Value)
+		}
+	case *Set:
+		for _, e := range o.Value {
+			c += CountObjects(e)
+		}
+	case *ImmutableSet:
+		for _, e := range o.Value {
+			c += CountObjects(e)
+		}
 	case *Error:
 		c += CountObjects(o.Value)
 	}
@@ -82,6 +116,16 @@ func ToInt(o Object) (v int, ok bool) {
 	case *Int:
 		v = int(o.Value)
 		ok = true
+	case *BigInt:
+		if o.Value.IsInt64() {
+			v = int(o.Value.Int64())
+			ok = true
+		}
+	case *Decimal:
+		if i := o.Round(0, RoundDown).Value; i.IsInt64() {
+			v = int(i.Int64())
+			ok = true
+		}
 	case *Float:
 		v = int(o.Value)
 		ok = true
@@ -109,6 +153,16 @@ func ToInt64(o Object) (v int64, ok bool) {
 	case *Int:
 		v = o.Value
 		ok = true
+	case *BigInt:
+		if o.Value.IsInt64() {
+			v = o.Value.Int64()
+			ok = true
+		}
+	case *Decimal:
+		if i := o.Round(0, RoundDown).Value; i.IsInt64() {
+			v = i.Int64()
+			ok = true
+		}
 	case *Float:
 		v = int64(o.Value)
 		ok = true
@@ -130,12 +184,78 @@ func ToInt64(o Object) (v int64, ok bool) {
 	return
 }
 
+// ToBigInt will try to convert object o to *big.Int value.
+func ToBigInt(o Object) (v *big.Int, ok bool) {
+	switch o := o.(type) {
+	case *BigInt:
+		v = o.Value
+		ok = true
+	case *Int:
+		v = big.NewInt(o.Value)
+		ok = true
+	case *Float:
+		if !math.IsInf(o.Value, 0) && !math.IsNaN(o.Value) {
+			v, _ = big.NewFloat(o.Value).Int(nil)
+			ok = true
+		}
+	case *Decimal:
+		v = o.Round(0, RoundDown).Value
+		ok = true
+	case *Char:
+		v = big.NewInt(int64(o.Value))
+		ok = true
+	case *Bool:
+		v = new(big.Int)
+		if o == TrueValue {
+			v.SetInt64(1)
+		}
+		ok = true
+	case *String:
+		v, ok = new(big.Int).SetString(o.Value, 10)
+	}
+	return
+}
+
+// ToDecimal will try to convert object o to decimal value. Float values are
+// converted using their shortest decimal representations.
+func ToDecimal(o Object) (v *Decimal, ok bool) {
+	switch o := o.(type) {
+	case *Decimal:
+		v = o
+		ok = true
+	case *Int:
+		v = &Decimal{Value: big.NewInt(o.Value)}
+		ok = true
+	case *BigInt:
+		v = &Decimal{Value: o.Value}
+		ok = true
+	case *Float:
+		if !math.IsInf(o.Value, 0) && !math.IsNaN(o.Value) {
+			v, _ = ParseDecimal(strconv.FormatFloat(o.Value, 'g', -1, 64))
+			ok = true
+		}
+	case *String:
+		d, err := ParseDecimal(o.Value)
+		if err == nil {
+			v = d
+			ok = true
+		}
+	}
+	return
+}
+
 // ToFloat64 will try to convert object o to float64 value.
 func ToFloat64(o Object) (v float64, ok bool) {
 	switch o := o.(type) {
 	case *Int:
 		v = float64(o.Value)
 		ok = true
+	case *BigInt:
+		v, _ = new(big.Float).SetInt(o.Value).Float64()
+		ok = true
+	case *Decimal:
+		v, _ = new(big.Rat).SetFrac(o.Value, pow10(o.Scale)).Float64()
+		ok = true
 	case *Float:
 		v = o.Value
 		ok = true
@@ -195,11 +315,15 @@ func ToTime(o Object) (v time.Time, ok bool) {
 	return
 }
 
-// ToInterface attempts to convert an object o to an interface{} value
+// ToInterface attempts to convert an object o to an interface{} value. A map
+// is converted to map[string]interface{} if all its keys are strings, and to
+// map[interface{}]interface{} otherwise.
 func ToInterface(o Object) (res interface{}) {
 	switch o := o.(type) {
 	case *Int:
 		res = o.Value
+	case *BigInt:
+		res = o.Value
 	case *String:
 		res = o.Value
 	case *Float:
@@ -221,15 +345,13 @@ func ToInterface(o Object) (res interface{}) {
 			res.([]interface{})[i] = ToInterface(val)
 		}
 	case *Map:
-		res = make(map[string]interface{})
-		for key, v := range o.Value {
-			res.(map[string]interface{})[key] = ToInterface(v)
-		}
+		res = mapToInterface(o.Value, o.Hashed)
 	case *ImmutableMap:
-		res = make(map[string]interface{})
-		for key, v := range o.Value {
-			res.(map[string]interface{})[key] = ToInterface(v)
-		}
+		res = mapToInterface(o.Value, o.Hashed)
+	case *Set:
+		res = setToInterface(o.Value)
+	case *ImmutableSet:
+		res = setToInterface(o.Value)
 	case *Time:
 		res = o.Value
 	case *Error:
@@ -267,6 +389,8 @@ func FromInterface(v interface{}) (Object, error) {
 		return &Char{Value: rune(v)}, nil
 	case float64:
 		return &Float{Value: v}, nil
+	case *big.Int:
+		return &BigInt{Value: v}, nil
 	case []byte:
 		if len(v) > MaxBytesLen {
 			return nil, ErrBytesLimit
@@ -286,6 +410,22 @@ func FromInterface(v interface{}) (Object, error) {
 			kv[vk] = vo
 		}
 		return &Map{Value: kv}, nil
+	case map[interface{}]interface{}:
+		m := &Map{Value: make(map[string]Object)}
+		for vk, vv := range v {
+			ko, err := FromInterface(vk)
+			if err != nil {
+				return nil, err
+			}
+			vo, err := FromInterface(vv)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.IndexSet(ko, vo); err != nil {
+				return nil, fmt.Errorf("invalid map key: %T", vk)
+			}
+		}
+		return m, nil
 	case []Object:
 		return &Array{Value: v}, nil
 	case []interface{}:
@@ -304,6 +444,79 @@ func FromInterface(v interface{}) (Object, error) {
 		return v, nil
 	case CallableFunc:
 		return &UserFunction{Value: v}, nil
+	case CallableVMFunc:
+		return &UserFunction{VMValue: v}, nil
+	}
+	if rv := reflect.ValueOf(v); isSetType(rv.Type()) {
+		s := &Set{Value: make(map[HashKey]Object, rv.Len())}
+		iter := rv.MapRange()
+		for iter.Next() {
+			eo, err := FromInterface(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Add(eo); err != nil {
+				return nil, fmt.Errorf("invalid set element: %T",
+					iter.Key().Interface())
+			}
+		}
+		return s, nil
 	}
 	return nil, fmt.Errorf("cannot convert to object: %T", v)
 }
+
+// isSetType returns true if the type is a Go set, a map with empty struct
+// values.
+func isSetType(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct &&
+		t.Elem().NumField() == 0
+}
+
+// setToInterface converts the elements of a set to map[interface{}]struct{}.
+func setToInterface(v map[HashKey]Object) map[interface{}]struct{} {
+	res := make(map[interface{}]struct{}, len(v))
+	for _, e := range v {
+		res[keyToInterface(e)] = struct{}{}
+	}
+	return res
+}
+
+// mapToInterface converts the entries of a map to map[string]interface{}, or
+// to map[interface{}]interface{} if the map has keys other than strings.
+func mapToInterface(
+	v map[string]Object,
+	h map[HashKey]MapEntry,
+) interface{} {
+	if len(h) == 0 {
+		res := make(map[string]interface{}, len(v))
+		for key, v := range v {
+			res[key] = ToInterface(v)
+		}
+		return res
+	}
+	res := make(map[interface{}]interface{}, len(v)+len(h))
+	for key, v := range v {
+		res[key] = ToInterface(v)
+	}
+	for _, e := range h {
+		res[keyToInterface(e.Key)] = ToInterface(e.Value)
+	}
+	return res
+}
+
+// keyToInterface converts a map key to a comparable interface{} value. The
+// immutable arrays are converted to arrays of the element values.
+func keyToInterface(o Object) interface{} {
+	arr, ok := o.(*ImmutableArray)
+	if !ok {
+		return ToInterface(o)
+	}
+	elemType := reflect.TypeOf((*interface{})(nil)).Elem()
+	res := reflect.New(reflect.ArrayOf(len(arr.Value), elemType)).Elem()
+	for i, e := range arr.Value {
+		if k := keyToInterface(e); k != nil {
+			res.Index(i).Set(reflect.ValueOf(k))
+		}
+	}
+	return res.Interface()
+}
@@ -1,6 +1,9 @@
 package tengo_test
 
 import (
+	"math"
+	"math/big"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -42,6 +45,14 @@ func TestInstructions_String(t *testing.T) {
 0002 GETL    1    
 0004 CONST   2    
 0007 CONST   65535`)
+
+	assertInstructionString(t,
+		[][]byte{
+			tengo.MakeInstruction(parser.OpAssignLocal, 1, 258, 11),
+			tengo.MakeInstruction(parser.OpReturnConst, 3),
+		},
+		`0000 ASSIGNL 1     258   11   
+0005 RETC    3    `)
 }
 
 func TestMakeInstruction(t *testing.T) {
@@ -54,6 +65,8 @@ func TestMakeInstruction(t *testing.T) {
 	makeInstruction(t, []byte{parser.OpPop}, parser.OpPop)
 	makeInstruction(t, []byte{parser.OpTrue}, parser.OpTrue)
 	makeInstruction(t, []byte{parser.OpFalse}, parser.OpFalse)
+	makeInstruction(t, []byte{parser.OpAssignLocal, 1, 1, 2, 11},
+		parser.OpAssignLocal, 1, 258, 11)
 }
 
 func TestNumObjects(t *testing.T) {
@@ -109,6 +122,116 @@ func TestNumObjects(t *testing.T) {
 	testCountObjects(t, tengo.UndefinedValue, 1)
 }
 
+func TestMapInterface(t *testing.T) {
+	m, err := tengo.FromInterface(map[interface{}]interface{}{
+		"a": 1,
+		2:   "b",
+		3.5: true,
+	})
+	require.NoError(t, err)
+	v, err := m.IndexGet(&tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, "b", v.(*tengo.String).Value)
+	v, err = m.IndexGet(&tengo.String{Value: "2"})
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, v)
+	require.Equal(t, 3, tengo.CountObjects(m)-1)
+
+	require.True(t, reflect.DeepEqual(map[interface{}]interface{}{
+		"a":          int64(1),
+		int64(2):     "b",
+		float64(3.5): true,
+	}, tengo.ToInterface(m)))
+
+	// immutable arrays are converted to arrays
+	m = &tengo.Map{Value: map[string]tengo.Object{}}
+	err = m.IndexSet(&tengo.ImmutableArray{Value: []tengo.Object{
+		&tengo.Int{Value: 1}, &tengo.String{Value: "x"},
+	}}, tengo.TrueValue)
+	require.NoError(t, err)
+	require.True(t, reflect.DeepEqual(map[interface{}]interface{}{
+		[2]interface{}{int64(1), "x"}: true,
+	}, tengo.ToInterface(m)))
+
+	// maps with string keys only
+	require.True(t, reflect.DeepEqual(map[string]interface{}{"a": int64(1)},
+		tengo.ToInterface(&tengo.Map{Value: map[string]tengo.Object{
+			"a": &tengo.Int{Value: 1},
+		}})))
+
+	_, err = tengo.FromInterface(map[interface{}]interface{}{
+		"a": 1,
+		nil: 2,
+	})
+	require.Error(t, err)
+}
+
+func TestSetInterface(t *testing.T) {
+	s, err := tengo.FromInterface(map[int]struct{}{1: {}, 2: {}})
+	require.NoError(t, err)
+	require.Equal(t, "set", s.TypeName())
+	require.Equal(t, 3, tengo.CountObjects(s))
+	require.True(t, reflect.DeepEqual(map[interface{}]struct{}{
+		int64(1): {},
+		int64(2): {},
+	}, tengo.ToInterface(s)))
+
+	s, err = tengo.FromInterface(map[interface{}]struct{}{"a": {}, 'b': {}})
+	require.NoError(t, err)
+	require.True(t, reflect.DeepEqual(map[interface{}]struct{}{
+		"a": {},
+		'b': {},
+	}, tengo.ToInterface(&tengo.ImmutableSet{Value: s.(*tengo.Set).Value})))
+
+	_, err = tengo.FromInterface(map[interface{}]struct{}{
+		1.5: {},
+		nil: {},
+	})
+	require.Error(t, err)
+}
+
+func TestBigIntInterface(t *testing.T) {
+	v, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	o, err := tengo.FromInterface(v)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.BigInt{Value: v}, o)
+	require.True(t, v == tengo.ToInterface(o))
+
+	n, ok := tengo.ToBigInt(&tengo.String{Value: "-12345678901234567890"})
+	require.True(t, ok)
+	require.Equal(t, "-12345678901234567890", n.String())
+	_, ok = tengo.ToBigInt(&tengo.String{Value: "1.5"})
+	require.False(t, ok)
+	_, ok = tengo.ToInt64(o)
+	require.False(t, ok)
+	i, ok := tengo.ToInt64(&tengo.BigInt{Value: big.NewInt(-5)})
+	require.True(t, ok)
+	require.Equal(t, int64(-5), i)
+}
+
+func TestToDecimal(t *testing.T) {
+	d, ok := tengo.ToDecimal(&tengo.Float{Value: 0.1})
+	require.True(t, ok)
+	require.Equal(t, "0.1", d.String())
+	d, ok = tengo.ToDecimal(&tengo.Float{Value: 1e21})
+	require.True(t, ok)
+	require.Equal(t, "1000000000000000000000", d.String())
+	_, ok = tengo.ToDecimal(&tengo.Float{Value: math.Inf(1)})
+	require.False(t, ok)
+	d, ok = tengo.ToDecimal(&tengo.String{Value: "-12.50"})
+	require.True(t, ok)
+	require.Equal(t, "-12.50", d.String())
+	_, ok = tengo.ToDecimal(tengo.TrueValue)
+	require.False(t, ok)
+
+	i, ok := tengo.ToInt64(d)
+	require.True(t, ok)
+	require.Equal(t, int64(-12), i)
+	f, ok := tengo.ToFloat64(d)
+	require.True(t, ok)
+	require.Equal(t, -12.5, f)
+}
+
 func testCountObjects(t *testing.T, o tengo.Object, expected int) {
 	require.Equal(t, expected, tengo.CountObjects(o))
 }
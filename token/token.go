@@ -67,6 +67,9 @@ const (
 	Semicolon    // ;
 	Colon        // :
 	Question     // ?
+	QuestionDot  // ?.
+	Coalesce     // ??
+	NotIn        // not in
 	_operatorEnd
 	_keywordBeg
 	Break
@@ -84,7 +87,21 @@ const (
 	In
 	Undefined
 	Import
+	Try
+	Catch
+	Finally
+	Switch
+	Case
+	Default
+	Defer
+	Yield
+	Type
 	_keywordEnd
+	// literals of interpolated strings follow the keywords so that the
+	// values of the operators, used in the compiled bytecode, don't change.
+	StringHead // head of an interpolated string, up to the first "${"
+	StringMid  // part of an interpolated string between "}" and "${"
+	StringTail // tail of an interpolated string, from the last "}"
 )
 
 var tokens = [...]string{
@@ -143,6 +160,9 @@ var tokens = [...]string{
 	Semicolon:    ";",
 	Colon:        ":",
 	Question:     "?",
+	QuestionDot:  "?.",
+	Coalesce:     "??",
+	NotIn:        "not in",
 	Break:        "break",
 	Continue:     "continue",
 	Else:         "else",
@@ -158,6 +178,18 @@ var tokens = [...]string{
 	In:           "in",
 	Undefined:    "undefined",
 	Import:       "import",
+	Try:          "try",
+	Catch:        "catch",
+	Finally:      "finally",
+	Switch:       "switch",
+	Case:         "case",
+	Default:      "default",
+	Defer:        "defer",
+	Yield:        "yield",
+	Type:         "type",
+	StringHead:   "STRING_HEAD",
+	StringMid:    "STRING_MID",
+	StringTail:   "STRING_TAIL",
 }
 
 func (tok Token) String() string {
@@ -180,11 +212,11 @@ const LowestPrec = 0
 // Precedence returns the precedence for the operator token.
 func (tok Token) Precedence() int {
 	switch tok {
-	case LOr:
+	case LOr, Coalesce:
 		return 1
 	case LAnd:
 		return 2
-	case Equal, NotEqual, Less, LessEq, Greater, GreaterEq:
+	case Equal, NotEqual, Less, LessEq, Greater, GreaterEq, In, NotIn:
 		return 3
 	case Add, Sub, Or, Xor:
 		return 4
@@ -196,7 +228,8 @@ func (tok Token) Precedence() int {
 
 // IsLiteral returns true if the token is a literal.
 func (tok Token) IsLiteral() bool {
-	return _literalBeg < tok && tok < _literalEnd
+	return _literalBeg < tok && tok < _literalEnd ||
+		StringHead <= tok && tok <= StringTail
 }
 
 // IsOperator returns true if the token is an operator.
@@ -220,6 +253,11 @@ func Lookup(ident string) Token {
 func init() {
 	keywords = make(map[string]Token)
 	for i := _keywordBeg + 1; i < _keywordEnd; i++ {
+		if i == Type {
+			// "type" is a keyword only at the start of a type statement,
+			// so it is scanned as an identifier
+			continue
+		}
 		keywords[tokens[i]] = i
 	}
 }
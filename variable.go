@@ -86,8 +86,9 @@ func (v *Variable) Array() []interface{} {
 	return nil
 }
 
-// Map returns map[string]interface{} value of the variable value. It returns
-// 0 if the value is not convertible to map[string]interface{}.
+// Map returns map[string]interface{} value of the variable value. The keys
+// other than strings are converted to their string forms. It returns 0 if the
+// value is not convertible to map[string]interface{}.
 func (v *Variable) Map() map[string]interface{} {
 	switch val := v.value.(type) {
 	case *Map:
@@ -95,6 +96,12 @@ func (v *Variable) Map() map[string]interface{} {
 		for mk, mv := range val.Value {
 			kv[mk] = ToInterface(mv)
 		}
+		for _, e := range val.Hashed {
+			mk, _ := ToString(e.Key)
+			if _, ok := kv[mk]; !ok {
+				kv[mk] = ToInterface(e.Value)
+			}
+		}
 		return kv
 	}
 	return nil
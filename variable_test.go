@@ -79,3 +79,17 @@ func TestVariable(t *testing.T) {
 		require.Equal(t, tc.IsUndefined, v.IsUndefined(), "Name: %s", tc.Name)
 	}
 }
+
+func TestVariable_MapHashedKeys(t *testing.T) {
+	m := &tengo.Map{Value: map[string]tengo.Object{
+		"a": &tengo.Int{Value: 1},
+	}}
+	require.NoError(t, m.IndexSet(&tengo.Int{Value: 2},
+		&tengo.String{Value: "two"}))
+	v, err := tengo.NewVariable("m", m)
+	require.NoError(t, err)
+	kv := v.Map()
+	require.Equal(t, 2, len(kv))
+	require.Equal(t, int64(1), kv["a"])
+	require.Equal(t, "two", kv["2"])
+}
@@ -1,37 +1,127 @@
 package tengo
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 	"sync/atomic"
 
 	"github.com/d5/tengo/v2/parser"
 	"github.com/d5/tengo/v2/token"
 )
 
+const (
+	// initial sizes of the stack and the frames of a VM, which grow on demand
+	initStackSize = 64
+	initFrames    = 16
+
+	// stackMargin is the number of values an instruction can push without
+	// growing the stack itself.
+	stackMargin = 4
+)
+
 // frame represents a function call frame.
 type frame struct {
 	fn          *CompiledFunction
 	freeVars    []*ObjectPtr
 	ip          int
 	basePointer int
+	defers      []deferredCall
 }
 
-// VM is a virtual machine that executes the bytecode compiled by Compiler.
-type VM struct {
-	constants   []Object
-	stack       [StackSize]Object
-	sp          int
-	globals     []Object
-	fileSet     *parser.SourceFileSet
-	frames      [MaxFrames]frame
+// deferredCall represents a function call deferred by a defer statement.
+type deferredCall struct {
+	fn   Object
+	args []Object
+}
+
+// handler represents an error handler set up by a try statement.
+type handler struct {
 	framesIndex int
-	curFrame    *frame
-	curInsts    []byte
+	sp          int
 	ip          int
-	aborting    int64
-	maxAllocs   int64
-	allocs      int64
-	err         error
+	finally     bool
+}
+
+// thrownError is pushed to the stack when the finally block of a try
+// statement is run for an error, so the error can be rethrown at the end of
+// the block.
+type thrownError struct {
+	ObjectImpl
+	err error
+	ip  int // ip of the handler frame where the error occurred
+}
+
+func (o *thrownError) TypeName() string {
+	return "thrown-error"
+}
+
+func (o *thrownError) String() string {
+	return o.err.Error()
+}
+
+// spreadMarker wraps an element of an array or a map literal that is spread
+// with "...", so OpArray and OpMap can flatten it.
+type spreadMarker struct {
+	ObjectImpl
+	Value Object
+}
+
+func (o *spreadMarker) TypeName() string {
+	return "spread"
+}
+
+func (o *spreadMarker) String() string {
+	return o.Value.String() + "..."
+}
+
+// callTrampoline is a function used by VM.Call to invoke a callee with the
+// arguments spread from an array, and to suspend the VM when it returns.
+var callTrampoline = &CompiledFunction{
+	Instructions: append(
+		MakeInstruction(parser.OpCall, 1, 1),
+		parser.OpSuspend),
+	SourceMap: map[int]parser.Pos{},
+}
+
+// resumeTrampoline is a function used by VM.resume to suspend the VM when a
+// generator function returns.
+var resumeTrampoline = &CompiledFunction{
+	Instructions: []byte{parser.OpSuspend},
+	SourceMap:    map[int]parser.Pos{},
+}
+
+// VM is a virtual machine that executes the bytecode compiled by Compiler.
+type VM struct {
+	constants     []Object
+	stack         []Object
+	sp            int
+	globals       []Object
+	fileSet       *parser.SourceFileSet
+	frames        []frame
+	framesIndex   int
+	curFrame      *frame
+	curInsts      []byte
+	ip            int
+	aborting      int64
+	maxAllocs     int64
+	allocs        int64
+	maxInsts      int64
+	insts         int64
+	maxMemory     int64
+	memory        int64
+	maxStrLen     int
+	maxBytesLen   int
+	maxStack      int
+	maxFrames     int
+	overflowCheck bool
+	handlers      []handler
+	handlerBase   int        // handlers below the index are not visible to the VM
+	frameBase     int        // frames at or below the index are not unwound
+	gen           *Generator // generator being resumed
+	err           error
 }
 
 // NewVM creates a VM.
@@ -45,12 +135,20 @@ func NewVM(
 	}
 	v := &VM{
 		constants:   bytecode.Constants,
+		stack:       make([]Object, initStackSize),
 		sp:          0,
 		globals:     globals,
 		fileSet:     bytecode.FileSet,
+		frames:      make([]frame, initFrames),
 		framesIndex: 1,
 		ip:          -1,
 		maxAllocs:   maxAllocs,
+		maxInsts:    -1,
+		maxMemory:   -1,
+		maxStrLen:   -1,
+		maxBytesLen: -1,
+		maxStack:    StackSize,
+		maxFrames:   MaxFrames,
 	}
 	v.frames[0].fn = bytecode.MainFunction
 	v.frames[0].ip = -1
@@ -64,40 +162,250 @@ func (v *VM) Abort() {
 	atomic.StoreInt64(&v.aborting, 1)
 }
 
-// Run starts the execution.
-func (v *VM) Run() (err error) {
-	// reset VM states
+// SetMaxInstructions sets the maximum number of instructions the VM can
+// execute in a single run. The run will fail with ErrInstructionLimit error
+// if it exceeds this limit. A negative value means no limit.
+func (v *VM) SetMaxInstructions(n int64) {
+	v.maxInsts = n
+}
+
+// ExecutedInstructions returns the number of instructions executed during
+// the last run of the VM.
+func (v *VM) ExecutedInstructions() int64 {
+	return v.maxInsts + 1 - v.insts
+}
+
+// SetMaxMemory sets the maximum number of bytes the VM can allocate for
+// strings, bytes, arrays and maps in a single run. The size of each object is
+// approximated and accumulated as the objects are created, and the run will
+// fail with ErrMemoryLimit error if it exceeds this limit. A negative value
+// means no limit.
+func (v *VM) SetMaxMemory(n int64) {
+	v.maxMemory = n
+}
+
+// SetMaxStringLen sets the maximum byte-length of string values created by
+// the VM. Unlike MaxStringLen, it only applies to this VM. A negative value
+// means only MaxStringLen is applied.
+func (v *VM) SetMaxStringLen(n int) {
+	v.maxStrLen = n
+}
+
+// SetMaxBytesLen sets the maximum length of bytes values created by the VM.
+// Unlike MaxBytesLen, it only applies to this VM. A negative value means only
+// MaxBytesLen is applied.
+func (v *VM) SetMaxBytesLen(n int) {
+	v.maxBytesLen = n
+}
+
+// SetMaxStackSize sets the maximum number of values the stack of the VM can
+// hold. The stack starts small and grows as needed up to this size, and the
+// run will fail with ErrStackOverflow error if it exceeds this limit. The
+// default is StackSize, and a negative value means no limit.
+func (v *VM) SetMaxStackSize(n int) {
+	v.maxStack = n
+	// the run loop only checks the limit once the stack is full, so it
+	// must not be allocated beyond the limit.
+	if n >= 0 && n < len(v.stack) {
+		v.stack = v.stack[:n]
+	}
+}
+
+// SetMaxFrames sets the maximum number of function frames of the VM, which
+// limits the depth of function calls. The frames are allocated as needed up
+// to this number, and the run will fail with ErrStackOverflow error if it
+// exceeds this limit. The default is MaxFrames, and a negative value means no
+// limit.
+func (v *VM) SetMaxFrames(n int) {
+	v.maxFrames = n
+}
+
+// SetOverflowCheck enables or disables the overflow check of int values.
+// When enabled, the arithmetic operations on int values whose results
+// overflow fail with ErrIntOverflow instead of wrapping around.
+func (v *VM) SetOverflowCheck(enable bool) {
+	v.overflowCheck = enable
+}
+
+// reset resets the VM states before a run, so the VM can be run again after
+// a run or a call failed.
+func (v *VM) reset() {
 	v.sp = 0
 	v.curFrame = &(v.frames[0])
 	v.curInsts = v.curFrame.fn.Instructions
 	v.framesIndex = 1
 	v.ip = -1
 	v.allocs = v.maxAllocs + 1
+	v.insts = v.maxInsts + 1
+	v.memory = 0
+	v.handlers = v.handlers[:0]
+	v.handlerBase = 0
+	v.frameBase = -1
+	v.frames[0].defers = v.frames[0].defers[:0]
+	v.gen = nil
+	v.err = nil
+}
 
+// Run starts the execution.
+func (v *VM) Run() (err error) {
+	v.reset()
 	v.run()
+	if v.err == nil && len(v.curFrame.defers) > 0 {
+		// run the calls deferred in the main function
+		if v.runDefers(); v.err != nil {
+			v.unwind()
+		}
+	}
 	atomic.StoreInt64(&v.aborting, 0)
 	err = v.err
 	if err != nil {
-		filePos := v.fileSet.Position(
-			v.curFrame.fn.SourcePos(v.ip - 1))
-		err = fmt.Errorf("Runtime Error: %w\n\tat %s",
-			err, filePos)
-		for v.framesIndex > 1 {
-			v.framesIndex--
-			v.curFrame = &v.frames[v.framesIndex-1]
-			filePos = v.fileSet.Position(
-				v.curFrame.fn.SourcePos(v.curFrame.ip - 1))
-			err = fmt.Errorf("%w\n\tat %s", err, filePos)
-		}
-		return err
+		return v.runtimeError(err, -1)
 	}
 	return nil
 }
 
+// RunCompiled runs a compiled function fn with the arguments on the VM and
+// returns its result. It can be used to call script functions after the main
+// function has been run, as the VM shares the globals with its creator.
+func (v *VM) RunCompiled(
+	fn *CompiledFunction,
+	args ...Object,
+) (ret Object, err error) {
+	v.reset()
+	ret, err = v.Call(fn, args...)
+	atomic.StoreInt64(&v.aborting, 0)
+	if err != nil {
+		if _, ok := err.(*RuntimeError); !ok {
+			err = &RuntimeError{Err: err}
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
 func (v *VM) run() {
+	for {
+		v.exec()
+		if v.err == nil {
+			return
+		}
+		v.unwind()
+		if !v.catch() {
+			return
+		}
+	}
+}
+
+// catchable returns true if err can be handled by scripts. Errors exceeding
+// the sandbox limits cannot be caught, and the deferred calls are not run
+// for them.
+func catchable(err error) bool {
+	return !errors.Is(err, ErrObjectAllocLimit) &&
+		!errors.Is(err, ErrInstructionLimit) &&
+		!errors.Is(err, ErrMemoryLimit) &&
+		!errors.Is(err, ErrVMAborted)
+}
+
+// catch passes the control to the innermost error handler. It returns false
+// if there's no handler or the error cannot be handled by scripts.
+func (v *VM) catch() bool {
+	if len(v.handlers) == v.handlerBase || !catchable(v.err) {
+		return false
+	}
+	h := v.handlers[len(v.handlers)-1]
+	v.handlers = v.handlers[:len(v.handlers)-1]
+
+	var obj Object
+	if h.finally {
+		// the frames up to the handler frame are added when rethrown
+		ip := v.ip
+		if v.framesIndex > h.framesIndex {
+			ip = v.frames[h.framesIndex-1].ip
+		}
+		obj = &thrownError{
+			err: v.runtimeError(v.err, h.framesIndex-1),
+			ip:  ip,
+		}
+	} else {
+		rerr := v.runtimeError(v.err, h.framesIndex-2)
+		obj = &Error{Value: &ImmutableMap{Value: map[string]Object{
+			"message": &String{Value: rerr.Err.Error()},
+			"pos":     &String{Value: rerr.Pos().String()},
+		}}}
+	}
+
+	v.framesIndex = h.framesIndex
+	v.curFrame = &v.frames[v.framesIndex-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = h.ip - 1
+	v.sp = h.sp
+	v.stack[v.sp] = obj
+	v.sp++
+	v.err = nil
+	return true
+}
+
+// runDefers runs the deferred calls of the current frame in LIFO order. It
+// stops at the first call that fails, leaving the error in v.err.
+func (v *VM) runDefers() {
+	for n := len(v.curFrame.defers); n > 0; n-- {
+		d := v.curFrame.defers[n-1]
+		v.curFrame.defers[n-1] = deferredCall{}
+		v.curFrame.defers = v.curFrame.defers[:n-1]
+		if _, err := v.Call(d.fn, d.args...); err != nil {
+			v.err = err
+			return
+		}
+	}
+}
+
+// unwind leaves the frames above the frame of the innermost error handler,
+// running their deferred calls, innermost first. If a deferred call fails,
+// its error replaces the current one.
+func (v *VM) unwind() {
+	base := v.frameBase
+	if len(v.handlers) > v.handlerBase {
+		base = v.handlers[len(v.handlers)-1].framesIndex - 1
+	}
+	for i := v.framesIndex - 1; i > base && catchable(v.err); i-- {
+		if len(v.frames[i].defers) == 0 {
+			continue
+		}
+		if i < v.framesIndex-1 {
+			// the frames above are left with their positions recorded
+			v.err = v.runtimeError(v.err, i)
+			v.framesIndex = i + 1
+			v.curFrame = &v.frames[i]
+			v.curInsts = v.curFrame.fn.Instructions
+			v.ip = v.curFrame.ip
+		}
+		for len(v.curFrame.defers) > 0 && catchable(v.err) {
+			err := v.err
+			v.err = nil
+			if v.runDefers(); v.err == nil {
+				v.err = err
+			}
+		}
+	}
+}
+
+func (v *VM) exec() {
 	for atomic.LoadInt64(&v.aborting) == 0 {
 		v.ip++
 
+		// leave room for the values pushed by a single instruction
+		if v.sp+stackMargin > len(v.stack) && !v.growStack(0) {
+			v.err = ErrStackOverflow
+			return
+		}
+
+		v.insts--
+		if v.insts == 0 {
+			v.insts++ // the instruction was not executed
+			v.err = ErrInstructionLimit
+			return
+		}
+
 		switch v.curInsts[v.ip] {
 		case parser.OpConstant:
 			v.ip += 2
@@ -113,31 +421,65 @@ func (v *VM) run() {
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			tok := token.Token(v.curInsts[v.ip])
-			res, e := left.BinaryOp(tok, right)
-			if e != nil {
-				v.sp -= 2
-				if e == ErrInvalidOperator {
-					v.err = fmt.Errorf("invalid operation: %s %s %s",
-						left.TypeName(), tok.String(), right.TypeName())
+
+			// fast path for int and float operands, which skips the
+			// dynamic dispatch and the memory accounting of the result
+			res, e := numberBinaryOp(left, tok, right, v.overflowCheck)
+			if res != nil {
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
 					return
 				}
-				v.err = e
-				return
+				v.stack[v.sp-2] = res
+				v.sp--
+				continue
 			}
 
-			v.allocs--
-			if v.allocs == 0 {
-				v.err = ErrObjectAllocLimit
+			if e == nil {
+				res, e = v.binaryOp(left, tok, right)
+			}
+			if e != nil {
+				v.sp -= 2
+				v.err = e
 				return
 			}
-
 			v.stack[v.sp-2] = res
 			v.sp--
 		case parser.OpEqual:
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
+			if l, ok := left.(*Int); ok {
+				if r, ok := right.(*Int); ok {
+					v.sp--
+					v.stack[v.sp-1] = boolValue(l.Value == r.Value)
+					continue
+				}
+			}
+			eq, err := v.equals(left, right)
+			if err != nil {
+				v.err = err
+				return
+			}
+			v.sp -= 2
+			if eq {
+				v.stack[v.sp] = TrueValue
+			} else {
+				v.stack[v.sp] = FalseValue
+			}
+			v.sp++
+		case parser.OpSpread:
+			v.stack[v.sp-1] = &spreadMarker{Value: v.stack[v.sp-1]}
+		case parser.OpContains:
+			right := v.stack[v.sp-1]
+			left := v.stack[v.sp-2]
+			res, err := v.contains(right, left)
+			if err != nil {
+				v.err = err
+				return
+			}
 			v.sp -= 2
-			if left.Equals(right) {
+			if res {
 				v.stack[v.sp] = TrueValue
 			} else {
 				v.stack[v.sp] = FalseValue
@@ -146,8 +488,20 @@ func (v *VM) run() {
 		case parser.OpNotEqual:
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
+			if l, ok := left.(*Int); ok {
+				if r, ok := right.(*Int); ok {
+					v.sp--
+					v.stack[v.sp-1] = boolValue(l.Value != r.Value)
+					continue
+				}
+			}
+			eq, err := v.equals(left, right)
+			if err != nil {
+				v.err = err
+				return
+			}
 			v.sp -= 2
-			if left.Equals(right) {
+			if eq {
 				v.stack[v.sp] = FalseValue
 			} else {
 				v.stack[v.sp] = TrueValue
@@ -176,7 +530,16 @@ func (v *VM) run() {
 
 			switch x := operand.(type) {
 			case *Int:
-				var res Object = &Int{Value: ^x.Value}
+				var res Object = newInt(^x.Value)
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
+			case *BigInt:
+				var res Object = &BigInt{Value: new(big.Int).Not(x.Value)}
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -195,7 +558,11 @@ func (v *VM) run() {
 
 			switch x := operand.(type) {
 			case *Int:
-				var res Object = &Int{Value: -x.Value}
+				if v.overflowCheck && x.Value == math.MinInt64 {
+					v.err = ErrIntOverflow
+					return
+				}
+				var res Object = newInt(-x.Value)
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -212,6 +579,27 @@ func (v *VM) run() {
 				}
 				v.stack[v.sp] = res
 				v.sp++
+			case *BigInt:
+				var res Object = &BigInt{Value: new(big.Int).Neg(x.Value)}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
+			case *Decimal:
+				var res Object = &Decimal{
+					Value: new(big.Int).Neg(x.Value),
+					Scale: x.Scale,
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
 			default:
 				v.err = fmt.Errorf("invalid operation: -%s",
 					operand.TypeName())
@@ -240,6 +628,20 @@ func (v *VM) run() {
 				pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8 | int(v.curInsts[v.ip-2])<<16 | int(v.curInsts[v.ip-3])<<24
 				v.ip = pos - 1
 			}
+		case parser.OpChainJump:
+			v.ip += 4
+			if v.stack[v.sp-1] == UndefinedValue {
+				pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8 | int(v.curInsts[v.ip-2])<<16 | int(v.curInsts[v.ip-3])<<24
+				v.ip = pos - 1
+			}
+		case parser.OpCoalesceJump:
+			v.ip += 4
+			if v.stack[v.sp-1] == UndefinedValue {
+				v.sp--
+			} else {
+				pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8 | int(v.curInsts[v.ip-2])<<16 | int(v.curInsts[v.ip-3])<<24
+				v.ip = pos - 1
+			}
 		case parser.OpJump:
 			pos := int(v.curInsts[v.ip+4]) | int(v.curInsts[v.ip+3])<<8 | int(v.curInsts[v.ip+2])<<16 | int(v.curInsts[v.ip+1])<<24
 			v.ip = pos - 1
@@ -277,7 +679,20 @@ func (v *VM) run() {
 
 			var elements []Object
 			for i := v.sp - numElements; i < v.sp; i++ {
-				elements = append(elements, v.stack[i])
+				spread, ok := v.stack[i].(*spreadMarker)
+				if !ok {
+					elements = append(elements, v.stack[i])
+					continue
+				}
+				switch src := spread.Value.(type) {
+				case *Array:
+					elements = append(elements, src.Value...)
+				case *ImmutableArray:
+					elements = append(elements, src.Value...)
+				default:
+					v.err = fmt.Errorf("not an array: %s", src.TypeName())
+					return
+				}
 			}
 			v.sp -= numElements
 
@@ -287,26 +702,96 @@ func (v *VM) run() {
 				v.err = ErrObjectAllocLimit
 				return
 			}
+			if v.err = v.allocMemory(arr); v.err != nil {
+				return
+			}
 
 			v.stack[v.sp] = arr
 			v.sp++
+		case parser.OpConcat:
+			v.ip += 2
+			numItems := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+
+			// convert the items first to allocate the result only once
+			var buf [16]string
+			strs := buf[:0]
+			var length int
+			for _, item := range v.stack[v.sp-numItems : v.sp] {
+				str, err := v.stringOf(item)
+				if err != nil {
+					v.err = err
+					return
+				}
+				strs = append(strs, str)
+				length += len(str)
+			}
+			v.sp -= numItems
+			if v.err = v.CheckStringLen(length); v.err != nil {
+				return
+			}
+
+			var sb strings.Builder
+			sb.Grow(length)
+			for _, str := range strs {
+				sb.WriteString(str)
+			}
+
+			var str Object = &String{Value: sb.String()}
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = ErrObjectAllocLimit
+				return
+			}
+			if v.err = v.allocMemory(str); v.err != nil {
+				return
+			}
+
+			v.stack[v.sp] = str
+			v.sp++
 		case parser.OpMap:
 			v.ip += 2
 			numElements := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
 			kv := make(map[string]Object, numElements)
+			var hashed map[HashKey]MapEntry
 			for i := v.sp - numElements; i < v.sp; i += 2 {
 				key := v.stack[i]
-				value := v.stack[i+1]
-				kv[key.(*String).Value] = value
+				spread, ok := key.(*spreadMarker)
+				if !ok {
+					kv[key.(*String).Value] = v.stack[i+1]
+					continue
+				}
+				var srcKV map[string]Object
+				var srcHashed map[HashKey]MapEntry
+				switch src := spread.Value.(type) {
+				case *Map:
+					srcKV, srcHashed = src.Value, src.Hashed
+				case *ImmutableMap:
+					srcKV, srcHashed = src.Value, src.Hashed
+				default:
+					v.err = fmt.Errorf("not a map: %s", src.TypeName())
+					return
+				}
+				for k, e := range srcKV {
+					kv[k] = e
+				}
+				if len(srcHashed) > 0 && hashed == nil {
+					hashed = make(map[HashKey]MapEntry, len(srcHashed))
+				}
+				for k, e := range srcHashed {
+					hashed[k] = e
+				}
 			}
 			v.sp -= numElements
 
-			var m Object = &Map{Value: kv}
+			var m Object = &Map{Value: kv, Hashed: hashed}
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = ErrObjectAllocLimit
 				return
 			}
+			if v.err = v.allocMemory(m); v.err != nil {
+				return
+			}
 			v.stack[v.sp] = m
 			v.sp++
 		case parser.OpError:
@@ -335,7 +820,8 @@ func (v *VM) run() {
 				v.stack[v.sp-1] = immutableArray
 			case *Map:
 				var immutableMap Object = &ImmutableMap{
-					Value: value.Value,
+					Value:  value.Value,
+					Hashed: value.Hashed,
 				}
 				v.allocs--
 				if v.allocs == 0 {
@@ -343,29 +829,85 @@ func (v *VM) run() {
 					return
 				}
 				v.stack[v.sp-1] = immutableMap
+			case *Set:
+				var immutableSet Object = &ImmutableSet{
+					Value: value.Value,
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp-1] = immutableSet
+			}
+		case parser.OpUnpack:
+			v.ip++
+			numValues := int(v.curInsts[v.ip])
+			val := v.stack[v.sp-1]
+
+			var elements []Object
+			switch val := val.(type) {
+			case *Array:
+				elements = val.Value
+			case *ImmutableArray:
+				elements = val.Value
+			default:
+				v.err = fmt.Errorf(
+					"assignment mismatch: %d variables but 1 value",
+					numValues)
+				return
+			}
+			if len(elements) != numValues {
+				v.err = fmt.Errorf(
+					"assignment mismatch: %d variables but %d values",
+					numValues, len(elements))
+				return
+			}
+			if !v.growStack(numValues - 1) {
+				v.err = ErrStackOverflow
+				return
+			}
+			copy(v.stack[v.sp-1:], elements)
+			v.sp += numValues - 1
+		case parser.OpUnpackIndex:
+			v.ip++
+			numIndexes := int(v.curInsts[v.ip])
+			left := v.stack[v.sp-numIndexes-1]
+			base := v.sp - numIndexes - 1
+			for i := 0; i < numIndexes; i++ {
+				index := v.stack[v.sp-numIndexes+i]
+				val, err := left.IndexGet(index)
+				if err != nil {
+					if err == ErrNotIndexable {
+						v.err = fmt.Errorf("not indexable: %s",
+							left.TypeName())
+						return
+					}
+					if err == ErrInvalidIndexType {
+						v.err = fmt.Errorf("invalid index type: %s",
+							index.TypeName())
+						return
+					}
+					v.err = err
+					return
+				}
+				if val == nil {
+					val = UndefinedValue
+				}
+				// the value is written below the index, which is already read
+				v.stack[base+i] = val
 			}
+			v.sp = base + numIndexes
 		case parser.OpIndex:
 			index := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
-			v.sp -= 2
 
-			val, err := left.IndexGet(index)
+			val, err := v.index(left, index)
+			v.sp -= 2
 			if err != nil {
-				if err == ErrNotIndexable {
-					v.err = fmt.Errorf("not indexable: %s", index.TypeName())
-					return
-				}
-				if err == ErrInvalidIndexType {
-					v.err = fmt.Errorf("invalid index type: %s",
-						index.TypeName())
-					return
-				}
 				v.err = err
 				return
 			}
-			if val == nil {
-				val = UndefinedValue
-			}
 			v.stack[v.sp] = val
 			v.sp++
 		case parser.OpSliceIndex:
@@ -540,25 +1082,36 @@ func (v *VM) run() {
 			}
 		case parser.OpCall:
 			numArgs := int(v.curInsts[v.ip+1])
-			spread := int(v.curInsts[v.ip+2])
+			flags := int(v.curInsts[v.ip+2])
 			v.ip += 2
 
 			value := v.stack[v.sp-1-numArgs]
+			if fn := specialMethod(value, methodCall); fn != nil {
+				value = &BoundMethod{Receiver: value, Method: fn}
+			}
 			if !value.CanCall() {
 				v.err = fmt.Errorf("not callable: %s", value.TypeName())
 				return
 			}
 
-			if spread == 1 {
+			if flags&callSpread != 0 {
 				v.sp--
 				switch arr := v.stack[v.sp].(type) {
 				case *Array:
+					if !v.growStack(len(arr.Value)) {
+						v.err = ErrStackOverflow
+						return
+					}
 					for _, item := range arr.Value {
 						v.stack[v.sp] = item
 						v.sp++
 					}
 					numArgs += len(arr.Value) - 1
 				case *ImmutableArray:
+					if !v.growStack(len(arr.Value)) {
+						v.err = ErrStackOverflow
+						return
+					}
 					for _, item := range arr.Value {
 						v.stack[v.sp] = item
 						v.sp++
@@ -570,6 +1123,21 @@ func (v *VM) run() {
 				}
 			}
 
+			if method, ok := value.(*BoundMethod); ok {
+				// pass the receiver as the first argument
+				if !v.growStack(1) {
+					v.err = ErrStackOverflow
+					return
+				}
+				base := v.sp - numArgs
+				copy(v.stack[base+1:v.sp+1], v.stack[base:v.sp])
+				v.stack[base] = method.Receiver
+				v.stack[base-1] = method.Method
+				v.sp++
+				numArgs++
+				value = method.Method
+			}
+
 			if callee, ok := value.(*CompiledFunction); ok {
 				if callee.VarArgs {
 					// if the closure is variadic,
@@ -600,22 +1168,44 @@ func (v *VM) run() {
 					return
 				}
 
-				// test if it's tail-call
-				if callee == v.curFrame.fn { // recursion
-					nextOp := v.curInsts[v.ip+1]
-					if nextOp == parser.OpReturn ||
-						(nextOp == parser.OpPop &&
-							parser.OpReturn == v.curInsts[v.ip+2]) {
-						for p := 0; p < numArgs; p++ {
-							v.stack[v.curFrame.basePointer+p] =
-								v.stack[v.sp-numArgs+p]
-						}
-						v.sp -= numArgs + 1
-						v.ip = -1 // reset IP to beginning of the frame
-						continue
+				if callee.Generator {
+					// the function is run when the generator is iterated
+					gen := &Generator{
+						vm:    v,
+						fn:    callee,
+						stack: make([]Object, callee.NumLocals),
+						ip:    -1,
 					}
+					copy(gen.stack, v.stack[v.sp-numArgs:v.sp])
+					v.sp -= numArgs + 1
+					v.allocs--
+					if v.allocs == 0 {
+						v.err = ErrObjectAllocLimit
+						return
+					}
+					v.stack[v.sp] = gen
+					v.sp++
+					continue
 				}
-				if v.framesIndex >= MaxFrames {
+
+				// a call in tail position reuses the current frame, unless
+				// there are deferred calls to run when the function returns.
+				// so does a recursion whose result is dropped before return.
+				if len(v.curFrame.defers) == 0 && (flags&callTail != 0 ||
+					callee == v.curFrame.fn &&
+						v.curInsts[v.ip+1] == parser.OpPop &&
+						v.curInsts[v.ip+2] == parser.OpReturn) {
+					bp := v.curFrame.basePointer
+					copy(v.stack[bp:], v.stack[v.sp-numArgs:v.sp])
+					v.stack[bp-1] = callee
+					v.curFrame.fn = callee
+					v.curFrame.freeVars = callee.Free
+					v.curInsts = callee.Instructions
+					v.ip = -1
+					v.sp = bp + callee.NumLocals
+					continue
+				}
+				if !v.growFrames(1) {
 					v.err = ErrStackOverflow
 					return
 				}
@@ -626,6 +1216,7 @@ func (v *VM) run() {
 				v.curFrame.fn = callee
 				v.curFrame.freeVars = callee.Free
 				v.curFrame.basePointer = v.sp - numArgs
+				v.curFrame.defers = v.curFrame.defers[:0]
 				v.curInsts = callee.Instructions
 				v.ip = -1
 				v.framesIndex++
@@ -633,7 +1224,13 @@ func (v *VM) run() {
 			} else {
 				var args []Object
 				args = append(args, v.stack[v.sp-numArgs:v.sp]...)
-				ret, e := value.Call(args...)
+				var ret Object
+				var e error
+				if callee, ok := value.(VMCallable); ok {
+					ret, e = callee.CallVM(v, args...)
+				} else {
+					ret, e = value.Call(args...)
+				}
 				v.sp -= numArgs + 1
 
 				// runtime error
@@ -664,16 +1261,54 @@ func (v *VM) run() {
 					v.err = ErrObjectAllocLimit
 					return
 				}
+				if v.err = v.allocMemory(ret); v.err != nil {
+					return
+				}
 				v.stack[v.sp] = ret
 				v.sp++
 			}
 		case parser.OpReturn:
 			v.ip++
+			if len(v.curFrame.defers) > 0 {
+				if v.runDefers(); v.err != nil {
+					return
+				}
+			}
+			numResults := int(v.curInsts[v.ip])
 			var retVal Object
-			if int(v.curInsts[v.ip]) == 1 {
-				retVal = v.stack[v.sp-1]
-			} else {
+			switch numResults {
+			case 0:
 				retVal = UndefinedValue
+			case 1:
+				retVal = v.stack[v.sp-1]
+			default:
+				// the caller unpacking the values takes them directly from
+				// the stack, otherwise they are packed into an array.
+				caller := &v.frames[v.framesIndex-2]
+				callerInsts := caller.fn.Instructions
+				if caller.ip+2 < len(callerInsts) &&
+					callerInsts[caller.ip+1] == parser.OpUnpack &&
+					int(callerInsts[caller.ip+2]) == numResults {
+					bp := v.curFrame.basePointer
+					copy(v.stack[bp-1:], v.stack[v.sp-numResults:v.sp])
+					v.framesIndex--
+					v.curFrame = &v.frames[v.framesIndex-1]
+					v.curInsts = v.curFrame.fn.Instructions
+					v.ip = v.curFrame.ip + 2 // skip OpUnpack
+					v.sp = bp - 1 + numResults
+					continue
+				}
+				elements := make([]Object, numResults)
+				copy(elements, v.stack[v.sp-numResults:v.sp])
+				retVal = &ImmutableArray{Value: elements}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+				if v.err = v.allocMemory(retVal); v.err != nil {
+					return
+				}
 			}
 			//v.sp--
 			v.framesIndex--
@@ -685,6 +1320,20 @@ func (v *VM) run() {
 			// skip stack overflow check because (newSP) <= (oldSP)
 			v.stack[v.sp-1] = retVal
 			//v.sp++
+		case parser.OpReturnConst:
+			v.ip += 2
+			if len(v.curFrame.defers) > 0 {
+				if v.runDefers(); v.err != nil {
+					return
+				}
+			}
+			cidx := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			v.framesIndex--
+			v.curFrame = &v.frames[v.framesIndex-1]
+			v.curInsts = v.curFrame.fn.Instructions
+			v.ip = v.curFrame.ip
+			v.sp = v.frames[v.framesIndex].basePointer
+			v.stack[v.sp-1] = v.constants[cidx]
 		case parser.OpDefineLocal:
 			v.ip++
 			localIndex := int(v.curInsts[v.ip])
@@ -739,10 +1388,63 @@ func (v *VM) run() {
 			}
 			v.stack[v.sp] = val
 			v.sp++
+		case parser.OpAssignLocal:
+			localIndex := int(v.curInsts[v.ip+1])
+			cidx := int(v.curInsts[v.ip+3]) | int(v.curInsts[v.ip+2])<<8
+			tok := token.Token(v.curInsts[v.ip+4])
+			v.ip += 4
+			sp := v.curFrame.basePointer + localIndex
+
+			left := v.stack[sp]
+			obj, isPtr := left.(*ObjectPtr)
+			if isPtr {
+				left = *obj.Value
+			}
+			right := v.constants[cidx]
+			res, e := numberBinaryOp(left, tok, right, v.overflowCheck)
+			if res != nil {
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = ErrObjectAllocLimit
+					return
+				}
+			} else {
+				if e == nil {
+					res, e = v.binaryOp(left, tok, right)
+				}
+				if e != nil {
+					v.err = e
+					return
+				}
+			}
+			if isPtr {
+				*obj.Value = res
+			} else {
+				v.stack[sp] = res
+			}
+		case parser.OpIndexLocals:
+			bp := v.curFrame.basePointer
+			left := v.stack[bp+int(v.curInsts[v.ip+1])]
+			index := v.stack[bp+int(v.curInsts[v.ip+2])]
+			v.ip += 2
+			if obj, ok := left.(*ObjectPtr); ok {
+				left = *obj.Value
+			}
+			if obj, ok := index.(*ObjectPtr); ok {
+				index = *obj.Value
+			}
+
+			val, err := v.index(left, index)
+			if err != nil {
+				v.err = err
+				return
+			}
+			v.stack[v.sp] = val
+			v.sp++
 		case parser.OpGetBuiltin:
 			v.ip++
 			builtinIndex := int(v.curInsts[v.ip])
-			v.stack[v.sp] = builtinFuncs[builtinIndex]
+			v.stack[v.sp] = vmBuiltins()[builtinIndex]
 			v.sp++
 		case parser.OpClosure:
 			v.ip += 3
@@ -766,12 +1468,14 @@ func (v *VM) run() {
 			}
 			v.sp -= numFree
 			cl := &CompiledFunction{
+				Name:          fn.Name,
 				Instructions:  fn.Instructions,
 				NumLocals:     fn.NumLocals,
 				NumParameters: fn.NumParameters,
 				VarArgs:       fn.VarArgs,
 				SourceMap:     fn.SourceMap,
 				Free:          free,
+				Generator:     fn.Generator,
 			}
 			v.allocs--
 			if v.allocs == 0 {
@@ -832,6 +1536,11 @@ func (v *VM) run() {
 		case parser.OpIteratorInit:
 			var iterator Object
 			dst := v.stack[v.sp-1]
+			if fn := specialMethod(dst, methodIter); fn != nil {
+				if dst, v.err = v.Call(fn, dst); v.err != nil {
+					return
+				}
+			}
 			v.sp--
 			if !dst.CanIterate() {
 				v.err = fmt.Errorf("not iterable: %s", dst.TypeName())
@@ -848,7 +1557,16 @@ func (v *VM) run() {
 		case parser.OpIteratorNext:
 			iterator := v.stack[v.sp-1]
 			v.sp--
-			hasMore := iterator.(Iterator).Next()
+			var hasMore bool
+			if gen, ok := iterator.(*Generator); ok {
+				hasMore = gen.next(v)
+				if gen.err != nil {
+					v.err = gen.err
+					return
+				}
+			} else {
+				hasMore = iterator.(Iterator).Next()
+			}
 			if hasMore {
 				v.stack[v.sp] = TrueValue
 			} else {
@@ -867,6 +1585,104 @@ func (v *VM) run() {
 			val := iterator.(Iterator).Value()
 			v.stack[v.sp] = val
 			v.sp++
+		case parser.OpTry:
+			v.ip += 5
+			pos := int(v.curInsts[v.ip-1]) | int(v.curInsts[v.ip-2])<<8 |
+				int(v.curInsts[v.ip-3])<<16 | int(v.curInsts[v.ip-4])<<24
+			v.handlers = append(v.handlers, handler{
+				framesIndex: v.framesIndex,
+				sp:          v.sp,
+				ip:          pos,
+				finally:     v.curInsts[v.ip] == 1,
+			})
+		case parser.OpTryEnd:
+			v.ip++
+			n := int(v.curInsts[v.ip])
+			v.handlers = v.handlers[:len(v.handlers)-n]
+		case parser.OpThrow:
+			thrown := v.stack[v.sp-1].(*thrownError)
+			v.sp--
+			v.ip = thrown.ip
+			v.err = thrown.err
+			return
+		case parser.OpDefer:
+			numArgs := int(v.curInsts[v.ip+1])
+			spread := int(v.curInsts[v.ip+2])
+			v.ip += 2
+
+			value := v.stack[v.sp-1-numArgs]
+			if !value.CanCall() {
+				v.err = fmt.Errorf("not callable: %s", value.TypeName())
+				return
+			}
+			args := make([]Object, numArgs)
+			copy(args, v.stack[v.sp-numArgs:v.sp])
+			v.sp -= numArgs + 1
+
+			if spread == 1 {
+				last := args[numArgs-1]
+				args = args[:numArgs-1]
+				switch arr := last.(type) {
+				case *Array:
+					args = append(args, arr.Value...)
+				case *ImmutableArray:
+					args = append(args, arr.Value...)
+				default:
+					v.err = fmt.Errorf("not an array: %s", arr.TypeName())
+					return
+				}
+			}
+			v.curFrame.defers = append(v.curFrame.defers,
+				deferredCall{fn: value, args: args})
+		case parser.OpYield:
+			// save the state of the generator frame, and suspend the VM.
+			// VM.resume restores the states of the caller.
+			gen := v.gen
+			gen.value = v.stack[v.sp-1]
+			v.sp--
+			bp := v.curFrame.basePointer
+			gen.stack = append(gen.stack[:0], v.stack[bp:v.sp]...)
+			gen.handlers = gen.handlers[:0]
+			for _, h := range v.handlers[v.handlerBase:] {
+				h.sp -= bp
+				gen.handlers = append(gen.handlers, h)
+			}
+			gen.defers = v.curFrame.defers
+			v.curFrame.defers = nil
+			gen.ip = v.ip
+			gen.yielded = true
+			return
+		case parser.OpType:
+			v.ip += 2
+			numFields := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+
+			fields := make([]string, numFields)
+			for i := range fields {
+				fields[i] = v.stack[v.sp-numFields+i].(*String).Value
+			}
+			name := v.stack[v.sp-numFields-1].(*String).Value
+			v.sp -= numFields + 1
+
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = ErrObjectAllocLimit
+				return
+			}
+			v.stack[v.sp] = NewRecordType(name, fields...)
+			v.sp++
+		case parser.OpMethod:
+			fn := v.stack[v.sp-1]
+			name := v.stack[v.sp-2].(*String).Value
+			typ, ok := v.stack[v.sp-3].(*RecordType)
+			if !ok {
+				v.err = fmt.Errorf("invalid receiver type: %s",
+					v.stack[v.sp-3].TypeName())
+				return
+			}
+			v.sp -= 3
+			if v.err = typ.AddMethod(name, fn); v.err != nil {
+				return
+			}
 		case parser.OpSuspend:
 			return
 		default:
@@ -876,11 +1692,706 @@ func (v *VM) run() {
 	}
 }
 
+// Call invokes a callable object fn with the arguments and returns its result.
+// It's intended to be used by Go functions (see VMCallable) to call back
+// script functions passed to them: compiled functions are executed on the
+// current VM, sharing its stack, allocation limit and abort state. Call must
+// only be used from the goroutine running the VM. If v is nil, only non
+// compiled functions can be called.
+func (v *VM) Call(fn Object, args ...Object) (Object, error) {
+	if method := specialMethod(fn, methodCall); method != nil {
+		fn = &BoundMethod{Receiver: fn, Method: method}
+	}
+	if !fn.CanCall() {
+		return nil, fmt.Errorf("not callable: %s", fn.TypeName())
+	}
+	if _, ok := fn.(*CompiledFunction); !ok {
+		if callee, ok := fn.(VMCallable); ok {
+			return callee.CallVM(v, args...)
+		}
+		return fn.Call(args...)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("not callable outside VM: %s", fn.TypeName())
+	}
+	if !v.growFrames(2) || !v.growStack(2) {
+		return nil, ErrStackOverflow
+	}
+
+	// save VM states
+	framesIndex := v.framesIndex
+	sp := v.sp
+	handlerBase := v.handlerBase
+	frameBase := v.frameBase
+	v.curFrame.ip = v.ip
+	v.handlerBase = len(v.handlers)
+	v.frameBase = framesIndex
+
+	// the trampoline frame calls fn and suspends the VM when it returns
+	v.curFrame = &(v.frames[v.framesIndex])
+	v.curFrame.fn = callTrampoline
+	v.curFrame.freeVars = nil
+	v.curFrame.basePointer = v.sp
+	v.curFrame.defers = v.curFrame.defers[:0]
+	v.curInsts = callTrampoline.Instructions
+	v.ip = -1
+	v.framesIndex++
+	v.stack[v.sp] = fn
+	v.stack[v.sp+1] = &Array{Value: args}
+	v.sp += 2
+
+	v.run()
+
+	var ret Object
+	err := v.err
+	if err != nil {
+		// add the frames above the trampoline frame
+		err = v.runtimeError(err, framesIndex)
+		v.err = nil
+	} else if v.curFrame.fn != callTrampoline {
+		err = ErrVMAborted
+	} else {
+		ret = v.stack[v.sp-1]
+	}
+
+	// restore VM states
+	v.handlers = v.handlers[:v.handlerBase]
+	v.handlerBase = handlerBase
+	v.frameBase = frameBase
+	v.framesIndex = framesIndex
+	v.curFrame = &v.frames[v.framesIndex-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = v.curFrame.ip
+	v.sp = sp
+	return ret, err
+}
+
+// resume runs the generator function of gen until it yields a value or
+// returns.
+func (v *VM) resume(gen *Generator) error {
+	if !v.growFrames(2) || !v.growStack(len(gen.stack)+1) {
+		return ErrStackOverflow
+	}
+
+	// save VM states
+	framesIndex := v.framesIndex
+	sp := v.sp
+	handlerBase := v.handlerBase
+	frameBase := v.frameBase
+	prevGen := v.gen
+	v.curFrame.ip = v.ip
+	v.handlerBase = len(v.handlers)
+	v.frameBase = framesIndex
+	v.gen = gen
+	gen.yielded = false
+
+	// the trampoline frame suspends the VM when the function returns
+	v.curFrame = &(v.frames[v.framesIndex])
+	v.curFrame.fn = resumeTrampoline
+	v.curFrame.freeVars = nil
+	v.curFrame.ip = -1
+	v.curFrame.basePointer = v.sp
+	v.curFrame.defers = v.curFrame.defers[:0]
+	v.framesIndex++
+	v.stack[v.sp] = gen.fn
+	v.sp++
+
+	// restore the generator frame
+	bp := v.sp
+	v.curFrame = &(v.frames[v.framesIndex])
+	v.curFrame.fn = gen.fn
+	v.curFrame.freeVars = gen.fn.Free
+	v.curFrame.basePointer = bp
+	v.curFrame.defers = gen.defers
+	gen.defers = nil
+	v.framesIndex++
+	copy(v.stack[bp:], gen.stack)
+	v.sp = bp + len(gen.stack)
+	for _, h := range gen.handlers {
+		h.framesIndex = v.framesIndex
+		h.sp += bp
+		v.handlers = append(v.handlers, h)
+	}
+	v.curInsts = gen.fn.Instructions
+	v.ip = gen.ip
+
+	v.run()
+
+	err := v.err
+	if err != nil {
+		// add the frames above the trampoline frame
+		err = v.runtimeError(err, framesIndex)
+		v.err = nil
+	} else if !gen.yielded && v.curFrame.fn != resumeTrampoline {
+		err = ErrVMAborted
+	}
+
+	// restore VM states
+	v.handlers = v.handlers[:v.handlerBase]
+	v.handlerBase = handlerBase
+	v.frameBase = frameBase
+	v.gen = prevGen
+	v.framesIndex = framesIndex
+	v.curFrame = &v.frames[v.framesIndex-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = v.curFrame.ip
+	v.sp = sp
+	return err
+}
+
+// growStack makes sure the stack can hold n more values on top of the
+// current ones, with the room for a single instruction left. It returns false
+// if the stack would exceed the maximum size.
+func (v *VM) growStack(n int) bool {
+	size := v.sp + n + stackMargin
+	if v.maxStack >= 0 && size > v.maxStack {
+		return false
+	}
+	if size <= len(v.stack) {
+		return true
+	}
+	newSize := 2 * len(v.stack)
+	if newSize < size {
+		newSize = size
+	}
+	if v.maxStack >= 0 && newSize > v.maxStack {
+		newSize = v.maxStack
+	}
+	stack := make([]Object, newSize)
+	copy(stack, v.stack)
+	v.stack = stack
+	return true
+}
+
+// growFrames makes sure there is room for n more frames above the current
+// one. It returns false if the frames would exceed the maximum number.
+func (v *VM) growFrames(n int) bool {
+	size := v.framesIndex + n
+	if v.maxFrames >= 0 && size > v.maxFrames {
+		return false
+	}
+	if size <= len(v.frames) {
+		return true
+	}
+	newSize := 2 * len(v.frames)
+	if newSize < size {
+		newSize = size
+	}
+	if v.maxFrames >= 0 && newSize > v.maxFrames {
+		newSize = v.maxFrames
+	}
+	frames := make([]frame, newSize)
+	copy(frames, v.frames)
+	v.frames = frames
+	v.curFrame = &v.frames[v.framesIndex-1]
+	return true
+}
+
+// runtimeError returns a RuntimeError of err with the call frames above the
+// frame at the index base, innermost first. If err is already a RuntimeError,
+// e.g. returned by a Go function that called back the VM, the frames are
+// appended to it.
+func (v *VM) runtimeError(err error, base int) *RuntimeError {
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		rerr = &RuntimeError{Err: err}
+	}
+	ip := v.ip
+	for i := v.framesIndex - 1; i > base; i-- {
+		fn := v.frames[i].fn
+		if i < v.framesIndex-1 {
+			ip = v.frames[i].ip
+		}
+		pos := fn.SourcePos(ip - 1)
+		frame := StackFrame{
+			Name: fn.Name,
+			Pos:  v.fileSet.Position(pos),
+			IP:   ip,
+		}
+		if f := v.fileSet.File(pos); f != nil {
+			frame.Line = f.LineText(frame.Pos.Line)
+		}
+		rerr.Frames = append(rerr.Frames, frame)
+	}
+	return rerr
+}
+
+// allocMemory checks the object created by the VM against the size limits,
+// and adds its approximate size to the memory used by the VM.
+func (v *VM) allocMemory(o Object) error {
+	switch o := o.(type) {
+	case *String:
+		if v.maxStrLen >= 0 && len(o.Value) > v.maxStrLen {
+			return ErrStringLimit
+		}
+	case *Bytes:
+		if v.maxBytesLen >= 0 && len(o.Value) > v.maxBytesLen {
+			return ErrBytesLimit
+		}
+	}
+	if v.maxMemory < 0 {
+		return nil
+	}
+	v.memory += sizeOf(o)
+	if v.memory > v.maxMemory {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// CheckStringLen returns ErrStringLimit or ErrMemoryLimit if a string of n
+// bytes cannot be created within the string length limits and the memory
+// budget of the VM. Functions building large strings should call it before
+// allocating. If v is nil, only MaxStringLen is checked.
+func (v *VM) CheckStringLen(n int) error {
+	if n < 0 || n > MaxStringLen {
+		return ErrStringLimit
+	}
+	if v == nil {
+		return nil
+	}
+	if v.maxStrLen >= 0 && n > v.maxStrLen {
+		return ErrStringLimit
+	}
+	return v.checkMemory(int64(n))
+}
+
+// CheckBytesLen returns ErrBytesLimit or ErrMemoryLimit if a bytes value of n
+// bytes cannot be created within the bytes length limits and the memory
+// budget of the VM. Functions building large bytes values should call it
+// before allocating. If v is nil, only MaxBytesLen is checked.
+func (v *VM) CheckBytesLen(n int) error {
+	if n < 0 || n > MaxBytesLen {
+		return ErrBytesLimit
+	}
+	if v == nil {
+		return nil
+	}
+	if v.maxBytesLen >= 0 && n > v.maxBytesLen {
+		return ErrBytesLimit
+	}
+	return v.checkMemory(int64(n))
+}
+
+// Format is like Format, but the formatted string is limited by the string
+// length limits and the memory budget of the VM. If v is nil, it's the same
+// as Format.
+func (v *VM) Format(format string, a ...Object) (string, error) {
+	if v == nil {
+		return Format(format, a...)
+	}
+	max, err := MaxStringLen, ErrStringLimit
+	if v.maxStrLen >= 0 && v.maxStrLen < max {
+		max = v.maxStrLen
+	}
+	if v.maxMemory >= 0 && v.maxMemory-v.memory < int64(max) {
+		max, err = 0, ErrMemoryLimit
+		if v.memory < v.maxMemory {
+			max = int(v.maxMemory - v.memory)
+		}
+	}
+	return formatLimit(max, err, format, a...)
+}
+
+// checkMemory checks if n more bytes can be allocated within the memory
+// budget of the VM.
+func (v *VM) checkMemory(n int64) error {
+	if v.maxMemory >= 0 && v.memory+n > v.maxMemory {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// elemSize is the approximate size of an element in arrays and maps.
+const elemSize = 16
+
+// sizeOf returns the approximate number of bytes held by the object, not
+// including the size of its elements.
+func sizeOf(o Object) int64 {
+	switch o := o.(type) {
+	case *String:
+		return int64(len(o.Value))
+	case *Bytes:
+		return int64(len(o.Value))
+	case *Array:
+		return int64(len(o.Value)) * elemSize
+	case *ImmutableArray:
+		return int64(len(o.Value)) * elemSize
+	case *Map:
+		return mapSize(o.Value) + int64(len(o.Hashed))*3*elemSize
+	case *ImmutableMap:
+		return mapSize(o.Value) + int64(len(o.Hashed))*3*elemSize
+	case *Set:
+		return int64(len(o.Value)) * 2 * elemSize
+	case *ImmutableSet:
+		return int64(len(o.Value)) * 2 * elemSize
+	case *BigInt:
+		return int64(len(o.Value.Bits())) * elemSize
+	case *Decimal:
+		return int64(len(o.Value.Bits())) * elemSize
+	case *Record:
+		return int64(len(o.Values)) * elemSize
+	}
+	return 0
+}
+
+// intOverflows returns true if the result of the operation on int values
+// overflowed.
+func intOverflows(left Object, op token.Token, right, res Object) bool {
+	l, lok := left.(*Int)
+	r, rok := right.(*Int)
+	z, zok := res.(*Int)
+	if !lok || !rok || !zok {
+		return false
+	}
+	return int64Overflows(l.Value, op, r.Value, z.Value)
+}
+
+// int64Overflows returns true if xy, the result of the operation on x and y,
+// overflowed.
+func int64Overflows(x int64, op token.Token, y, xy int64) bool {
+	switch op {
+	case token.Add:
+		return (x^xy)&(y^xy) < 0
+	case token.Sub:
+		return (x^y)&(x^xy) < 0
+	case token.Mul:
+		return x != 0 && (xy/x != y || x == -1 && y == math.MinInt64)
+	case token.Quo:
+		return x == math.MinInt64 && y == -1
+	case token.Shl:
+		if y < 0 || y >= 64 {
+			return x != 0
+		}
+		return xy>>uint64(y) != x
+	}
+	return false
+}
+
+// binaryOp evaluates the binary operation of the operands, falling back to
+// the special method of the left operand, and accounts the result against
+// the limits of the VM.
+func (v *VM) binaryOp(
+	left Object,
+	tok token.Token,
+	right Object,
+) (Object, error) {
+	if tok == token.Add {
+		if e := v.checkConcat(left, right); e != nil {
+			return nil, e
+		}
+	}
+	res, e := left.BinaryOp(tok, right)
+	if e == nil && v.overflowCheck && intOverflows(left, tok, right, res) {
+		e = ErrIntOverflow
+	}
+	if e == ErrInvalidOperator {
+		fn := specialMethod(left, binaryOpMethods[tok])
+		if fn != nil {
+			res, e = v.Call(fn, left, right)
+		}
+	}
+	if e != nil {
+		if e == ErrInvalidOperator {
+			return nil, fmt.Errorf("invalid operation: %s %s %s",
+				left.TypeName(), tok.String(), right.TypeName())
+		}
+		return nil, e
+	}
+
+	v.allocs--
+	if v.allocs == 0 {
+		return nil, ErrObjectAllocLimit
+	}
+	if e = v.allocMemory(res); e != nil {
+		return nil, e
+	}
+	return res, nil
+}
+
+// checkConcat checks the result of adding strings, bytes or arrays against
+// the limits of the VM before the operands are concatenated.
+func (v *VM) checkConcat(left, right Object) error {
+	switch left := left.(type) {
+	case *String:
+		if right, ok := right.(*String); ok {
+			return v.CheckStringLen(len(left.Value) + len(right.Value))
+		}
+	case *Bytes:
+		if right, ok := right.(*Bytes); ok {
+			return v.CheckBytesLen(len(left.Value) + len(right.Value))
+		}
+	case *Array:
+		if right, ok := right.(*Array); ok {
+			n := len(left.Value) + len(right.Value)
+			return v.checkMemory(int64(n) * elemSize)
+		}
+	}
+	return nil
+}
+
+// index returns the element of the object at the index, or UndefinedValue if
+// there is none.
+func (v *VM) index(o, index Object) (Object, error) {
+	val, err := v.indexGet(o, index)
+	if err != nil {
+		if err == ErrNotIndexable {
+			return nil, fmt.Errorf("not indexable: %s", index.TypeName())
+		}
+		if err == ErrInvalidIndexType {
+			return nil, fmt.Errorf("invalid index type: %s",
+				index.TypeName())
+		}
+		return nil, err
+	}
+	if val == nil {
+		val = UndefinedValue
+	}
+	return val, nil
+}
+
+// numberBinaryOp evaluates the operation if both operands are ints or both
+// are floats, the same way as their BinaryOp does. It returns a nil result
+// and a nil error for other operands and operators, which are left to
+// BinaryOp.
+func numberBinaryOp(
+	left Object,
+	op token.Token,
+	right Object,
+	overflowCheck bool,
+) (Object, error) {
+	switch l := left.(type) {
+	case *Int:
+		r, ok := right.(*Int)
+		if !ok {
+			return nil, nil
+		}
+		x, y := l.Value, r.Value
+		var xy int64
+		switch op {
+		case token.Add:
+			xy = x + y
+		case token.Sub:
+			xy = x - y
+		case token.Mul:
+			xy = x * y
+		case token.Quo:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			xy = x / y
+		case token.Rem:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			xy = x % y
+		case token.And:
+			xy = x & y
+		case token.Or:
+			xy = x | y
+		case token.Xor:
+			xy = x ^ y
+		case token.AndNot:
+			xy = x &^ y
+		case token.Shl:
+			xy = x << uint64(y)
+		case token.Shr:
+			xy = x >> uint64(y)
+		case token.Less:
+			return boolValue(x < y), nil
+		case token.Greater:
+			return boolValue(x > y), nil
+		case token.LessEq:
+			return boolValue(x <= y), nil
+		case token.GreaterEq:
+			return boolValue(x >= y), nil
+		default:
+			return nil, nil
+		}
+		if overflowCheck && int64Overflows(x, op, y, xy) {
+			return nil, ErrIntOverflow
+		}
+		return newInt(xy), nil
+	case *Float:
+		r, ok := right.(*Float)
+		if !ok {
+			return nil, nil
+		}
+		x, y := l.Value, r.Value
+		switch op {
+		case token.Add:
+			return &Float{Value: x + y}, nil
+		case token.Sub:
+			return &Float{Value: x - y}, nil
+		case token.Mul:
+			return &Float{Value: x * y}, nil
+		case token.Quo:
+			return &Float{Value: x / y}, nil
+		case token.Less:
+			return boolValue(x < y), nil
+		case token.Greater:
+			return boolValue(x > y), nil
+		case token.LessEq:
+			return boolValue(x <= y), nil
+		case token.GreaterEq:
+			return boolValue(x >= y), nil
+		}
+	}
+	return nil, nil
+}
+
+func mapSize(m map[string]Object) (size int64) {
+	for k := range m {
+		size += int64(len(k)) + 2*elemSize
+	}
+	return
+}
+
 // IsStackEmpty tests if the stack is empty or not.
 func (v *VM) IsStackEmpty() bool {
 	return v.sp == 0
 }
 
+// Names of the special methods of maps and records that overload the
+// operators. They are called with the map or the record as the first
+// argument.
+const (
+	methodEqual    = "__eq__"
+	methodIndex    = "__index__"
+	methodCall     = "__call__"
+	methodIter     = "__iter__"
+	methodString   = "__string__"
+	methodContains = "__contains__"
+)
+
+// binaryOpMethods are the names of the special methods that overload the
+// binary operators.
+var binaryOpMethods = map[token.Token]string{
+	token.Add:       "__add__",
+	token.Sub:       "__sub__",
+	token.Mul:       "__mul__",
+	token.Quo:       "__div__",
+	token.Rem:       "__mod__",
+	token.And:       "__and__",
+	token.Or:        "__or__",
+	token.Xor:       "__xor__",
+	token.AndNot:    "__andnot__",
+	token.Shl:       "__shl__",
+	token.Shr:       "__shr__",
+	token.Less:      "__lt__",
+	token.LessEq:    "__le__",
+	token.Greater:   "__gt__",
+	token.GreaterEq: "__ge__",
+}
+
+// specialMethod returns the special method of a map or a record with the
+// given name, or nil if it does not have one.
+func specialMethod(o Object, name string) Object {
+	var fn Object
+	switch o := o.(type) {
+	case *Map:
+		fn = o.Value[name]
+	case *ImmutableMap:
+		fn = o.Value[name]
+	case *Record:
+		fn = o.Type.Methods[name]
+	default:
+		return nil
+	}
+	if fn == nil || !fn.CanCall() {
+		return nil
+	}
+	return fn
+}
+
+// equals returns true if the objects are equal. The "__eq__" special method
+// of the left-hand side is used if it has one.
+func (v *VM) equals(left, right Object) (bool, error) {
+	fn := specialMethod(left, methodEqual)
+	if fn == nil {
+		return left.Equals(right), nil
+	}
+	res, err := v.Call(fn, left, right)
+	if err != nil {
+		return false, err
+	}
+	return !res.IsFalsy(), nil
+}
+
+// contains returns true if the container contains the value. The
+// "__contains__" special method of the container is used if it has one.
+func (v *VM) contains(container, value Object) (bool, error) {
+	if fn := specialMethod(container, methodContains); fn != nil {
+		res, err := v.Call(fn, container, value)
+		if err != nil {
+			return false, err
+		}
+		return !res.IsFalsy(), nil
+	}
+	var res bool
+	err := ErrInvalidOperator
+	if c, ok := container.(Container); ok {
+		res, err = c.Contains(value)
+	}
+	if err == ErrInvalidOperator {
+		return false, fmt.Errorf("invalid operation: %s in %s",
+			value.TypeName(), container.TypeName())
+	}
+	return res, err
+}
+
+// indexGet returns the value for the index. If a map or a record does not
+// have the index, its "__index__" special method is called instead if it has
+// one.
+func (v *VM) indexGet(o, index Object) (Object, error) {
+	res, err := o.IndexGet(index)
+	if err == nil && res != nil && res != UndefinedValue {
+		return res, nil
+	}
+	fn := specialMethod(o, methodIndex)
+	if fn == nil {
+		return res, err
+	}
+	if err == nil {
+		// the value of an existing key can be undefined
+		var found bool
+		switch o := o.(type) {
+		case *Map:
+			found = mapHasKey(o.Value, o.Hashed, index)
+		case *ImmutableMap:
+			found = mapHasKey(o.Value, o.Hashed, index)
+		case *Record:
+			found = true
+		}
+		if found {
+			return res, nil
+		}
+	}
+	return v.Call(fn, o, index)
+}
+
+// stringOf returns the string representation of the object. The
+// "__string__" special method of a map or a record is used if it has one.
+func (v *VM) stringOf(o Object) (string, error) {
+	if s, ok := o.(*String); ok {
+		return s.Value, nil
+	}
+	fn := specialMethod(o, methodString)
+	if fn == nil {
+		return o.String(), nil
+	}
+	res, err := v.Call(fn, o)
+	if err != nil {
+		return "", err
+	}
+	s, ok := res.(*String)
+	if !ok {
+		return "", fmt.Errorf("invalid return type of %s: %s",
+			methodString, res.TypeName())
+	}
+	return s.Value, nil
+}
+
 func indexAssign(dst, src Object, selectors []Object) error {
 	numSel := len(selectors)
 	for sidx := numSel - 1; sidx > 0; sidx-- {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"math/rand"
 	"reflect"
 	_runtime "runtime"
@@ -751,8 +752,6 @@ func TestBuiltinFunction(t *testing.T) {
 	expectError(t, `delete(immutable([]), "")`, nil,
 		`invalid type for argument 'first'`)
 	expectError(t, `delete([], "")`, nil, `invalid type for argument 'first'`)
-	expectError(t, `delete({}, 1)`, nil, `invalid type for argument 'second'`)
-	expectError(t, `delete({}, 1.0)`, nil, `invalid type for argument 'second'`)
 	expectError(t, `delete({}, undefined)`, nil,
 		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, [])`, nil, `invalid type for argument 'second'`)
@@ -761,16 +760,20 @@ func TestBuiltinFunction(t *testing.T) {
 		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, bytes("str"))`, nil,
 		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, char(35))`, nil,
-		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, time(1257894000))`, nil,
-		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, immutable({}))`, nil,
 		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, immutable([]))`, nil,
+	expectError(t, `delete({}, immutable([[]]))`, nil,
 		`invalid type for argument 'second'`)
 
 	expectRun(t, `out = delete({}, "")`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = delete({}, 1)`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = delete({}, 1.0)`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = delete({}, char(35))`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = delete({}, time(1257894000))`, nil,
+		tengo.UndefinedValue)
+	expectRun(t, `out = delete({}, immutable([]))`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = {"1": 1}; out[1] = 2; delete(out, 1)`, nil,
+		MAP{"1": 1})
 	expectRun(t, `out = {key1: 1}; delete(out, "key1")`, nil, MAP{})
 	expectRun(t, `out = {key1: 1, key2: "2"}; delete(out, "key1")`, nil,
 		MAP{"key2": "2"})
@@ -940,6 +943,91 @@ b(a, c)
 `, nil, "Runtime Error: not callable: int\n\tat test:7:4\n\tat test:3:4\n\tat test:9:1")
 }
 
+func TestCallback(t *testing.T) {
+	apply := &tengo.UserFunction{
+		Name: "apply",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			return vm.Call(args[0], args[1:]...)
+		},
+	}
+	each := &tengo.BuiltinFunction{
+		Name: "each",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			arr := args[0].(*tengo.Array)
+			var res []tengo.Object
+			for _, e := range arr.Value {
+				ret, err := vm.Call(args[1], e)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, ret)
+			}
+			return &tengo.Array{Value: res}, nil
+		},
+	}
+	protect := &tengo.UserFunction{
+		Name: "protect",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			ret, err := vm.Call(args[0])
+			if err != nil {
+				return &tengo.Error{Value: &tengo.String{Value: err.Error()}}, nil
+			}
+			return ret, nil
+		},
+	}
+	opts := Opts().Symbol("apply", apply).Symbol("each", each).
+		Symbol("protect", protect).Skip2ndPass()
+
+	expectRun(t, `out = apply(func(a, b) { return a + b }, 1, 2)`, opts, 3)
+	expectRun(t, `out = apply(func(...a) { return a }, 1, 2)`, opts, ARR{1, 2})
+	expectRun(t, `out = apply(func() {})`, opts, tengo.UndefinedValue)
+	expectRun(t, `out = apply(len, [1, 2, 3])`, opts, 3)
+	expectRun(t, `out = apply(apply, func(a) { return a * 2 }, 4)`, opts, 8)
+	expectRun(t, `
+	a := 10
+	f := func(x) { a += x; return a }
+	out = each([1, 2, 3], f)`, opts, ARR{11, 13, 16})
+	expectRun(t, `
+	out = each([1, 2, 3], func(x) {
+		return each([x, x * 10], func(y) { return y + 1 })
+	})`, opts, ARR{ARR{2, 11}, ARR{3, 21}, ARR{4, 31}})
+	expectRun(t, `
+	f := func(n) {
+		if n == 0 { return 0 }
+		return apply(f, n - 1) + n
+	}
+	out = f(10)`, opts, 55)
+
+	// the VM state is restored after a failed callback
+	expectRun(t, `
+	e := protect(func() { return 1 + "a" })
+	out = [is_error(e), apply(func(a) { return a + 1 }, 1)]`,
+		opts, ARR{true, 2})
+	expectRun(t, `
+	out = protect(func() { return apply(func() { return 1 + "a" }) })`,
+		opts, errorObject("Runtime Error: invalid operation: int + string"+
+			"\n\tat test:2:54\n\tat test:2:32"))
+
+	expectError(t, `apply(func(a) {}, 1, 2)`, opts,
+		"Runtime Error: wrong number of arguments: want=1, got=2")
+	expectError(t, `apply(1)`, opts, "Runtime Error: not callable: int")
+	expectError(t, `
+each([1, 2], func(x) {
+	return x + "a"
+})`, opts, "Runtime Error: invalid operation: int + string\n\tat test:3:9\n\tat test:2:1")
+	expectError(t, `f := func() { return apply(f) }; f()`, opts,
+		"stack overflow")
+
+	// outside VM
+	ret, err := apply.Call(&tengo.BuiltinFunction{Value: func(args ...tengo.Object) (tengo.Object, error) {
+		return args[0], nil
+	}}, &tengo.Int{Value: 5})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 5}, ret)
+	_, err = apply.Call(&tengo.CompiledFunction{})
+	require.Error(t, err)
+}
+
 func TestChar(t *testing.T) {
 	expectRun(t, `out = 'a'`, nil, 'a')
 	expectRun(t, `out = '九'`, nil, rune(20061))
@@ -1821,6 +1909,387 @@ out = (func() {
 	`, nil, 2)
 }
 
+func TestGenerator(t *testing.T) {
+	expectRun(t, `
+gen := func(n) {
+	for i := 0; i < n; i++ { yield i * i }
+}
+out = []
+for k, v in gen(4) { out = append(out, [k, v]) }`,
+		nil, ARR{ARR{0, 0}, ARR{1, 1}, ARR{2, 4}, ARR{3, 9}})
+
+	// values are produced on demand
+	expectRun(t, `
+out = []
+gen := func() {
+	out = append(out, "a")
+	yield 1
+	out = append(out, "b")
+	yield
+	out = append(out, "c")
+}
+for x in gen() { out = append(out, x) }`,
+		nil, ARR{"a", 1, "b", tengo.UndefinedValue, "c"})
+	expectRun(t, `
+out = 0
+gen := func() {
+	for { out++; yield out }
+}
+for x in gen() { if x == 5 { break } }`, nil, 5)
+	expectRun(t, `
+gen := func() {
+	yield 1
+	return
+	yield 2
+}
+out = 0
+for x in gen() { out += x }`, nil, 1)
+
+	// arguments, free variables and nested generators
+	expectRun(t, `
+n := 3
+gen := func(s, ...v) {
+	for i := 0; i < n; i++ { yield [s, v] }
+	n = 0
+}
+out = []
+for x in gen("a", 1, 2) { out = append(out, x) }
+out = append(out, n)`,
+		nil, ARR{ARR{"a", ARR{1, 2}}, ARR{"a", ARR{1, 2}},
+			ARR{"a", ARR{1, 2}}, 0})
+	expectRun(t, `
+rng := func(n) { for i := 0; i < n; i++ { yield i } }
+pairs := func(n) {
+	for i in rng(n) {
+		for j in rng(i) { yield [i, j] }
+	}
+}
+out = []
+for p in pairs(3) { out = append(out, p) }`,
+		nil, ARR{ARR{1, 0}, ARR{2, 0}, ARR{2, 1}})
+	expectRun(t, `
+gen := func() { yield 1 }
+g := gen()
+out = []
+for x in g { out = append(out, x) }
+for x in g { out = append(out, x) }`, nil, ARR{1})
+	expectRun(t, `out = type_name(func() { yield }())`, nil, "generator")
+	expectRun(t, `f := func() { yield 1 }; out = is_iterable(f())`,
+		nil, true)
+
+	// try statements and deferred calls across yields
+	expectRun(t, `
+gen := func() {
+	defer func() { out = append(out, "defer") }()
+	for x in [1, 2] {
+		try {
+			yield x
+			if x == 2 { a := 1 + "a" }
+		} catch {
+			yield "catch"
+		} finally {
+			yield "finally"
+		}
+	}
+}
+out = []
+for x in gen() { out = append(out, x) }`,
+		nil, ARR{1, "finally", 2, "catch", "finally", "defer"})
+
+	// leaving a for-in loop early does not end the generator, so its
+	// pending deferred calls run only when a later loop exhausts it
+	expectRun(t, `
+gen := func() {
+	defer func() { out = append(out, "defer") }()
+	try {
+		yield 1
+		yield 2
+	} finally {
+		out = append(out, "finally")
+	}
+}
+g := gen()
+f := func() { for x in g { return x } }
+out = []
+for x in g { out = append(out, x); break }
+r := f()
+out = append(out, r, "resumed")
+for x in g { out = append(out, x) }`,
+		nil, ARR{1, 2, "resumed", "finally", "defer"})
+	expectRun(t, `
+gen := func() {
+	defer func() { out = append(out, "defer") }()
+	for { yield 1 }
+}
+out = []
+for x in gen() { break }
+try {
+	for x in gen() { a := 1 + "a" }
+} catch {
+	out = append(out, "catch")
+}`, nil, ARR{"catch"})
+
+	expectRun(t, `
+gen := func() {
+	yield 1
+	a := 1 + "a"
+}
+out = []
+try {
+	for x in gen() { out = append(out, x) }
+} catch e {
+	out = append(out, e.value.message)
+}`, nil, ARR{1, "invalid operation: int + string"})
+	expectError(t, `
+gen := func() {
+	yield 1
+	yield 1 + "a"
+}
+for x in gen() {}`, Opts().Skip2ndPass(),
+		"Runtime Error: invalid operation: int + string\n"+
+			"\tat test:4:8\n\tat test:6:1")
+	expectError(t, `
+g := undefined
+gen := func() { for x in g { yield x } }
+g = gen()
+for x in g {}`, nil, "generator already running")
+	expectErrorIs(t, `
+gen := func() { for { yield [1, 2] } }
+for x in gen() {}`, Opts().MaxAllocs(100), tengo.ErrObjectAllocLimit)
+
+	// yield can still be used as a selector and a map key
+	expectRun(t, `
+gen := func(m) {
+	yield m.yield
+	yield {yield: m.yield + 1}.yield
+}
+out = []
+for x in gen({yield: 1}) { out = append(out, x) }`, nil, ARR{1, 2})
+}
+
+func TestRecord(t *testing.T) {
+	expectRun(t, `
+type Point { x, y }
+p := Point(1, 2)
+p.y = 5
+out = [p.x, p.y, p["x"], type_name(p), string(p)]`,
+		nil, ARR{1, 5, 1, "Point", "Point{x: 1, y: 5}"})
+	expectRun(t, `
+type Point {
+	x
+	y
+}
+out = [Point(1).x, Point(1).y, string(Point())]`,
+		nil, ARR{1, tengo.UndefinedValue, "Point{x: <undefined>, y: <undefined>}"})
+	expectRun(t, `type Empty {}; out = string(Empty())`, nil, "Empty{}")
+
+	// methods
+	expectRun(t, `
+type Point { x, y }
+func (p Point) dist(o) {
+	dx := p.x - o.x
+	dy := p.y - o.y
+	return dx*dx + dy*dy
+}
+func (p Point) move(dx, dy) {
+	p.x += dx
+	p.y += dy
+	return p
+}
+a := Point(1, 2)
+out = [a.dist(Point(4, 6)), a.move(1, 1).move(1, 1).x, a.y]`,
+		nil, ARR{25, 3, 4})
+	expectRun(t, `
+type Stack { items }
+func (s Stack) push(...v) { s.items = append(s.items, v...) }
+func (s Stack) pop() {
+	x := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return x
+}
+s := Stack([])
+s.push(1, 2, 3)
+out = [s.pop(), s.pop(), len(s.items)]`, nil, ARR{3, 2, 1})
+	expectRun(t, `
+type Counter { n }
+func (c Counter) inc() { c.n++ }
+c := Counter(0)
+f := c.inc
+f(); f()
+Counter.inc(c)
+out = c.n`, nil, 3)
+	expectRun(t, `
+type Node { value, next }
+func (n Node) sum() {
+	if n.next == undefined { return n.value }
+	return n.value + n.next.sum()
+}
+out = Node(1, Node(2, Node(3))).sum()`, nil, 6)
+
+	// fields holding functions are not bound
+	expectRun(t, `
+type Handler { fn }
+out = Handler(func(x) { return x * 2 }).fn(3)`, nil, 6)
+
+	// types and methods declared in functions
+	expectRun(t, `
+f := func(k) {
+	type T { v }
+	func (t T) get() { return t.v * k }
+	return T
+}
+T := f(2)
+out = [T(3).get(), is_instance(T(1), T), is_instance(T(1), f(2))]`,
+		nil, ARR{6, true, false})
+
+	// is_instance
+	expectRun(t, `
+type A { x }
+type B { x }
+out = [is_instance(A(1), A), is_instance(A(1), B), is_instance({x: 1}, A)]`,
+		nil, ARR{true, false, false})
+
+	// equality and copy
+	expectRun(t, `
+type P { x, y }
+a := P(1, [2])
+b := copy(a)
+b.y[0] = 3
+out = [a == P(1, [2]), a == b, a.y[0], type_name(P)]`,
+		nil, ARR{true, false, 2, "record-type"})
+
+	// methods called from Go functions
+	expectRun(t, `
+type P { x }
+func (p P) double(n) { return p.x * n }
+out = fn(P(4).double, 2)`, Opts().Symbol("fn", &tengo.UserFunction{
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			return vm.Call(args[0], args[1])
+		},
+	}).Skip2ndPass(), 8)
+
+	// "type" outside a type declaration is a plain identifier
+	expectRun(t, `m := {type: 1}; out = m.type`, nil, 1)
+	expectRun(t, `m := {}; m.type = "a"; out = m["type"]`, nil, "a")
+	expectRun(t, `type := 5; out = type * 2`, nil, 10)
+	expectRun(t, `
+type := "x"
+type T { type }
+out = [type, T(type).type]`, nil, ARR{"x", "x"})
+
+	expectError(t, `type P { x }; P(1).y`, nil,
+		"unknown field or method 'y' of P")
+	expectError(t, `type P { x }; p := P(1); p.y = 1`, nil,
+		"unknown field 'y' of P")
+	expectError(t, `type P { x }; P(1, 2)`, nil,
+		"wrong number of arguments: want<=1, got=2")
+	expectError(t, `type P { x }; func (p P) x() {}`, nil,
+		"field and method with the same name 'x'")
+	expectError(t, `P := {}; func (p P) f() {}`, nil,
+		"invalid receiver type: map")
+	expectError(t, `type P { x }; is_instance(1, 2)`, nil,
+		"invalid type for argument 'second'")
+	expectError(t, `
+type P { x }
+func (p P) f() { return p.x + "a" }
+P(1).f()`, Opts().Skip2ndPass(),
+		"Runtime Error: invalid operation: int + string\n"+
+			"\tat test:3:25\n\tat test:4:1")
+}
+
+func TestSpecialMethods(t *testing.T) {
+	// records
+	expectRun(t, `
+type Vec { x, y }
+func (v Vec) __add__(o) { return Vec(v.x + o.x, v.y + o.y) }
+func (v Vec) __mul__(k) { return Vec(v.x * k, v.y * k) }
+func (v Vec) __lt__(o) { return v.x*v.x + v.y*v.y < o.x*o.x + o.y*o.y }
+func (v Vec) __eq__(o) { return is_instance(o, Vec) && v.x == o.x && v.y == o.y }
+func (v Vec) __string__() { return "(" + v.x + ", " + v.y + ")" }
+a := Vec(1, 2)
+b := a + Vec(3, 4) * 2
+b += a
+out = [string(b), "${a}", a < b, b < a, a == Vec(1, 2), a != Vec(1, 2), a == 1]`,
+		nil, ARR{"(8, 12)", "(1, 2)", true, false, true, false, false})
+	expectRun(t, `
+type Interval { lo, hi }
+func (i Interval) __index__(k) { return i.lo + k }
+func (i Interval) __iter__() {
+	return func() { for x := i.lo; x < i.hi; x++ { yield x } }()
+}
+func (i Interval) __call__(x) { return i.lo <= x && x < i.hi }
+r := Interval(2, 5)
+out = []
+for x in r { out = append(out, x) }
+out = append(out, r[1], r.lo, r(3), r(5))`,
+		nil, ARR{2, 3, 4, 3, 2, true, false})
+	expectRun(t, `
+type Interval { lo, hi }
+func (i Interval) __contains__(x) { return i.lo <= x && x < i.hi }
+r := Interval(2, 5)
+out = [3 in r, 5 in r, 5 not in r]`,
+		nil, ARR{true, false, true})
+
+	// maps
+	expectRun(t, `
+money := func(n) {
+	return {
+		cents: n,
+		__add__: func(a, b) { return money(a.cents + b.cents) },
+		__eq__: func(a, b) { return a.cents == b.cents },
+		__string__: func(m) { return format("$%d.%02d", m.cents / 100, m.cents % 100) }
+	}
+}
+a := money(150) + money(275)
+out = [string(a), a == money(425), a == money(1)]`,
+		nil, ARR{"$4.25", true, false})
+	expectRun(t, `
+defaults := {a: 1}
+m := immutable({
+	b: undefined,
+	__index__: func(self, k) { return defaults[k] }
+})
+out = [m.a, m.b, m.c, m.__index__ != undefined]`,
+		nil, ARR{1, tengo.UndefinedValue, tengo.UndefinedValue, true})
+	expectRun(t, `
+m := {n: 2, __call__: func(self, x) { return self.n * x }}
+out = [m(3), m([4]...)]`, nil, ARR{6, 8})
+	expectRun(t, `
+m := {__iter__: func(self) { return [1, 2, 3] }}
+out = 0
+for x in m { out += x }`, nil, 6)
+	expectRun(t, `
+m := {__contains__: func(self, x) { return x % 2 == 0 }}
+out = [2 in m, 3 in m, "__contains__" in {}]`, nil, ARR{true, false, false})
+
+	// hooks are optional
+	expectRun(t, `
+m := {a: 1}
+out = [m == {a: 1}, string(m), m.b]`,
+		nil, ARR{true, "{a: 1}", tengo.UndefinedValue})
+	expectError(t, `m := {__add__: 1}; m + 1`, nil,
+		"invalid operation: map + int")
+	expectError(t, `type P {}; P() - 1`, nil, "invalid operation: P - int")
+
+	// methods called from Go functions
+	expectRun(t, `
+m := {__call__: func(self, x) { return x + 1 }}
+out = fn(m, 1)`, Opts().Symbol("fn", &tengo.UserFunction{
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			return vm.Call(args[0], args[1])
+		},
+	}).Skip2ndPass(), 2)
+
+	expectError(t, `m := {__string__: func(self) { return 1 }}; string(m)`,
+		nil, "invalid return type of __string__: int")
+	expectError(t, `
+type P {}
+func (p P) __add__(o) { return 1 + "a" }
+P() + 1`, Opts().Skip2ndPass(),
+		"Runtime Error: invalid operation: int + string\n"+
+			"\tat test:3:32\n\tat test:4:1")
+}
+
 func TestBlocksInGlobalScope(t *testing.T) {
 	expectRun(t, `
 f := undefined
@@ -2031,6 +2500,11 @@ func TestImmutable(t *testing.T) {
 		nil, "not index-assignable")
 	expectError(t, `a := ["foo", immutable([1,2,3])]; a[1][1] = "bar"`,
 		nil, "not index-assignable")
+	expectRun(t, `
+f := func() { return immutable([1, 2]) }
+a := copy(f()); a[0] = 5
+b := append(f(), 3)
+out = [a, b, f()]`, nil, ARR{ARR{5, 2}, ARR{1, 2, 3}, IARR{1, 2}})
 	expectRun(t, `a := immutable([1,2,3]); b := copy(a); b[1] = 5; out = b`,
 		nil, ARR{1, 5, 3})
 	expectRun(t, `a := immutable([1,2,3]); b := copy(a); b[1] = 5; out = a`,
@@ -2437,6 +2911,156 @@ func TestInteger(t *testing.T) {
 
 	expectRun(t, `out = 9 + '0'`, nil, '9')
 	expectRun(t, `out = '9' - 5`, nil, '4')
+
+	// cached small ints
+	expectRun(t, `a := 1023; out = a + 1`, nil, 1024)
+	expectRun(t, `a := -128; out = a - 1`, nil, -129)
+	expectRun(t, `a := 1; b := a + 1; c := a + 1; out = [b, c, b == c]`,
+		nil, ARR{2, 2, true})
+	expectRun(t, `a := 5; out = [a < 6, a > 6, a <= 5, a >= 6, a != 5]`,
+		nil, ARR{true, false, true, false, false})
+	expectRun(t, `a := 1.5; out = [a + 1.0, a - 1.0, a * 2.0, a / 0.5, a < 2.0]`,
+		nil, ARR{2.5, 0.5, 3.0, 3.0, true})
+
+	expectError(t, `a := 0; b := 5 / a`, nil, "division by zero")
+	expectError(t, `a := 0; b := 5 % a`, nil, "division by zero")
+}
+
+func TestBigInt(t *testing.T) {
+	expectRun(t, `out = 5n`, nil, bigInt("5"))
+	expectRun(t, `out = -5n`, nil, bigInt("-5"))
+	expectRun(t, `out = 0x10n`, nil, bigInt("16"))
+	expectRun(t, `out = 123456789012345678901234567890n`, nil,
+		bigInt("123456789012345678901234567890"))
+	expectRun(t, `out = 9223372036854775807n + 1`, nil,
+		bigInt("9223372036854775808"))
+	expectRun(t, `out = 1 - 9223372036854775809n`, nil,
+		bigInt("-9223372036854775808"))
+	expectRun(t, `out = 2n * 3`, nil, bigInt("6"))
+	expectRun(t, `out = 7n / 2`, nil, bigInt("3"))
+	expectRun(t, `out = -7n / 2`, nil, bigInt("-3"))
+	expectRun(t, `out = -7n % 2`, nil, bigInt("-1"))
+	expectRun(t, `out = 1n << 100`, nil,
+		bigInt("1267650600228229401496703205376"))
+	expectRun(t, `out = (1n << 100) >> 99`, nil, bigInt("2"))
+	expectRun(t, `out = 6n & 3`, nil, bigInt("2"))
+	expectRun(t, `out = 6n | 3`, nil, bigInt("7"))
+	expectRun(t, `out = 6n ^ 3`, nil, bigInt("5"))
+	expectRun(t, `out = 6n &^ 3`, nil, bigInt("4"))
+	expectRun(t, `out = ^5n`, nil, bigInt("-6"))
+	expectRun(t, `out = 1n + 0.5`, nil, 1.5)
+	expectRun(t, `out = 0.5 + 1n`, nil, 1.5)
+
+	expectRun(t, `out = 1n < 2`, nil, true)
+	expectRun(t, `out = 2 <= 1n`, nil, false)
+	expectRun(t, `out = 1n > 0.5`, nil, true)
+	expectRun(t, `out = 1n == 1`, nil, true)
+	expectRun(t, `out = 1 == 1n`, nil, true)
+	expectRun(t, `out = 1n != 2n`, nil, true)
+	expectRun(t, `m := {}; m[1n] = "a"; out = m[1]`, nil, "a")
+	expectRun(t, `m := {}; m[1] = "a"; out = m[1n]`, nil, "a")
+	expectRun(t, `m := {}; m[1n << 64] = "a"; out = m[1n << 64]`, nil, "a")
+	expectRun(t, `out = 1n in [1, 2]`, nil, true)
+	expectRun(t, `out = !0n`, nil, true)
+	expectRun(t, `out = 0n ? "y" : "n"`, nil, "n")
+
+	expectRun(t, `out = big_int("123456789012345678901234567890")`,
+		nil, bigInt("123456789012345678901234567890"))
+	expectRun(t, `out = big_int(5)`, nil, bigInt("5"))
+	expectRun(t, `out = big_int(5.9)`, nil, bigInt("5"))
+	expectRun(t, `out = big_int("foo")`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = big_int("foo", 1)`, nil, 1)
+	expectRun(t, `out = int(5n)`, nil, 5)
+	expectRun(t, `out = int(1n << 64)`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = float(1n << 64)`, nil, 18446744073709551616.0)
+	expectRun(t, `out = string(1n << 64)`, nil, "18446744073709551616")
+	expectRun(t, `out = is_big_int(5n)`, nil, true)
+	expectRun(t, `out = is_big_int(5)`, nil, false)
+	expectRun(t, `out = type_name(5n)`, nil, "big-int")
+
+	expectError(t, `1n / 0`, nil, "division by zero")
+	expectError(t, `1n % 0n`, nil, "division by zero")
+	expectError(t, `1n << -1`, nil, "invalid operation")
+	expectError(t, `1n + "a"`, nil, "invalid operation")
+}
+
+func TestDecimal(t *testing.T) {
+	expectRun(t, `out = 12.34d`, nil, decimal("12.34"))
+	expectRun(t, `out = 12.30d`, nil, decimal("12.30"))
+	expectRun(t, `out = 5d`, nil, decimal("5"))
+	expectRun(t, `out = -0.005d`, nil, decimal("-0.005"))
+	expectRun(t, `out = 1.5e3d`, nil, decimal("1500"))
+	expectRun(t, `out = 15e-1d`, nil, decimal("1.5"))
+	expectRun(t, `out = .5d`, nil, decimal("0.5"))
+	expectRun(t, `out = 0x1d`, nil, 29)
+
+	expectRun(t, `out = 0.1d + 0.2d`, nil, decimal("0.3"))
+	expectRun(t, `out = 0.1d + 0.2d == 0.3d`, nil, true)
+	expectRun(t, `out = 1.5d + 1.25d`, nil, decimal("2.75"))
+	expectRun(t, `out = 1.50d - 2`, nil, decimal("-0.50"))
+	expectRun(t, `out = 2.50d * 3`, nil, decimal("7.50"))
+	expectRun(t, `out = 1.1d * 1.1d`, nil, decimal("1.21"))
+	expectRun(t, `out = 10d / 4`, nil, decimal("2.5"))
+	expectRun(t, `out = 10.00d / 4`, nil, decimal("2.50"))
+	expectRun(t, `out = 1d / 3`, nil, decimal("0.3333333333333333"))
+	expectRun(t, `out = 2d / 3`, nil, decimal("0.6666666666666667"))
+	expectRun(t, `out = -2d / 3`, nil, decimal("-0.6666666666666667"))
+	expectRun(t, `out = 1 + 0.5d`, nil, decimal("1.5"))
+	expectRun(t, `out = 10 / 4d`, nil, decimal("2.5"))
+	expectRun(t, `out = (1n << 64) + 0.5d`, nil,
+		decimal("18446744073709551616.5"))
+	expectRun(t, `out = 0.5d + (1n << 64)`, nil,
+		decimal("18446744073709551616.5"))
+	expectRun(t, `out = -1.5d`, nil, decimal("-1.5"))
+	expectRun(t, `a := 1.5d; out = -a`, nil, decimal("-1.5"))
+
+	expectRun(t, `out = 1.5d < 2`, nil, true)
+	expectRun(t, `out = 1.5d >= 1.50d`, nil, true)
+	expectRun(t, `out = 2 > 1.99d`, nil, true)
+	expectRun(t, `out = 1.0d == 1`, nil, true)
+	expectRun(t, `out = 1 == 1.00d`, nil, true)
+	expectRun(t, `out = 1.5d != 1.50d`, nil, false)
+	expectRun(t, `m := {}; m[1.0d] = "a"; out = m[1]`, nil, "a")
+	expectRun(t, `m := {}; m[1.5d] = "a"; out = m[1.50d]`, nil, "a")
+	expectRun(t, `out = 1.50d in set(1.5d)`, nil, true)
+	expectRun(t, `out = !0.00d`, nil, true)
+
+	expectRun(t, `out = decimal("12.34")`, nil, decimal("12.34"))
+	expectRun(t, `out = decimal("-1e-3")`, nil, decimal("-0.001"))
+	expectRun(t, `out = decimal(5)`, nil, decimal("5"))
+	expectRun(t, `out = decimal(0.1)`, nil, decimal("0.1"))
+	expectRun(t, `out = decimal(1n << 64)`, nil,
+		decimal("18446744073709551616"))
+	expectRun(t, `out = decimal("foo")`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = decimal("1_000")`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = decimal("foo", 0)`, nil, 0)
+	expectRun(t, `out = int(-2.9d)`, nil, -2)
+	expectRun(t, `out = float(2.5d)`, nil, 2.5)
+	expectRun(t, `out = big_int(2.5d)`, nil, bigInt("2"))
+	expectRun(t, `out = string(12.30d)`, nil, "12.30")
+	expectRun(t, `out = is_decimal(1d)`, nil, true)
+	expectRun(t, `out = is_decimal(1.0)`, nil, false)
+	expectRun(t, `out = type_name(1d)`, nil, "decimal")
+
+	expectError(t, `1d / 0`, nil, "division by zero")
+	expectError(t, `1.5d + 1.5`, nil, "invalid operation")
+	expectError(t, `1.5d % 1`, nil, "invalid operation")
+}
+
+func decimal(s string) *tengo.Decimal {
+	d, err := tengo.ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func bigInt(s string) *tengo.BigInt {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic(fmt.Errorf("invalid big-int: %s", s))
+	}
+	return &tengo.BigInt{Value: v}
 }
 
 type StringArrayIterator struct {
@@ -2534,6 +3158,58 @@ func TestLogical(t *testing.T) {
 		nil, 7)
 }
 
+func TestOptionalChaining(t *testing.T) {
+	expectRun(t, `a := {b: {c: 1}}; out = a?.b?.c`, nil, 1)
+	expectRun(t, `a := {b: {c: 1}}; out = a.x?.c`, nil, tengo.UndefinedValue)
+	expectRun(t, `a := undefined; out = a?.b.c.d`, nil, tengo.UndefinedValue)
+	expectRun(t, `a := [1, [2, 3]]; out = a?.[1]?.[0]`, nil, 2)
+	expectRun(t, `a := undefined; out = a?.[1][2]`, nil, tengo.UndefinedValue)
+	expectRun(t, `a := [1, 2, 3]; out = a?.[1:]`, nil, ARR{2, 3})
+	expectRun(t, `a := undefined; out = a?.[1:]`, nil, tengo.UndefinedValue)
+	expectRun(t, `f := func(x) { return x * 2 }; out = f?.(2)`, nil, 4)
+	expectRun(t, `a := {}; out = a.f?.(2)`, nil, tengo.UndefinedValue)
+	expectRun(t, `a := {f: func() { return [1] }}; out = a.f?.()?.[0]`,
+		nil, 1)
+
+	// falsy values are not undefined
+	expectError(t, `a := 0; b := a?.b`, nil, "not indexable")
+	expectError(t, `a := {}; b := a?.f()`, nil, "not callable: undefined")
+	expectError(t, `a := 0; b := a?.()`, nil, "not callable: int")
+
+	// the rest of the chain, including arguments, is skipped
+	expectRun(t, `
+out = 0
+f := func() { out++; return 1 }
+a := undefined
+b := a?.b(f()).c(f())
+c := a?.[f()]`, nil, 0)
+	expectRun(t, `
+a := undefined
+f := func(x) { return x }
+out = [a?.b, (a?.b)?.c, f(a?.b) ?? 2]`, nil, ARR{
+		tengo.UndefinedValue, tengo.UndefinedValue, 2})
+}
+
+func TestCoalesce(t *testing.T) {
+	expectRun(t, `out = undefined ?? 1`, nil, 1)
+	expectRun(t, `out = 2 ?? 1`, nil, 2)
+	expectRun(t, `out = 0 ?? 1`, nil, 0)
+	expectRun(t, `out = "" ?? 1`, nil, "")
+	expectRun(t, `out = false ?? 1`, nil, false)
+	expectRun(t, `out = [] ?? 1`, nil, ARR{})
+	expectRun(t, `out = undefined ?? undefined ?? 3`, nil, 3)
+	expectRun(t, `out = undefined ?? undefined`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = undefined ?? false || true`, nil, true)
+	expectRun(t, `a := {b: {}}; out = a?.b?.c ?? "default"`, nil, "default")
+
+	// the right side is evaluated only if the left side is undefined
+	expectRun(t, `
+out = 0
+f := func() { out++; return 1 }
+a := 1 ?? f()
+b := undefined ?? f()`, nil, 1)
+}
+
 func TestMap(t *testing.T) {
 	expectRun(t, `
 out = {
@@ -2582,6 +3258,185 @@ out = m["foo"](2) + m["foo"](3)
 		nil, 3)
 }
 
+func TestMapHashKeys(t *testing.T) {
+	// keys keep their type
+	expectRun(t, `m := {}; m[1] = "a"; m["1"] = "b"; out = [m[1], m["1"]]`,
+		nil, ARR{"a", "b"})
+	expectRun(t, `m := {}; m['a'] = 1; m[true] = 2; m[1.5] = 3
+out = [m['a'], m["a"], m[true], m[1.5]]`,
+		nil, ARR{1, tengo.UndefinedValue, 2, 3})
+
+	// keys are no longer converted to strings
+	expectRun(t, `out = {"1": "s"}[1]`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = {"1": "s"}[string(1)]`, nil, "s")
+	expectRun(t, `m := {}; m[1] = "x"; out = m["1"]`, nil,
+		tengo.UndefinedValue)
+	expectRun(t, `m := {}; m[1] = 2; out = len(m)`, nil, 1)
+	expectRun(t, `m := {a: 1}; m[1] = 2; m[2] = 3; out = len(m)`, nil, 3)
+
+	// integral floats are the same keys as ints
+	expectRun(t, `m := {}; m[1] = "a"; m[1.0] = "b"; out = [len(m), m[1]]`,
+		nil, ARR{1, "b"})
+
+	// iteration returns the original keys
+	expectRun(t, `m := {}; m[1] = 2; out = 0; for k, v in m { out = k + v }`,
+		nil, 3)
+	expectRun(t, `m := {}; m['x'] = 1; out = ""; for k, _ in m { out = type_name(k) }`,
+		nil, "char")
+
+	// immutable arrays are tuple keys
+	expectRun(t, `m := {}; m[immutable([1, "a"])] = 5; out = m[immutable([1, "a"])]`,
+		nil, 5)
+	expectRun(t, `m := {}; m[immutable([1, "a"])] = 5; out = m[immutable([1, "b"])]`,
+		nil, tengo.UndefinedValue)
+	expectRun(t, `m := {}; m[immutable([1, 2])] = 5; for k, _ in m { out = k[1] }`,
+		nil, 2)
+
+	// equality, copy and immutable maps
+	expectRun(t, `m1 := {}; m1[1] = 2; m2 := {}; m2[1] = 2; out = m1 == m2`,
+		nil, true)
+	expectRun(t, `m1 := {}; m1[1] = 2; m2 := {}; m2["1"] = 2; out = m1 == m2`,
+		nil, false)
+	expectRun(t, `m1 := {}; m1[1] = 2; m2 := copy(m1); m2[1] = 3; out = [m1[1], m2[1]]`,
+		nil, ARR{2, 3})
+	expectRun(t, `m := {}; m[1] = 2; out = immutable(m)[1]`, nil, 2)
+	expectError(t, `m := {}; m[1] = 2; m = immutable(m); m[1] = 3`,
+		nil, "not index-assignable")
+	expectRun(t, `m := {}; m[1] = 2; delete(m, 1); out = len(m)`, nil, 0)
+
+	// unhashable keys
+	expectError(t, `m := {}; m[[1]] = 2`, nil, "invalid index type")
+	expectError(t, `m := {}; m[{}] = 2`, nil, "invalid index type")
+	expectError(t, `m := {}; m[immutable([[1]])] = 2`, nil,
+		"invalid index type")
+
+	// NaN is not equal to itself, so it cannot be a key
+	expectError(t, `m := {}; m[0.0/0.0] = 2`, nil, "invalid index type")
+	expectError(t, `s := set(); s.add(0.0/0.0)`, nil,
+		"expected hashable, found float")
+
+	// nested tuples are compared by their elements
+	expectRun(t, `
+m := {}
+m[immutable([immutable([1, 2]), 3])] = "a"
+m[immutable([1, immutable([2, 3])])] = "b"
+m[immutable([])] = "c"
+m[immutable([immutable([])])] = "d"
+out = [len(m), m[immutable([immutable([1, 2]), 3])],
+	m[immutable([immutable([])])]]`,
+		nil, ARR{4, "a", "d"})
+}
+
+func TestSet(t *testing.T) {
+	expectRun(t, `out = len(set(1, 2, 2, "a"))`, nil, 3)
+	expectRun(t, `out = len(set([1, 2, 1]...))`, nil, 2)
+	expectRun(t, `out = type_name(set())`, nil, "set")
+	expectRun(t, `out = string(set(1))`, nil, "set(1)")
+	expectRun(t, `out = set(1, "a") == set("a", 1)`, nil, true)
+	expectRun(t, `out = set(1, 2) == set(1)`, nil, false)
+	expectRun(t, `out = set(1) == set("1")`, nil, false)
+	expectRun(t, `out = set(1) == [1]`, nil, false)
+	expectRun(t, `out = set() ? 1 : 2`, nil, 2)
+	expectRun(t, `out = set(0) ? 1 : 2`, nil, 1)
+	expectRun(t, `out = is_set(set())`, nil, true)
+	expectRun(t, `out = is_set({})`, nil, false)
+
+	// add and remove
+	expectRun(t, `s := set(); s.add(1, 2); s.add(2); out = len(s)`, nil, 2)
+	expectRun(t, `s := set(1, 2, 3); s.remove(1, 3, 4); out = s == set(2)`,
+		nil, true)
+	expectError(t, `set().add([1])`, nil,
+		"invalid type for argument 'element' in call to 'user-function:add': expected hashable, found array")
+	expectError(t, `set({})`, nil,
+		"invalid type for argument 'element' in call to 'builtin-function:set': expected hashable, found map")
+	expectError(t, `set().foo()`, nil, "unknown method 'foo' of set")
+
+	// iteration
+	expectRun(t, `out = 0; for x in set(1, 2, 3) { out += x }`, nil, 6)
+	expectRun(t, `out = 0; for i, _ in set(1, 2, 3) { out += i }`, nil, 3)
+
+	// set algebra
+	expectRun(t, `out = set(1, 2) | set(2, 3) == set(1, 2, 3)`, nil, true)
+	expectRun(t, `out = set(1, 2) & set(2, 3) == set(2)`, nil, true)
+	expectRun(t, `out = set(1, 2) - set(2, 3) == set(1)`, nil, true)
+	expectRun(t, `out = set(1, 2) ^ set(2, 3) == set(1, 3)`, nil, true)
+	expectRun(t, `s := set(1); s |= set(2); out = len(s)`, nil, 2)
+	expectError(t, `set(1) + set(2)`, nil, "invalid operation: set + set")
+	expectError(t, `set(1) | [2]`, nil, "invalid operation: set | array")
+
+	// copy and immutable
+	expectRun(t, `s1 := set(1); s2 := copy(s1); s2.add(2); out = [len(s1), len(s2)]`,
+		nil, ARR{1, 2})
+	expectRun(t, `s1 := set(1); s2 := s1; s2.add(2); out = len(s1)`, nil, 2)
+	expectRun(t, `out = type_name(immutable(set(1)))`, nil, "immutable-set")
+	expectRun(t, `out = is_immutable_set(immutable(set(1)))`, nil, true)
+	expectRun(t, `out = immutable(set(1)) == set(1)`, nil, true)
+	expectRun(t, `out = len(immutable(set(1, 2)))`, nil, 2)
+	expectRun(t, `out = type_name(immutable(set(1)) | set(2))`, nil, "set")
+	expectRun(t, `out = type_name(copy(immutable(set(1))))`, nil, "set")
+	expectRun(t, `out = type_name(freeze([set(1)])[0])`, nil, "immutable-set")
+	expectError(t, `immutable(set(1)).add(2)`, nil, "not indexable")
+}
+
+func TestIn(t *testing.T) {
+	// arrays
+	expectRun(t, `out = 1 in [1, 2]`, nil, true)
+	expectRun(t, `out = 3 in [1, 2]`, nil, false)
+	expectRun(t, `out = "a" in immutable(["a"])`, nil, true)
+	expectRun(t, `out = [1] in [[1], 2]`, nil, true)
+	expectRun(t, `out = 1 in []`, nil, false)
+	expectRun(t, `out = 3 not in [1, 2]`, nil, true)
+
+	// maps
+	expectRun(t, `out = "a" in {a: 1}`, nil, true)
+	expectRun(t, `out = "b" in {a: 1}`, nil, false)
+	expectRun(t, `out = "a" in {a: undefined}`, nil, true)
+	expectRun(t, `m := {}; m[1] = 2; out = [1 in m, "1" in m]`,
+		nil, ARR{true, false})
+	expectRun(t, `out = [1] in {a: 1}`, nil, false)
+	expectRun(t, `out = "a" in immutable({a: 1})`, nil, true)
+	expectRun(t, `out = "b" not in {a: 1}`, nil, true)
+
+	// strings and bytes
+	expectRun(t, `out = "ell" in "hello"`, nil, true)
+	expectRun(t, `out = 'h' in "hello"`, nil, true)
+	expectRun(t, `out = "" in "hello"`, nil, true)
+	expectRun(t, `out = "x" not in "hello"`, nil, true)
+	expectRun(t, `out = bytes("ll") in bytes("hello")`, nil, true)
+	expectRun(t, `out = 104 in bytes("hello")`, nil, true)
+	expectRun(t, `out = 'x' in bytes("hello")`, nil, false)
+	expectRun(t, `out = 360 in bytes("hello")`, nil, false)
+	expectError(t, `1 in "hello"`, nil, "invalid operation: int in string")
+	expectError(t, `"h" in bytes("hello")`, nil,
+		"invalid operation: string in bytes")
+
+	// sets
+	expectRun(t, `out = 2 in set(1, 2)`, nil, true)
+	expectRun(t, `out = 3 in immutable(set(1, 2))`, nil, false)
+	expectError(t, `b := [1] in set(1)`, nil, "not hashable")
+	expectError(t, `b := [1] in immutable(set(1))`, nil, "not hashable")
+	expectRun(t, `out = 3 not in set(1, 2)`, nil, true)
+
+	// unsupported containers
+	expectError(t, `1 in 1`, nil, "invalid operation: int in int")
+	expectError(t, `1 not in undefined`, nil,
+		"invalid operation: int in undefined")
+
+	// precedence
+	expectRun(t, `out = 1 + 1 in [2]`, nil, true)
+	expectRun(t, `out = 1 in [1] && 2 not in [1]`, nil, true)
+	expectRun(t, `out = !(1 in [1])`, nil, false)
+	expectRun(t, `not := [1]; out = 1 in not`, nil, true)
+
+	// for statements
+	expectRun(t, `out = 0; for x in [1, 2, 3] { if x in [1, 3] { out += x } }`,
+		nil, 4)
+	expectRun(t, `out = 0; for i := 0; i in [0, 1, 2]; i++ { out++ }`,
+		nil, 3)
+	expectError(t, `for x in [1, 2] in [[1, 2]] {}`, nil,
+		"not iterable: bool")
+}
+
 func TestBuiltin(t *testing.T) {
 	m := Opts().Module("math",
 		&tengo.BuiltinModule{
@@ -2847,24 +3702,39 @@ func TestBangOperator(t *testing.T) {
 
 func TestObjectsLimit(t *testing.T) {
 	testAllocsLimit(t, `5`, 0)
-	testAllocsLimit(t, `5 + 5`, 1)
+	testAllocsLimit(t, `5 + 5`, 0) // folded at compile time
+	testAllocsLimit(t, `a := 5; a + 5`, 1)
 	testAllocsLimit(t, `a := [1, 2, 3]`, 1)
 	testAllocsLimit(t, `a := 1; b := 2; c := 3; d := [a, b, c]`, 1)
 	testAllocsLimit(t, `a := {foo: 1, bar: 2}`, 1)
 	testAllocsLimit(t, `a := 1; b := 2; c := {foo: a, bar: b}`, 1)
 	testAllocsLimit(t, `
 f := func() {
-	return 5 + 5
+	a := 5
+	return a + 5
 }
 a := f() + 5
 `, 2)
 	testAllocsLimit(t, `
 f := func() {
-	return 5 + 5
+	a := 5
+	return a + 5
 }
 a := f()
 `, 1)
 	testAllocsLimit(t, `
+f := func() {
+	return 5 + 5
+}
+a := f() + 5
+`, 1)
+	testAllocsLimit(t, `
+f := func() {
+	return 5 + 5
+}
+a := f()
+`, 0)
+	testAllocsLimit(t, `
 a := []
 f := func() {
 	a = append(a, 5)
@@ -3372,9 +4242,694 @@ out = x.at([1, 2, 3], 0)
 `, Opts().Stdlib(), 1)
 }
 
+func TestSwitch(t *testing.T) {
+	expectRun(t, `
+x := 2
+switch x {
+case 1:
+	out = "one"
+case 2:
+	out = "two"
+default:
+	out = "other"
+}`, nil, "two")
+	expectRun(t, `switch 5 { case 1: out = 1; default: out = 2 }`, nil, 2)
+	expectRun(t, `switch 5 { default: out = 2; case 5: out = 1 }`, nil, 1)
+	expectRun(t, `switch 5 { default: out = 2; case 4: out = 1 }`, nil, 2)
+	expectRun(t, `out = 0; switch 5 { case 1: out = 1 }`, nil, 0)
+	expectRun(t, `out = 0; switch 5 {}`, nil, 0)
+	expectRun(t, `switch "b" { case "a", "b", "c": out = 1; case "b": out = 2 }`,
+		nil, 1)
+	expectRun(t, `switch [1, 2] { case [1]: out = 1; case [1, 2]: out = 2 }`,
+		nil, 2)
+	expectRun(t, `
+out = []
+for x in [1, 2, 3, 4, 5] {
+	switch {
+	case x < 2:
+		out = append(out, "a")
+	case x < 4, x == 5:
+		out = append(out, "b")
+	default:
+		out = append(out, "c")
+	}
+}`, nil, ARR{"a", "b", "b", "c", "b"})
+
+	// tag is evaluated only once
+	expectRun(t, `
+n := 0
+f := func() { n++; return n }
+switch f() { case 0: out = -1; case 2: out = -2; case 1: out = n }`,
+		nil, 1)
+
+	// cases are evaluated in order until a match
+	expectRun(t, `
+out = []
+f := func(x) { out = append(out, x); return x }
+switch 2 { case f(1), f(2), f(3): out = append(out, "x"); case f(4): }`,
+		nil, ARR{1, 2, "x"})
+
+	// break and continue
+	expectRun(t, `
+out = 0
+switch 1 {
+case 1:
+	out = 1
+	if out == 1 { break }
+	out = 2
+}`, nil, 1)
+	expectRun(t, `
+out = 0
+for i := 0; i < 10; i++ {
+	switch i {
+	case 3:
+		continue
+	case 6:
+		break
+	}
+	if i == 8 { break }
+	out += i
+}`, nil, 25) // 0 + 1 + 2 + 4 + 5 + 6 + 7
+	expectRun(t, `
+out = []
+for x in [1, 2, 3] {
+	switch x {
+	case 2:
+		for y in [4, 5, 6] {
+			switch y { case 5: continue }
+			out = append(out, y)
+		}
+	default:
+		switch { case true: break }
+		out = append(out, x)
+	}
+}`, nil, ARR{1, 4, 6, 3})
+
+	// scopes
+	expectRun(t, `
+out = 0
+a := 1
+switch a {
+case 1:
+	a := 2
+	out += a
+}
+out += a`, nil, 3)
+	expectRun(t, `
+f := func(x) {
+	a := 10
+	switch x {
+	case 1:
+		b := a + 1
+		return b
+	case 2:
+		b := a + 2
+		return b
+	}
+	return a
+}
+out = [f(1), f(2), f(3)]`, nil, ARR{11, 12, 10})
+	expectRun(t, `
+out = []
+for i := 0; i < 2; i++ {
+	switch i {
+	case 0:
+		try {
+			out = append(out, "a")
+			break
+		} finally {
+			out = append(out, "b")
+		}
+	case 1:
+		try {
+			1 + "a"
+		} catch {
+			out = append(out, "c")
+			continue
+		} finally {
+			out = append(out, "d")
+		}
+	}
+	out = append(out, i)
+}`, nil, ARR{"a", "b", 0, "c", "d"})
+	expectRun(t, `
+m := import("mod1")
+out = [m(1), m(2)]`,
+		Opts().Module("mod1", `
+x := 1
+export func(y) {
+	switch y {
+	case x:
+		return "one"
+	}
+	return "other"
+}`), ARR{"one", "other"})
+
+	// switch keywords can still be used as selectors and map keys
+	expectRun(t, `
+cfg := {switch: 1, case: 2, default: 3}
+cfg.default += 10
+out = [cfg.switch, cfg.case, cfg.default]`, nil, ARR{1, 2, 13})
+	expectRun(t, `
+m := {type: 1, default: 2, case: 3, yield: 4}
+out = m.type + m.default + m.case + m.yield`, nil, 10)
+
+	expectError(t, `switch 1 { case 1: 1 + "a" }`, nil,
+		"invalid operation: int + string")
+	expectError(t, `switch 1 { case 1: continue }`, nil,
+		"continue not allowed outside loop")
+	expectError(t, `switch 1 { case 1: a := 1 }; b := a`, nil,
+		"unresolved reference 'a'")
+}
+
+func TestDefer(t *testing.T) {
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, 1) }()
+	out = append(out, 0)
+}
+f()`, nil, ARR{0, 1})
+
+	// LIFO order, and arguments are evaluated when deferred
+	expectRun(t, `
+out = []
+add := func(x) { out = append(out, x) }
+f := func() {
+	for i := 0; i < 3; i++ {
+		defer add(i)
+	}
+	x := 10
+	defer add(x)
+	x = 20
+	defer add([x]...)
+	if x > 0 {
+		return
+	}
+	defer add(-1)
+}
+f()
+add("end")`, nil, ARR{20, 10, 2, 1, 0, "end"})
+
+	// return value is evaluated before the deferred calls
+	expectRun(t, `
+f := func() {
+	a := 1
+	defer func() { a = 2 }()
+	return a
+}
+out = f()`, nil, 1)
+	expectRun(t, `
+out = []
+f := func(n) {
+	defer func() { out = append(out, n) }()
+	if n > 0 {
+		return f(n - 1)
+	}
+	return n
+}
+f(3)`, nil, ARR{0, 1, 2, 3})
+	expectRun(t, `
+out = ""
+f := func(a, ...b) { out += a + len(b) }
+g := func() {
+	defer f("x")
+	defer f("y", 1, 2)
+	defer string("ignored")
+}
+g()`, nil, "y2x0")
+
+	// deferred calls in the main function run at the end of the script
+	expectRun(t, `
+out = []
+defer func() { out = append(out, 2) }()
+out = append(out, 1)`, Opts().Skip2ndPass(), ARR{1, 2})
+
+	// deferred calls are run while the error is unwinding
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "f") }()
+	return 1 + "a"
+}
+g := func() {
+	defer func() { out = append(out, "g") }()
+	f()
+	out = append(out, "unreachable")
+}
+try {
+	defer func() { out = append(out, "not in function") }()
+	g()
+} catch e {
+	out = append(out, e.value.message)
+}`, Opts().Skip2ndPass(), ARR{"f", "g", "invalid operation: int + string",
+		"not in function"})
+	expectRun(t, `
+out = []
+f := func() {
+	try {
+		defer func() { out = append(out, "deferred") }()
+		1 + "a"
+	} catch {
+		out = append(out, "caught")
+	}
+	out = append(out, "f")
+}
+f()`, nil, ARR{"caught", "f", "deferred"})
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "f") }()
+	1 + "a"
+}
+try { f() } catch e { out = append(out, e.value.pos) }`,
+		Opts().Skip2ndPass(), ARR{"f", "test:5:2"})
+
+	// errors in the deferred calls
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "f1") }()
+	defer func() { return 1 + "b" }()
+	defer func() { out = append(out, "f3") }()
+	return 1
+}
+try { f() } catch e { out = append(out, e.value.message) }`,
+		nil, ARR{"f3", "f1", "invalid operation: int + string"})
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "f1") }()
+	defer func() { return 1 - "b" }()
+	return 1 + "a"
+}
+try { f() } catch e { out = append(out, e.value.message) }`,
+		nil, ARR{"f1", "invalid operation: int - string"})
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "f") }()
+	defer 1()
+}
+try { f() } catch e { out = append(out, e.value.message) }`,
+		nil, ARR{"f", "not callable: int"})
+
+	expectError(t, `
+f := func() {
+	defer func() { return 1 + "b" }()
+	return 1 + "a"
+}
+f()`, Opts().Skip2ndPass(),
+		"Runtime Error: invalid operation: int + string\n"+
+			"\tat test:3:24\n\tat test:4:9\n\tat test:6:1")
+	expectError(t, `f := func() { defer 1() }; f()`, nil, "not callable: int")
+	expectError(t, `f := func() { defer f([1]...) }; f()`,
+		nil, "wrong number of arguments")
+	expectError(t, `a := 1; f := func() { defer f(a...) }; f()`,
+		nil, "not an array: int")
+
+	// sandbox limit errors cannot be handled
+	expectErrorIs(t, `
+a := 0
+f := func() {
+	defer func() { a = [1, 2, 3] }()
+	for { a++ }
+}
+f()`, Opts().MaxAllocs(10), tengo.ErrObjectAllocLimit)
+
+	// defer can still be used as a selector and a map key
+	expectRun(t, `
+out = []
+h := {defer: func(x) { out = append(out, x) }}
+f := func() {
+	defer h.defer(1)
+	h.defer(0)
+}
+f()`, nil, ARR{0, 1})
+}
+
+func TestDestructuring(t *testing.T) {
+	expectRun(t, `f := func() { return 1, 2 }; a, b := f(); out = [a, b]`,
+		nil, ARR{1, 2})
+	expectRun(t, `f := func() { return 1, "a" }; out = f()`,
+		nil, IARR{1, "a"})
+	expectRun(t, `f := func() { return 1, 2 }; out = f()[1]`, nil, 2)
+	expectRun(t, `f := func() { return 1, 2, 3 }; _, b, _ := f(); out = b`,
+		nil, 2)
+	expectRun(t, `
+f := func(x) {
+	if x > 0 { return x, "pos" }
+	return -x, "neg"
+}
+a, b := f(-3)
+c, d := f(4)
+out = [a, b, c, d]`, nil, ARR{3, "neg", 4, "pos"})
+
+	// arrays and values packed by a function are unpacked too
+	expectRun(t, `a, b := [1, 2]; out = a + b`, nil, 3)
+	expectRun(t, `a := 1; b := 2; a, b = [b, a]; out = [a, b]`,
+		nil, ARR{2, 1})
+	expectRun(t, `a := 1; b := 2; if true { [a, b] := [b, a]; out = [a, b] }`,
+		nil, ARR{2, 1})
+	expectRun(t, `
+g := func() { return 1, 2 }
+f := func() { return g() }
+a, b := f()
+out = [a, b]`, nil, ARR{1, 2})
+	expectRun(t, `
+f := func() { return 1, 2 }
+out = func() {
+	defer func() { out = 0 }()
+	a, b := f()
+	return b, a
+}()`, nil, IARR{2, 1})
+
+	// existing variables in the same block are assigned
+	expectRun(t, `
+f := func() { return 3, 4 }
+a := 1
+a, b := f()
+out = [a, b]`, nil, ARR{3, 4})
+	expectRun(t, `
+f := func() { return 3, 4 }
+a := 1
+func() { a, b := f() }()
+out = a`, nil, 1)
+	expectRun(t, `
+f := func() { return 3, 4 }
+a := 1
+b := 2
+func() { a, b = f() }()
+out = [a, b]`, nil, ARR{3, 4})
+	expectRun(t, `
+f := func() { return 3, 4 }
+m := {}
+arr := [0, 0]
+m.a, arr[1] = f()
+out = [m.a, arr]`, nil, ARR{3, ARR{0, 4}})
+	expectRun(t, `
+out = []
+f := func(i) { return i, i * 2 }
+for i := 0; i < 3; i++ {
+	a, b := f(i)
+	out = append(out, a + b)
+}`, nil, ARR{0, 3, 6})
+
+	// array and map patterns
+	expectRun(t, `[x, y] := [1, 2, 3]; out = [x, y]`, nil, ARR{1, 2})
+	expectRun(t, `[x, y, z] := [1, 2]; out = [x, y, z]`,
+		nil, ARR{1, 2, tengo.UndefinedValue})
+	expectRun(t, `[x, _, z] := "abc"; out = [x, z]`, nil, ARR{'a', 'c'})
+	expectRun(t, `
+{name, age: n} := {name: "foo", age: 20}
+out = [name, n]`, nil, ARR{"foo", 20})
+	expectRun(t, `{a} := {b: 1}; out = a`, nil, tengo.UndefinedValue)
+	expectRun(t, `
+[a, {b, c: [d, e]}] := [1, {b: 2, c: [3, 4]}]
+out = [a, b, d, e]`, nil, ARR{1, 2, 3, 4})
+	expectRun(t, `
+f := func() { return {x: 1}, [2] }
+{x}, [y] := f()
+out = [x, y]`, nil, ARR{1, 2})
+	expectRun(t, `
+x := 0
+y := 0
+[x, y] = [1, 2]
+[x, y] = [y, x]
+out = [x, y]`, nil, ARR{2, 1})
+
+	// multiple values are unpacked without allocating an array
+	expectRun(t, `
+f := func() { return 1, 2 }
+for i := 0; i < 10; i++ { a, b := f() }`,
+		Opts().Skip2ndPass().MaxAllocs(25), tengo.UndefinedValue)
+	expectErrorIs(t, `
+f := func() { return 1, 2 }
+for i := 0; i < 10; i++ { a := f() }`,
+		Opts().Skip2ndPass().MaxAllocs(25), tengo.ErrObjectAllocLimit)
+
+	expectError(t, `a, b := 1`, nil,
+		"assignment mismatch: 2 variables but 1 value")
+	expectError(t, `f := func() { return 1, 2, 3 }; a, b := f()`, nil,
+		"assignment mismatch: 2 variables but 3 values")
+	expectError(t, `f := func() { return }; a, b := f()`, nil,
+		"assignment mismatch: 2 variables but 1 value")
+	expectError(t, `[a, b] := 1`, nil, "not indexable: int")
+	expectError(t, `{a} := [1]`, nil, "invalid index type: string")
+}
+
+func TestTry(t *testing.T) {
+	expectRun(t, `try { out = 1 + "a" } catch e { out = e.value.message }`,
+		nil, "invalid operation: int + string")
+	expectRun(t, `try { out = 1 + "a" } catch e { out = e.value.pos }`,
+		Opts().Skip2ndPass(), "test:1:13")
+	expectRun(t, `try { out = 1 } catch e { out = 2 }`, nil, 1)
+	expectRun(t, `try { out = 1 + "a" } catch { out = 2 }`, nil, 2)
+	expectRun(t, `try { out = 1 + "a" } catch _ { out = 2 }`, nil, 2)
+	expectRun(t, `
+a := [1, 2]
+try { a[5] = 3 } catch e { out = [is_error(e), e.value.message] }`,
+		nil, ARR{true, "index out of bounds"})
+
+	// errors in the called functions
+	expectRun(t, `
+f := func(x) { return x + "a" }
+g := func(x) { return f(x) }
+try { g(1) } catch e { out = e.value }`,
+		Opts().Skip2ndPass(), IMAP{"message": "invalid operation: int + string",
+			"pos": "test:2:23"})
+	expectRun(t, `
+f := func(x) {
+	a := x * 2
+	try {
+		a += "a"
+	} catch e {
+		a += 1
+	}
+	return a
+}
+out = f(5)`, nil, 11)
+
+	// finally
+	expectRun(t, `
+out = []
+try { out = append(out, 1) } finally { out = append(out, 2) }`,
+		nil, ARR{1, 2})
+	expectRun(t, `
+out = []
+try {
+	try { 1 + "a" } finally { out = append(out, 1) }
+} catch e {
+	out = append(out, 2)
+} finally {
+	out = append(out, 3)
+}`, nil, ARR{1, 2, 3})
+	expectRun(t, `
+out = []
+try {
+	try { 1 + "a" } catch { 2 + "b" } finally { out = append(out, 1) }
+} catch e {
+	out = append(out, e.value.pos)
+}`, Opts().Skip2ndPass(), ARR{1, "test:4:26"})
+	expectError(t, `
+out := []
+try {
+	out = append(out, 1)
+	out = 1 + "a"
+} finally {
+	out = append(out, 2)
+}`, nil, "Runtime Error: invalid operation: int + string\n\tat test:5:8")
+	expectError(t, `
+f := func(x) {
+	try { return x + "a" } finally { x = 1 }
+}
+g := func() { f(1) }
+g()`, nil, "Runtime Error: invalid operation: int + string"+
+		"\n\tat test:3:15\n\tat test:5:15\n\tat test:6:1")
+
+	// return, break and continue leave the try statement
+	expectRun(t, `
+out = []
+f := func() {
+	try {
+		return 1
+	} finally {
+		out = append(out, 2)
+	}
+}
+r := f()
+out = append(out, r)`, nil, ARR{2, 1})
+	expectRun(t, `
+out = []
+f := func() {
+	try {
+		try { return 1 } finally { out = append(out, 2) }
+	} finally {
+		out = append(out, 3)
+	}
+}
+r := f()
+out = append(out, r)
+try { 1 + "a" } catch { out = append(out, 4) }`, nil, ARR{2, 3, 1, 4})
+	expectRun(t, `
+out = []
+for i := 0; i < 5; i++ {
+	try {
+		if i == 1 { continue }
+		if i == 3 { break }
+		out = append(out, i)
+	} finally {
+		out = append(out, -i)
+	}
+}
+try { 1 + "a" } catch { out = append(out, 10) }`,
+		nil, ARR{0, 0, -1, 2, -2, -3, 10})
+	expectRun(t, `
+out = 0
+try {
+	for i := 0; i < 5; i++ {
+		try { if i == 2 { break } } catch {}
+		out += i
+	}
+	1 + "a"
+} catch {
+	out += 10
+}`, nil, 11)
+	expectRun(t, `
+f := func() {
+	try { return 1 + "a" } catch e { return 2 } finally { out = 3 }
+}
+out = [f(), out]`, nil, ARR{2, 3})
+
+	// Go function errors
+	userErr := errors.New("user error")
+	fail := &tengo.UserFunction{
+		Name: "fail",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return nil, userErr
+		},
+	}
+	expectRun(t, `try { fail() } catch e { out = e.value.message }`,
+		Opts().Symbol("fail", fail).Skip2ndPass(), "user error")
+	expectErrorIs(t, `a := 0; try { fail() } finally { a = 1 }`,
+		Opts().Symbol("fail", fail).Skip2ndPass(), userErr)
+
+	// callbacks
+	each := &tengo.BuiltinFunction{
+		Name: "each",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			var res []tengo.Object
+			for _, e := range args[0].(*tengo.Array).Value {
+				ret, err := vm.Call(args[1], e)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, ret)
+			}
+			return &tengo.Array{Value: res}, nil
+		},
+	}
+	opts := Opts().Symbol("each", each).Skip2ndPass()
+	expectRun(t, `
+out = each([1, "a", 3], func(x) {
+	try { return x * 2 } catch { return 0 }
+})`, opts, ARR{2, 0, 6})
+	expectRun(t, `
+try {
+	each([1, "a", 3], func(x) { return x * 2 })
+} catch e {
+	out = e.value.pos
+}`, opts, "test:3:37")
+
+	// limits are not catchable
+	expectError(t, `
+for {
+	try { a := [1, 2, 3] } catch {}
+}`, Opts().MaxAllocs(10).Skip2ndPass(), "allocation limit exceeded")
+	expectRun(t, `
+f := func() { try { f() } catch e { out = e.value.message } }
+f()`, Opts().Skip2ndPass(), "stack overflow")
+
+	// try keywords can still be used as selectors and map keys
+	expectRun(t, `
+r := {try: 1, catch: 2}
+r.finally = 3
+try { out = [r.try, r.catch, r.finally] } catch { out = 0 }`,
+		nil, ARR{1, 2, 3})
+}
+
 func TestVMStackOverflow(t *testing.T) {
 	expectError(t, `f := func() { return f() + 1 }; f()`,
 		nil, "stack overflow")
+
+	// the stack grows for the values of a single expression
+	elems := strings.Repeat("a, ", 499) + "a"
+	expectRun(t, `a := 1; out = len([`+elems+`])`, nil, 500)
+	expectRun(t, `out = func(a) { return len([`+elems+`]) }(1)`, nil, 500)
+	elems = strings.Repeat("a, ", 2999) + "a"
+	expectError(t, `a := 1; b := len([`+elems+`])`,
+		nil, "stack overflow")
+	expectError(t, `
+f := func(...a) { return a }
+b := []
+for i := 0; i < 3000; i++ { b = append(b, i) }
+f(b...)`, nil, "stack overflow")
+}
+
+func TestVMRunAfterFailedCall(t *testing.T) {
+	file := parse(t, `
+out := []
+add := func(x) {
+	defer func() { out = append(out, "deferred") }()
+	try { out = append(out, x) } catch {}
+	return len(out)
+}
+fail := func() {
+	defer func() { out = append(out, "failed") }()
+	return 1 + "a"
+}
+id := func(x) { return x }
+if failing { fail() }`)
+	symTable := tengo.NewSymbolTable()
+	failing := symTable.Define("failing")
+	for idx, fn := range tengo.GetAllBuiltinFunctions() {
+		symTable.DefineBuiltin(idx, fn.Name)
+	}
+	c := tengo.NewCompiler(file.InputFile, symTable, nil, nil, nil)
+	require.NoError(t, c.Compile(file))
+	globals := make([]tengo.Object, tengo.GlobalsSize)
+	global := func(name string) tengo.Object {
+		sym, _, ok := symTable.Resolve(name, false)
+		require.True(t, ok)
+		return globals[sym.Index]
+	}
+
+	// the states of the failed run are not left in the VM
+	globals[failing.Index] = tengo.TrueValue
+	v := tengo.NewVM(c.Bytecode(), globals, -1)
+	require.Error(t, v.Run())
+	ret, err := v.RunCompiled(global("id").(*tengo.CompiledFunction),
+		tengo.TrueValue)
+	require.NoError(t, err)
+	require.Equal(t, tengo.TrueValue, ret)
+	add := global("add").(*tengo.CompiledFunction)
+	ret, err = v.RunCompiled(add, &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, ret)
+	require.Equal(t, toObject(ARR{"failed", 1, "deferred"}), global("out"))
+
+	_, err = v.RunCompiled(global("fail").(*tengo.CompiledFunction))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(),
+		"invalid operation: int + string"), err.Error())
+	ret, err = v.RunCompiled(add, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 5}, ret)
+
+	globals[failing.Index] = tengo.FalseValue
+	require.NoError(t, v.Run())
+	require.Equal(t, toObject(ARR{}), global("out"))
+	require.True(t, v.IsStackEmpty())
 }
 
 func TestString(t *testing.T) {
@@ -3475,6 +5030,29 @@ func TestString(t *testing.T) {
 	expectError(t, `1 + "foo"`, nil, "invalid operation")
 
 	expectError(t, `"foo" - "bar"`, nil, "invalid operation")
+
+	// string interpolation
+	expectRun(t, `id := 5; name := "bob"; out = "id=${id} name=${name}"`,
+		nil, "id=5 name=bob")
+	expectRun(t, `a := [1, 2]; out = "${a}${a[1]}"`, nil, "[1, 2]2")
+	expectRun(t, `out = "${1.5} ${true} ${'X'} ${error(5)} ${undefined}"`,
+		nil, "1.5 true X error: 5 <undefined>")
+	expectRun(t, `out = "${ {a: 1}.a + 1 }"`, nil, "2")
+	expectRun(t, `out = "${"${"a" + "b"}c"}d"`, nil, "abcd")
+	expectRun(t, `f := func(x) { return "<${x}>" }; out = "${f(1)}${f(2)}"`,
+		nil, "<1><2>")
+	expectRun(t, `x := 1; out = "${x > 0 ? "pos" : "neg"}"`, nil, "pos")
+	expectRun(t, "x := 1; out = `a\n${x}\n${\n\tx + 1\n}`",
+		nil, "a\n1\n2")
+	expectRun(t, `out = "\${a} \\${1} $ $a {a}"`, nil, "${a} \\1 $ $a {a}")
+	expectRun(t, "out = `\\${a} \\n`", nil, "${a} \\n")
+	expectRun(t, `out = "${"a"}" == "a"`, nil, true)
+	expectError(t, `out := "${1 + "a"}"`, nil, "invalid operation")
+	// the result is built with a single allocation
+	expectRun(t, `a := "a"; out = "${a}${a}${a}${a}"`,
+		Opts().MaxAllocs(1).Skip2ndPass(), "aaaa")
+	expectError(t, `a := "a"; a = a + a + a + a`,
+		Opts().MaxAllocs(1), "allocation limit exceeded")
 }
 
 func TestTailCall(t *testing.T) {
@@ -3567,6 +5145,62 @@ iter := func(n, max) {
 iter(0, 9999)
 out = c 
 `, nil, 9999)
+
+	// mutual recursion
+	expectRun(t, `
+even := undefined
+odd := func(n) { if n == 0 { return false }; return even(n-1) }
+even = func(n) { if n == 0 { return true }; return odd(n-1) }
+out = [even(10000), odd(10001), even(9999)]
+`, nil, ARR{true, true, false})
+
+	// continuation-passing style with closures of different free variables
+	expectRun(t, `
+sum := func(n, k) {
+	if n == 0 { return k(0) }
+	return sum(n-1, func(s) { return k(s+n) })
+}
+out = sum(3000, func(s) { return s })
+`, nil, 4501500)
+	expectRun(t, `
+count := func(n, k) {
+	if n == 0 { return k }
+	return count(n-1, k+1)
+}
+step := func(n) { return count(n, 0) }
+out = step(5000)
+`, nil, 5000)
+
+	// variadic callees and multiple results
+	expectRun(t, `
+f := func(n, ...a) { if n == 0 { return len(a) }; return f(n-1, a...) }
+g := func(n) { return f(n, 1, 2, 3) }
+out = g(5000)
+`, nil, 3)
+	expectRun(t, `
+pair := func(a, b) { return b, a }
+f := func(n) { if n == 0 { return pair(1, 2) }; return f(n-1) }
+a, b := f(5000)
+out = [a, b]
+`, nil, ARR{2, 1})
+	expectRun(t, `
+f := func(n) { if n == 0 { return len([1, 2]) }; return f(n-1) }
+out = f(5000)
+`, nil, 2)
+
+	// calls inside try statements or with deferred calls keep the frame
+	expectRun(t, `
+f := func() { return 1 + "a" }
+g := func() { try { return f() } catch e { return e.value.message } }
+out = g()
+`, nil, "invalid operation: int + string")
+	expectRun(t, `
+out = []
+f := func() { out = append(out, 1); return 2 }
+g := func() { defer func() { out = append(out, 3) }(); return f() }
+r := g()
+out = append(out, r)
+`, nil, ARR{1, 3, 2})
 }
 
 // tail call with free vars
@@ -3585,6 +5219,53 @@ func() {
 }()`, nil, 25)
 }
 
+func TestPeephole(t *testing.T) {
+	expectRun(t, `out = func() { a := 1; a++; a += 10; return a }()`,
+		nil, 12)
+	expectRun(t, `out = func() { s := "a"; s += "b"; return s }()`,
+		nil, "ab")
+	expectRun(t, `
+out = func() {
+	s := 0
+	for i := 0; i < 10; i++ { s += i }
+	return s
+}()`, nil, 45)
+
+	// captured locals
+	expectRun(t, `
+out = func() {
+	a := 1
+	f := func() { return a }
+	a++
+	a *= 5
+	return [a, f()]
+}()`, nil, ARR{10, 10})
+	expectRun(t, `
+out = func() {
+	a := {x: 5}
+	k := "x"
+	f := func() { return a[k] }
+	return [a[k], f()]
+}()`, nil, ARR{5, 5})
+	expectRun(t, `out = func() { a := [1, 2, 3]; i := 1; return a[i] }()`,
+		nil, 2)
+	expectRun(t, `out = func() { a := [1, 2, 3]; i := 5; return a[i] }()`,
+		nil, tengo.UndefinedValue)
+
+	// constant returns run the deferred calls
+	expectRun(t, `
+x := 0
+f := func() { defer func() { x = 5 }(); return 1 }
+out = [f(), x]`, nil, ARR{1, 5})
+
+	expectError(t, `f := func() { a := 1; a += "x" }; f()`,
+		nil, "Runtime Error: invalid operation: int + string\n\tat test:1:23")
+	expectError(t, `f := func() { a := 1; a /= 0 }; f()`,
+		nil, "Runtime Error: division by zero\n\tat test:1:23")
+	expectError(t, `f := func() { a := 1; b := 2; return a[b] }; f()`,
+		nil, "Runtime Error: not indexable: int\n\tat test:1:38")
+}
+
 func TestSpread(t *testing.T) {
 	expectRun(t, `
 	f := func(...a) {
@@ -3640,6 +5321,29 @@ func TestSpread(t *testing.T) {
 		"Runtime Error: wrong number of arguments: want=1, got=2")
 	expectError(t, `func(a, b, c) {}([1, 2]...)`, nil,
 		"Runtime Error: wrong number of arguments: want=3, got=2")
+
+	// spread in literals
+	expectRun(t, `a := [1, 2]; out = [a..., 3]`, nil, ARR{1, 2, 3})
+	expectRun(t, `a := [1]; b := immutable([2, 3]); out = [a..., b..., 4]`,
+		nil, ARR{1, 2, 3, 4})
+	expectRun(t, `out = [[]..., [[1]]...]`, nil, ARR{ARR{1}})
+	expectRun(t, `a := [1]; b := [a...]; b[0] = 2; out = a`, nil, ARR{1})
+
+	// later keys win
+	expectRun(t, `a := {x: 1, y: 2}; out = {a..., y: 3, z: 4}`,
+		nil, MAP{"x": 1, "y": 3, "z": 4})
+	expectRun(t, `a := {x: 1, y: 2}; out = {y: 3, a...}`,
+		nil, MAP{"x": 1, "y": 2})
+	expectRun(t, `a := {x: 1}; b := immutable({x: 2, y: 3}); out = {a..., b...}`,
+		nil, MAP{"x": 2, "y": 3})
+	expectRun(t, `a := {}; a[1] = "a"; b := {c: {a...}}; out = b.c[1]`,
+		nil, "a")
+	expectRun(t, `a := {}; a[1] = "a"; b := {}; b[1] = "b"; out = {a..., b...}[1]`,
+		nil, "b")
+	expectRun(t, `a := {x: 1}; b := {a...}; b.x = 2; out = a.x`, nil, 1)
+
+	expectError(t, `a := 1; b := [a...]`, nil, "not an array: int")
+	expectError(t, `a := [1]; b := {a...}`, nil, "not a map: array")
 }
 
 func TestSliceIndex(t *testing.T) {
@@ -3710,6 +5414,80 @@ func expectRun(
 	}
 }
 
+func TestVMRuntimeError(t *testing.T) {
+	var rerr *tengo.RuntimeError
+	expectErrorAs(t, `
+f := func(a) {
+	return a + "foo"
+}
+g := func() { f(1) }
+g()`, nil, &rerr)
+	require.Equal(t, "invalid operation: int + string", rerr.Err.Error())
+	require.Equal(t, 3, len(rerr.Frames))
+	require.Equal(t, "f", rerr.Frames[0].Name)
+	require.Equal(t, "test:3:9", rerr.Frames[0].Pos.String())
+	require.Equal(t, "g", rerr.Frames[1].Name)
+	require.Equal(t, "test:5:15", rerr.Frames[1].Pos.String())
+	require.Equal(t, "", rerr.Frames[2].Name)
+	require.Equal(t, "test:6:1", rerr.Frames[2].Pos.String())
+	require.Equal(t, "\treturn a + \"foo\"", rerr.Frames[0].Line)
+	require.Equal(t, "g := func() { f(1) }", rerr.Frames[1].Line)
+	require.Equal(t, "g()", rerr.Frames[2].Line)
+	require.Equal(t, 3, rerr.Pos().Line)
+	require.Equal(t, "Runtime Error: invalid operation: int + string"+
+		"\n\tat test:3:9\n\tat test:5:15\n\tat test:6:1", rerr.Error())
+
+	// the frame of a tail call is reused by the callee
+	expectErrorAs(t, `
+f := func(a) {
+	return a + "foo"
+}
+g := func() { return f(1) }
+g()`, nil, &rerr)
+	require.Equal(t, 2, len(rerr.Frames))
+	require.Equal(t, "f", rerr.Frames[0].Name)
+	require.Equal(t, "test:3:9", rerr.Frames[0].Pos.String())
+	require.Equal(t, "", rerr.Frames[1].Name)
+	require.Equal(t, "test:6:1", rerr.Frames[1].Pos.String())
+
+	// closures keep the name
+	expectErrorAs(t, `
+a := 1
+f := func() { return a + "foo" }
+f()`, nil, &rerr)
+	require.Equal(t, "f", rerr.Frames[0].Name)
+
+	// frames of the functions called back from Go are merged
+	each := &tengo.BuiltinFunction{
+		Name: "each",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			for _, e := range args[0].(*tengo.Array).Value {
+				if _, err := vm.Call(args[1], e); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	}
+	expectErrorAs(t, `
+h := func(x) { return x + "foo" }
+each([1], h)`, Opts().Symbol("each", each).Skip2ndPass(), &rerr)
+	require.Equal(t, 2, len(rerr.Frames))
+	require.Equal(t, "h", rerr.Frames[0].Name)
+	require.Equal(t, "test:2:23", rerr.Frames[0].Pos.String())
+	require.Equal(t, "test:3:1", rerr.Frames[1].Pos.String())
+	userErr := errors.New("user error")
+	fail := &tengo.UserFunction{
+		Name: "fail",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return nil, userErr
+		},
+	}
+	expectErrorIs(t, `each([1], func(x) { return fail() })`,
+		Opts().Symbol("each", each).Symbol("fail", fail).Skip2ndPass(),
+		userErr)
+}
+
 func expectError(
 	t *testing.T,
 	input string,
@@ -3978,6 +5756,10 @@ func objectZeroCopy(o tengo.Object) tengo.Object {
 		return &tengo.Int{}
 	case *tengo.Float:
 		return &tengo.Float{}
+	case *tengo.BigInt:
+		return &tengo.BigInt{Value: new(big.Int)}
+	case *tengo.Decimal:
+		return &tengo.Decimal{Value: new(big.Int)}
 	case *tengo.Bool:
 		return &tengo.Bool{}
 	case *tengo.Char:
@@ -3998,6 +5780,10 @@ func objectZeroCopy(o tengo.Object) tengo.Object {
 		return &tengo.ImmutableArray{}
 	case *tengo.ImmutableMap:
 		return &tengo.ImmutableMap{}
+	case *tengo.Set:
+		return &tengo.Set{}
+	case *tengo.ImmutableSet:
+		return &tengo.ImmutableSet{}
 	case nil:
 		panic("nil")
 	default: